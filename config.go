@@ -2,8 +2,14 @@ package ratchet
 
 import (
 	"fmt"
+	"log/slog"
+	"slices"
+	"time"
 
 	"github.com/platform-inf/go-ratchet/errlist"
+	"github.com/platform-inf/go-ratchet/journal"
+	"github.com/platform-inf/go-ratchet/keys"
+	"github.com/platform-inf/go-ratchet/padding"
 	"github.com/platform-inf/go-ratchet/receivingchain"
 	"github.com/platform-inf/go-ratchet/rootchain"
 	"github.com/platform-inf/go-ratchet/sendingchain"
@@ -11,22 +17,98 @@ import (
 )
 
 type config struct {
-	crypto           Crypto
-	receivingOptions []receivingchain.Option
-	rootOptions      []rootchain.Option
-	sendingOptions   []sendingchain.Option
+	associatedData         []byte
+	crypto                 Crypto
+	headerPaddingBlockSize int
+	journal                *journal.Journal
+	keysAllocator          keys.Allocator
+	logger                 *slog.Logger
+	metrics                Metrics
+	observer               Observer
+	paddingScheme          padding.Scheme
+	receivingOptions       []receivingchain.Option
+	rekeyMessagesCount     uint64
+	rekeyInterval          time.Duration
+	rootOptions            []rootchain.Option
+	sendingOptions         []sendingchain.Option
+	now                    func() time.Time
 }
 
 func newConfig(options ...Option) (config, error) {
-	cfg := config{crypto: newDefaultCrypto()}
+	cfg := config{crypto: newDefaultCrypto(), journal: &journal.Journal{}, now: time.Now}
 
 	if err := cfg.applyOptions(options...); err != nil {
 		return config{}, fmt.Errorf("%w: %w", errlist.ErrOption, err)
 	}
 
+	if cfg.logger != nil {
+		cfg.observer = newLogObserver(cfg.logger, cfg.observer)
+	}
+
+	if cfg.metrics != nil {
+		cfg.observer = newMetricsObserver(cfg.metrics, cfg.observer)
+	}
+
 	return cfg, nil
 }
 
+// allReceivingOptions returns receiving chain options with the ratchet journal, observer, associated data, padding and
+// public key validator of the crypto. Note that passed options take precedence.
+func (cfg config) allReceivingOptions() []receivingchain.Option {
+	options := []receivingchain.Option{receivingchain.WithJournal(cfg.journal)}
+	if cfg.observer != nil {
+		options = append(options, receivingchain.WithObserver(cfg.observer))
+	}
+
+	if len(cfg.associatedData) > 0 {
+		options = append(options, receivingchain.WithAssociatedData(cfg.associatedData))
+	}
+
+	if cfg.headerPaddingBlockSize > 0 {
+		options = append(options, receivingchain.WithHeaderPadding(cfg.headerPaddingBlockSize))
+	}
+
+	if cfg.paddingScheme != nil {
+		options = append(options, receivingchain.WithPadding(cfg.paddingScheme))
+	}
+
+	if validator, ok := cfg.crypto.(PublicKeyValidator); ok {
+		options = append(options, receivingchain.WithPublicKeyValidator(validator.ValidatePublicKey))
+	}
+
+	return append(options, cfg.receivingOptions...)
+}
+
+// allRootOptions returns root chain options with the ratchet journal and keys allocator. Note that passed options take
+// precedence.
+func (cfg config) allRootOptions() []rootchain.Option {
+	options := []rootchain.Option{rootchain.WithJournal(cfg.journal)}
+	if cfg.keysAllocator != nil {
+		options = append(options, rootchain.WithRootKeyAllocator(cfg.keysAllocator))
+	}
+
+	return append(options, cfg.rootOptions...)
+}
+
+// allSendingOptions returns sending chain options with the ratchet journal, associated data and padding. Note that
+// passed options take precedence.
+func (cfg config) allSendingOptions() []sendingchain.Option {
+	options := []sendingchain.Option{sendingchain.WithJournal(cfg.journal)}
+	if len(cfg.associatedData) > 0 {
+		options = append(options, sendingchain.WithAssociatedData(cfg.associatedData))
+	}
+
+	if cfg.headerPaddingBlockSize > 0 {
+		options = append(options, sendingchain.WithHeaderPadding(cfg.headerPaddingBlockSize))
+	}
+
+	if cfg.paddingScheme != nil {
+		options = append(options, sendingchain.WithPadding(cfg.paddingScheme))
+	}
+
+	return append(options, cfg.sendingOptions...)
+}
+
 func (cfg *config) applyOptions(options ...Option) error {
 	for _, option := range options {
 		if err := option(cfg); err != nil {
@@ -39,6 +121,21 @@ func (cfg *config) applyOptions(options ...Option) error {
 
 type Option func(cfg *config) error
 
+// WithAssociatedData sets associated data of the conversation, which is authenticated with every message before the
+// auth passed to Encrypt and Decrypt. Use it to bind the conversation to e.g. identity public keys of both
+// participants. Both participants must use the same data.
+func WithAssociatedData(data []byte) Option {
+	return func(cfg *config) error {
+		if len(data) == 0 {
+			return fmt.Errorf("%w: associated data is empty", errlist.ErrInvalidValue)
+		}
+
+		cfg.associatedData = slices.Clone(data)
+
+		return nil
+	}
+}
+
 func WithCrypto(crypto Crypto) Option {
 	return func(cfg *config) error {
 		if utils.IsNil(crypto) {
@@ -51,6 +148,98 @@ func WithCrypto(crypto Crypto) Option {
 	}
 }
 
+// WithHeaderPadding pads encoded headers to a multiple of blockSize before encryption, so all encrypted headers of the
+// conversation have the same length and do not reveal e.g. public key length. Both participants must use the same
+// block size, which must be greater than the encoded header length to make the padding effective.
+//
+// Note that header padding is supported only by the default chains crypto.
+func WithHeaderPadding(blockSize int) Option {
+	return func(cfg *config) error {
+		if blockSize <= 0 {
+			return fmt.Errorf("%w: non-positive header padding block size %d", errlist.ErrInvalidValue, blockSize)
+		}
+
+		cfg.headerPaddingBlockSize = blockSize
+
+		return nil
+	}
+}
+
+// WithKeysAllocator sets allocator for long-lived secrets: the root key and the local private key. Use it with
+// keys.NewLockedAllocator to keep these keys out of swap and core dumps.
+//
+// Note that root chain options passed with WithRootChainOptions take precedence over this option.
+func WithKeysAllocator(allocator keys.Allocator) Option {
+	return func(cfg *config) error {
+		if utils.IsNil(allocator) {
+			return fmt.Errorf("%w: allocator is nil", errlist.ErrInvalidValue)
+		}
+
+		cfg.keysAllocator = allocator
+
+		return nil
+	}
+}
+
+// WithLogger makes the ratchet log Diffie-Hellman ratchet steps, skipped keys and decryption failures at debug level.
+// Note that keys are never logged, only their fingerprints.
+func WithLogger(logger *slog.Logger) Option {
+	return func(cfg *config) error {
+		if logger == nil {
+			return fmt.Errorf("%w: logger is nil", errlist.ErrInvalidValue)
+		}
+
+		cfg.logger = logger
+
+		return nil
+	}
+}
+
+// WithMetrics makes the ratchet report counters of messages, failures, skipped keys and Diffie-Hellman ratchet steps
+// and durations of encryption and decryption. See Metric* constants for metric names.
+func WithMetrics(metrics Metrics) Option {
+	return func(cfg *config) error {
+		if utils.IsNil(metrics) {
+			return fmt.Errorf("%w: metrics is nil", errlist.ErrInvalidValue)
+		}
+
+		cfg.metrics = metrics
+
+		return nil
+	}
+}
+
+// WithObserver sets observer of the ratchet lifecycle events.
+//
+// Note that receiving chain options passed with WithReceivingChainOptions take precedence over this option.
+func WithObserver(observer Observer) Option {
+	return func(cfg *config) error {
+		if utils.IsNil(observer) {
+			return fmt.Errorf("%w: observer is nil", errlist.ErrInvalidValue)
+		}
+
+		cfg.observer = observer
+
+		return nil
+	}
+}
+
+// WithPadding pads message data with the passed scheme before encryption, so encrypted data length does not reveal
+// exact data length. Both participants must use the same scheme.
+//
+// Note that padding is supported only by the default chains crypto.
+func WithPadding(scheme padding.Scheme) Option {
+	return func(cfg *config) error {
+		if utils.IsNil(scheme) {
+			return fmt.Errorf("%w: padding scheme is nil", errlist.ErrInvalidValue)
+		}
+
+		cfg.paddingScheme = scheme
+
+		return nil
+	}
+}
+
 func WithReceivingChainOptions(options ...receivingchain.Option) Option {
 	return func(cfg *config) error {
 		cfg.receivingOptions = options
@@ -58,6 +247,34 @@ func WithReceivingChainOptions(options ...receivingchain.Option) Option {
 	}
 }
 
+// WithRekeyEveryMessages makes the ratchet generate the next local key pair after the passed number of messages in the
+// sending chain. See Ratchet.Rekey for when the conversation recovers.
+func WithRekeyEveryMessages(count uint64) Option {
+	return func(cfg *config) error {
+		if count == 0 {
+			return fmt.Errorf("%w: rekey messages count is zero", errlist.ErrInvalidValue)
+		}
+
+		cfg.rekeyMessagesCount = count
+
+		return nil
+	}
+}
+
+// WithRekeyInterval makes the ratchet generate the next local key pair when the sending chain is older than the passed
+// interval. See Ratchet.Rekey for when the conversation recovers.
+func WithRekeyInterval(interval time.Duration) Option {
+	return func(cfg *config) error {
+		if interval <= 0 {
+			return fmt.Errorf("%w: non-positive rekey interval %s", errlist.ErrInvalidValue, interval)
+		}
+
+		cfg.rekeyInterval = interval
+
+		return nil
+	}
+}
+
 func WithRootChainOptions(options ...rootchain.Option) Option {
 	return func(cfg *config) error {
 		cfg.rootOptions = options
@@ -75,6 +75,10 @@ func TestNewConfig(t *testing.T) {
 		if utils.IsNil(cfg.crypto) {
 			t.Fatal("newConfig() sets no default value for crypto")
 		}
+
+		if cfg.journal == nil {
+			t.Fatal("newConfig() sets no default value for journal")
+		}
 	})
 
 	t.Run("chain options", func(t *testing.T) {
@@ -131,4 +135,36 @@ func TestNewConfig(t *testing.T) {
 			t.Fatalf("WithCrypto(nil) error is not invalid value error but %v", err)
 		}
 	})
+
+	t.Run("keys allocator option success", func(t *testing.T) {
+		t.Parallel()
+
+		allocator := keys.NewLockedAllocator()
+
+		cfg, err := newConfig(WithKeysAllocator(allocator), WithRootChainOptions(rootchain.WithCrypto(testRootChainCrypto{})))
+		if err != nil {
+			t.Fatalf("newConfig() with options expected no error but got %v", err)
+		}
+
+		if cfg.keysAllocator != allocator {
+			t.Fatal("WithKeysAllocator() option did not set passed allocator")
+		}
+
+		if len(cfg.allRootOptions()) != 3 {
+			t.Fatalf("WithKeysAllocator() option did not pass allocator to root chain options: %d", len(cfg.allRootOptions()))
+		}
+	})
+
+	t.Run("keys allocator option error", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := newConfig(WithKeysAllocator(nil))
+		if err == nil || err.Error() != "option: invalid value: allocator is nil" {
+			t.Fatalf("WithKeysAllocator(nil) expected error but got %v", err)
+		}
+
+		if !errors.Is(err, errlist.ErrOption) || !errors.Is(err, errlist.ErrInvalidValue) {
+			t.Fatalf("WithKeysAllocator(nil) error is not option and invalid value error but %v", err)
+		}
+	})
 }
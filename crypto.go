@@ -3,16 +3,28 @@ package ratchet
 import (
 	"crypto/ecdh"
 	"crypto/rand"
+	"errors"
 	"fmt"
 
+	"github.com/platform-inf/go-ratchet/errlist"
 	"github.com/platform-inf/go-ratchet/keys"
 )
 
+// x25519PublicKeyLen is the length of X25519 public keys.
+const x25519PublicKeyLen = 32
+
 type Crypto interface {
 	ComputeSharedKey(privateKey keys.Private, publicKey keys.Public) (keys.Shared, error)
 	GenerateKeyPair() (keys.Private, keys.Public, error)
 }
 
+// PublicKeyValidator is an optional interface of Crypto, which validates remote public keys, e.g. from decrypted
+// headers, before they are used. Note that the ratchet wraps validation errors with errlist.ErrInvalidValue.
+type PublicKeyValidator interface {
+	// ValidatePublicKey must check length and encoding of the public key.
+	ValidatePublicKey(publicKey keys.Public) error
+}
+
 type defaultCrypto struct {
 	curve ecdh.Curve
 }
@@ -29,12 +41,13 @@ func (c defaultCrypto) ComputeSharedKey(privateKey keys.Private, publicKey keys.
 
 	foreignPublicKey, err := c.curve.NewPublicKey(publicKey.Bytes)
 	if err != nil {
-		return keys.Shared{}, fmt.Errorf("map to foreign public key: %w", err)
+		return keys.Shared{}, fmt.Errorf("%w: map to foreign public key: %w", errlist.ErrInvalidValue, err)
 	}
 
+	// Note that the only error here is the all-zero shared key, which is computed with a low order public key.
 	sharedKeyBytes, err := foreignPrivateKey.ECDH(foreignPublicKey)
 	if err != nil {
-		return keys.Shared{}, fmt.Errorf("Diffie-Hellman: %w", err)
+		return keys.Shared{}, fmt.Errorf("%w: Diffie-Hellman: %w", errlist.ErrInvalidValue, err)
 	}
 
 	return keys.Shared{Bytes: sharedKeyBytes}, nil
@@ -51,3 +64,69 @@ func (c defaultCrypto) GenerateKeyPair() (keys.Private, keys.Public, error) {
 
 	return privateKey, publicKey, nil
 }
+
+// ValidatePublicKey accepts only canonical X25519 public keys, i.e. 32 bytes of the little-endian coordinate, which is
+// less than 2^255 - 19. Note that low order keys are rejected later by the all-zero shared key.
+func (c defaultCrypto) ValidatePublicKey(publicKey keys.Public) error {
+	bytes := publicKey.Bytes
+	if len(bytes) != x25519PublicKeyLen {
+		return fmt.Errorf("public key length %d is not %d", len(bytes), x25519PublicKeyLen)
+	}
+
+	if bytes[x25519PublicKeyLen-1]&0x80 != 0 || isGreaterOrEqualToX25519Prime(bytes) {
+		return errors.New("public key is not canonical")
+	}
+
+	return nil
+}
+
+// computeSharedKey computes the shared key and rejects the all-zero one, which custom crypto may return for low order
+// public keys.
+func computeSharedKey(crypto Crypto, privateKey keys.Private, publicKey keys.Public) (keys.Shared, error) {
+	sharedKey, err := crypto.ComputeSharedKey(privateKey, publicKey)
+	if err != nil {
+		return keys.Shared{}, err
+	}
+
+	var bits byte
+	for _, b := range sharedKey.Bytes {
+		bits |= b
+	}
+
+	if bits == 0 {
+		sharedKey.Wipe()
+		return keys.Shared{}, fmt.Errorf("%w: shared key is zero", errlist.ErrInvalidValue)
+	}
+
+	return sharedKey, nil
+}
+
+// validatePublicKey validates the remote public key if crypto supports it.
+func validatePublicKey(crypto Crypto, publicKey keys.Public) error {
+	validator, ok := crypto.(PublicKeyValidator)
+	if !ok {
+		return nil
+	}
+
+	if err := validator.ValidatePublicKey(publicKey); err != nil {
+		return fmt.Errorf("%w: validate public key: %w", errlist.ErrInvalidValue, err)
+	}
+
+	return nil
+}
+
+// isGreaterOrEqualToX25519Prime checks whether the little-endian coordinate is at least 2^255 - 19, i.e. it is
+// 0x7F, 29 bytes of 0xFF and at least 0xED from the most significant byte.
+func isGreaterOrEqualToX25519Prime(bytes []byte) bool {
+	if bytes[x25519PublicKeyLen-1] != 0x7F || bytes[0] < 0xED {
+		return false
+	}
+
+	for _, b := range bytes[1 : x25519PublicKeyLen-1] {
+		if b != 0xFF {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,410 @@
+// Package cryptotest checks that custom crypto implementations follow the contracts, which the ratchet relies on.
+package cryptotest
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	ratchet "github.com/platform-inf/go-ratchet"
+	"github.com/platform-inf/go-ratchet/header"
+	"github.com/platform-inf/go-ratchet/keys"
+	"github.com/platform-inf/go-ratchet/ratchettest"
+	"github.com/platform-inf/go-ratchet/receivingchain"
+	"github.com/platform-inf/go-ratchet/rootchain"
+	"github.com/platform-inf/go-ratchet/sendingchain"
+)
+
+const keyLen = 32
+
+// Cryptos contains implementations to check. Nil implementations are not checked and the default ones are used in the
+// conversation instead. Note that Sending and Receiving must be passed together, because they encrypt and decrypt the
+// same messages.
+type Cryptos struct {
+	Ratchet   ratchet.Crypto
+	Root      rootchain.Crypto
+	Sending   sendingchain.Crypto
+	Receiving receivingchain.Crypto
+}
+
+// Run runs the conformance suite against passed implementations.
+func Run(t *testing.T, cryptos Cryptos) {
+	t.Helper()
+
+	if (cryptos.Sending == nil) != (cryptos.Receiving == nil) {
+		t.Fatal("Run(): sending and receiving cryptos must be passed together")
+	}
+
+	if cryptos.Ratchet != nil {
+		t.Run("ratchet", func(t *testing.T) { testRatchetCrypto(t, cryptos.Ratchet) })
+	}
+
+	if cryptos.Root != nil {
+		t.Run("root chain", func(t *testing.T) { testRootCrypto(t, cryptos.Root) })
+	}
+
+	if cryptos.Sending != nil {
+		t.Run("advance chain", func(t *testing.T) { testAdvanceChain(t, cryptos.Sending, cryptos.Receiving) })
+		t.Run("header", func(t *testing.T) { testHeader(t, cryptos.Sending, cryptos.Receiving) })
+		t.Run("message", func(t *testing.T) { testMessage(t, cryptos.Sending, cryptos.Receiving) })
+		t.Run("append", func(t *testing.T) { testAppend(t, cryptos.Sending, cryptos.Receiving) })
+	}
+
+	t.Run("conversation", func(t *testing.T) { testConversation(t, cryptos) })
+}
+
+func newBytes(b byte) []byte {
+	return bytes.Repeat([]byte{b}, keyLen)
+}
+
+func testRatchetCrypto(t *testing.T, crypto ratchet.Crypto) {
+	generateKeyPair := func() (keys.Private, keys.Public) {
+		t.Helper()
+
+		privateKey, publicKey, err := crypto.GenerateKeyPair()
+		if err != nil {
+			t.Fatalf("GenerateKeyPair(): expected no error but got %v", err)
+		}
+
+		if len(privateKey.Bytes) == 0 || len(publicKey.Bytes) == 0 {
+			t.Fatal("GenerateKeyPair(): expected non-empty keys")
+		}
+
+		return privateKey, publicKey
+	}
+
+	computeSharedKey := func(privateKey keys.Private, publicKey keys.Public) keys.Shared {
+		t.Helper()
+
+		privateKeyClone, publicKeyClone := privateKey.Clone(), publicKey.Clone()
+
+		sharedKey, err := crypto.ComputeSharedKey(privateKey, publicKey)
+		if err != nil {
+			t.Fatalf("ComputeSharedKey(): expected no error but got %v", err)
+		}
+
+		if !bytes.Equal(privateKey.Bytes, privateKeyClone.Bytes) || !bytes.Equal(publicKey.Bytes, publicKeyClone.Bytes) {
+			t.Fatal("ComputeSharedKey(): passed keys are changed")
+		}
+
+		if len(sharedKey.Bytes) == 0 {
+			t.Fatal("ComputeSharedKey(): expected non-empty shared key")
+		}
+
+		return sharedKey
+	}
+
+	alicePrivateKey, alicePublicKey := generateKeyPair()
+	bobPrivateKey, bobPublicKey := generateKeyPair()
+	evePrivateKey, _ := generateKeyPair()
+
+	if bytes.Equal(alicePrivateKey.Bytes, bobPrivateKey.Bytes) || bytes.Equal(alicePublicKey.Bytes, bobPublicKey.Bytes) {
+		t.Fatal("GenerateKeyPair(): expected different key pairs")
+	}
+
+	aliceSharedKey := computeSharedKey(alicePrivateKey, bobPublicKey)
+	bobSharedKey := computeSharedKey(bobPrivateKey, alicePublicKey)
+	eveSharedKey := computeSharedKey(evePrivateKey, bobPublicKey)
+
+	if !bytes.Equal(aliceSharedKey.Bytes, bobSharedKey.Bytes) {
+		t.Fatal("ComputeSharedKey(): expected the same shared key for both participants")
+	}
+
+	if bytes.Equal(aliceSharedKey.Bytes, eveSharedKey.Bytes) {
+		t.Fatal("ComputeSharedKey(): expected different shared keys for different key pairs")
+	}
+}
+
+func testRootCrypto(t *testing.T, crypto rootchain.Crypto) {
+	type output struct {
+		rootKey       keys.Root
+		masterKey     keys.MessageMaster
+		nextHeaderKey keys.Header
+	}
+
+	advance := func(rootKey keys.Root, sharedKey keys.Shared) output {
+		t.Helper()
+
+		rootKeyClone, sharedKeyBytes := rootKey.Clone(), bytes.Clone(sharedKey.Bytes)
+
+		newRootKey, masterKey, nextHeaderKey, err := crypto.AdvanceChain(rootKey, sharedKey)
+		if err != nil {
+			t.Fatalf("AdvanceChain(): expected no error but got %v", err)
+		}
+
+		if !bytes.Equal(rootKey.Bytes, rootKeyClone.Bytes) || !bytes.Equal(sharedKey.Bytes, sharedKeyBytes) {
+			t.Fatal("AdvanceChain(): passed keys are changed")
+		}
+
+		return output{newRootKey, masterKey, nextHeaderKey}
+	}
+
+	rootKey, sharedKey := keys.Root{Bytes: newBytes(1)}, keys.Shared{Bytes: newBytes(2)}
+
+	first := advance(rootKey, sharedKey)
+	if second := advance(rootKey, sharedKey); !reflect.DeepEqual(first, second) {
+		t.Fatal("AdvanceChain(): expected the same keys for the same input")
+	}
+
+	outputKeys := [][]byte{rootKey.Bytes, first.rootKey.Bytes, first.masterKey.Bytes, first.nextHeaderKey.Bytes}
+	checkIndependentKeys(t, "AdvanceChain()", outputKeys...)
+
+	// Note that output keys must not share memory, because they are wiped separately.
+	masterKey, nextHeaderKey := first.masterKey.Clone(), first.nextHeaderKey.Clone()
+	clear(first.rootKey.Bytes)
+
+	if !bytes.Equal(first.masterKey.Bytes, masterKey.Bytes) ||
+		!bytes.Equal(first.nextHeaderKey.Bytes, nextHeaderKey.Bytes) {
+		t.Fatal("AdvanceChain(): output keys share memory")
+	}
+
+	otherSharedKey := advance(rootKey, keys.Shared{Bytes: newBytes(3)})
+	otherRootKey := advance(keys.Root{Bytes: newBytes(3)}, sharedKey)
+
+	if bytes.Equal(otherSharedKey.masterKey.Bytes, first.masterKey.Bytes) ||
+		bytes.Equal(otherRootKey.masterKey.Bytes, first.masterKey.Bytes) {
+		t.Fatal("AdvanceChain(): expected different keys for different input")
+	}
+}
+
+func testAdvanceChain(t *testing.T, sending sendingchain.Crypto, receiving receivingchain.Crypto) {
+	masterKey := keys.MessageMaster{Bytes: newBytes(1)}
+
+	sendingMasterKey, sendingMessageKey, err := sending.AdvanceChain(masterKey)
+	if err != nil {
+		t.Fatalf("AdvanceChain(): expected no error but got %v", err)
+	}
+
+	receivingMasterKey, receivingMessageKey, err := receiving.AdvanceChain(masterKey)
+	if err != nil {
+		t.Fatalf("AdvanceChain(): expected no error but got %v", err)
+	}
+
+	if !bytes.Equal(masterKey.Bytes, newBytes(1)) {
+		t.Fatal("AdvanceChain(): passed master key is changed")
+	}
+
+	if !bytes.Equal(sendingMasterKey.Bytes, receivingMasterKey.Bytes) ||
+		!bytes.Equal(sendingMessageKey.Bytes, receivingMessageKey.Bytes) {
+		t.Fatal("AdvanceChain(): expected the same keys for sending and receiving chains")
+	}
+
+	_, nextMessageKey, err := sending.AdvanceChain(sendingMasterKey)
+	if err != nil {
+		t.Fatalf("AdvanceChain(): expected no error but got %v", err)
+	}
+
+	checkIndependentKeys(
+		t, "AdvanceChain()", masterKey.Bytes, sendingMasterKey.Bytes, sendingMessageKey.Bytes, nextMessageKey.Bytes)
+}
+
+func testHeader(t *testing.T, sending sendingchain.Crypto, receiving receivingchain.Crypto) {
+	key := keys.Header{Bytes: newBytes(1)}
+	hdr := header.Header{
+		PublicKey:                         keys.Public{Bytes: newBytes(2)},
+		PreviousSendingChainMessagesCount: 3,
+		MessageNumber:                     4,
+	}
+
+	encrypt := func(hdr header.Header) []byte {
+		t.Helper()
+
+		encryptedHeader, err := sending.EncryptHeader(key, hdr)
+		if err != nil {
+			t.Fatalf("EncryptHeader(): expected no error but got %v", err)
+		}
+
+		return encryptedHeader
+	}
+
+	encryptedHeader := encrypt(hdr)
+
+	decryptedHeader, err := receiving.DecryptHeader(key, encryptedHeader)
+	if err != nil {
+		t.Fatalf("DecryptHeader(): expected no error but got %v", err)
+	}
+
+	if !reflect.DeepEqual(decryptedHeader, hdr) {
+		t.Fatalf("DecryptHeader(): expected %+v but got %+v", hdr, decryptedHeader)
+	}
+
+	// Note that the header key encrypts many headers, so the encryption must be randomized.
+	if bytes.Equal(encrypt(hdr), encryptedHeader) {
+		t.Fatal("EncryptHeader(): expected different encrypted headers for the same header")
+	}
+
+	otherHeader := hdr
+	otherHeader.MessageNumber = 1 << 40
+
+	if len(encrypt(otherHeader)) != len(encryptedHeader) {
+		t.Fatal("EncryptHeader(): expected encrypted header length to not depend on numbers")
+	}
+
+	for _, forged := range forge(encryptedHeader) {
+		if _, err := receiving.DecryptHeader(key, forged); err == nil {
+			t.Fatal("DecryptHeader(): expected error for forged header")
+		}
+	}
+
+	if _, err := receiving.DecryptHeader(keys.Header{Bytes: newBytes(2)}, encryptedHeader); err == nil {
+		t.Fatal("DecryptHeader(): expected error for wrong key")
+	}
+}
+
+func testMessage(t *testing.T, sending sendingchain.Crypto, receiving receivingchain.Crypto) {
+	key := keys.Message{Bytes: newBytes(1)}
+	auth := []byte("auth")
+
+	for _, dataLen := range []int{0, 1, 100} {
+		data := bytes.Repeat([]byte{2}, dataLen)
+
+		encryptedData, err := sending.EncryptMessage(key, data, auth)
+		if err != nil {
+			t.Fatalf("EncryptMessage(%d): expected no error but got %v", dataLen, err)
+		}
+
+		if len(encryptedData) <= len(data) {
+			t.Fatalf("EncryptMessage(%d): expected authenticated data longer than data but got %d", dataLen, len(encryptedData))
+		}
+
+		otherEncryptedData, err := sending.EncryptMessage(key, bytes.Repeat([]byte{3}, dataLen), auth)
+		if err != nil {
+			t.Fatalf("EncryptMessage(%d): expected no error but got %v", dataLen, err)
+		}
+
+		if len(otherEncryptedData) != len(encryptedData) {
+			t.Fatalf("EncryptMessage(%d): expected encrypted data length to depend only on data length", dataLen)
+		}
+
+		decryptedData, err := receiving.DecryptMessage(key, encryptedData, auth)
+		if err != nil {
+			t.Fatalf("DecryptMessage(%d): expected no error but got %v", dataLen, err)
+		}
+
+		if !bytes.Equal(decryptedData, data) {
+			t.Fatalf("DecryptMessage(%d): expected %v but got %v", dataLen, data, decryptedData)
+		}
+
+		for _, forged := range forge(encryptedData) {
+			if _, err := receiving.DecryptMessage(key, forged, auth); err == nil {
+				t.Fatalf("DecryptMessage(%d): expected error for forged data", dataLen)
+			}
+		}
+
+		if _, err := receiving.DecryptMessage(key, encryptedData, []byte("forged")); err == nil {
+			t.Fatalf("DecryptMessage(%d): expected error for forged auth", dataLen)
+		}
+
+		if _, err := receiving.DecryptMessage(keys.Message{Bytes: newBytes(2)}, encryptedData, auth); err == nil {
+			t.Fatalf("DecryptMessage(%d): expected error for wrong key", dataLen)
+		}
+	}
+}
+
+// testAppend checks optional append interfaces, which must keep the passed buffer prefix.
+func testAppend(t *testing.T, sending sendingchain.Crypto, receiving receivingchain.Crypto) {
+	prefix := []byte{9, 9, 9}
+	headerKey, messageKey := keys.Header{Bytes: newBytes(1)}, keys.Message{Bytes: newBytes(2)}
+	data, auth := []byte{1, 2, 3}, []byte("auth")
+
+	encryptedData, err := sending.EncryptMessage(messageKey, data, auth)
+	if err != nil {
+		t.Fatalf("EncryptMessage(): expected no error but got %v", err)
+	}
+
+	if crypto, ok := sending.(sendingchain.AppendCrypto); ok {
+		hdr := header.Header{PublicKey: keys.Public{Bytes: newBytes(3)}, MessageNumber: 1}
+
+		encryptedHeader, err := crypto.AppendEncryptedHeader(bytes.Clone(prefix), headerKey, hdr)
+		if err != nil || !bytes.HasPrefix(encryptedHeader, prefix) {
+			t.Fatalf("AppendEncryptedHeader(): expected buffer with prefix but got %v", err)
+		}
+
+		if _, err := receiving.DecryptHeader(headerKey, encryptedHeader[len(prefix):]); err != nil {
+			t.Fatalf("DecryptHeader(): expected no error for appended header but got %v", err)
+		}
+
+		encryptedData, err = crypto.AppendEncryptedMessage(bytes.Clone(prefix), messageKey, data, auth)
+		if err != nil || !bytes.HasPrefix(encryptedData, prefix) {
+			t.Fatalf("AppendEncryptedMessage(): expected buffer with prefix but got %v", err)
+		}
+
+		encryptedData = encryptedData[len(prefix):]
+	}
+
+	if crypto, ok := receiving.(receivingchain.AppendCrypto); ok {
+		decryptedData, err := crypto.AppendDecryptedMessage(bytes.Clone(prefix), messageKey, encryptedData, auth)
+		if err != nil {
+			t.Fatalf("AppendDecryptedMessage(): expected no error but got %v", err)
+		}
+
+		if !bytes.Equal(decryptedData, append(bytes.Clone(prefix), data...)) {
+			t.Fatalf("AppendDecryptedMessage(): expected %v but got %v", append(bytes.Clone(prefix), data...), decryptedData)
+		}
+	}
+}
+
+func testConversation(t *testing.T, cryptos Cryptos) {
+	var options []ratchet.Option
+
+	if cryptos.Ratchet != nil {
+		options = append(options, ratchet.WithCrypto(cryptos.Ratchet))
+	}
+
+	if cryptos.Root != nil {
+		options = append(options, ratchet.WithRootChainOptions(rootchain.WithCrypto(cryptos.Root)))
+	}
+
+	if cryptos.Sending != nil {
+		options = append(
+			options,
+			ratchet.WithSendingChainOptions(sendingchain.WithCrypto(cryptos.Sending)),
+			ratchet.WithReceivingChainOptions(receivingchain.WithCrypto(cryptos.Receiving)),
+		)
+	}
+
+	sender, recipient := ratchettest.NewConversation(t, options...)
+
+	cfg := ratchettest.Config{
+		Seed:          1,
+		MessagesCount: 200,
+		MaxDelay:      4,
+		DropRate:      0.05,
+		DuplicateRate: 0.05,
+		CorruptRate:   0.05,
+	}
+
+	ratchettest.Run(t, cfg, ratchettest.Conversation{sender, recipient})
+}
+
+// checkIndependentKeys checks that all keys are non-empty and different.
+func checkIndependentKeys(t *testing.T, function string, keys ...[]byte) {
+	t.Helper()
+
+	for i, key := range keys {
+		if len(key) == 0 {
+			t.Fatalf("%s: expected non-empty key %d", function, i)
+		}
+
+		for _, other := range keys[:i] {
+			if bytes.Equal(key, other) {
+				t.Fatalf("%s: expected independent keys but key %d repeats", function, i)
+			}
+		}
+	}
+}
+
+// forge returns copies of encrypted bytes with a flipped bit at the start, the middle and the end, and a truncated
+// copy.
+func forge(encrypted []byte) [][]byte {
+	forged := make([][]byte, 0, 4)
+
+	for _, i := range []int{0, len(encrypted) / 2, len(encrypted) - 1} {
+		flipped := bytes.Clone(encrypted)
+		flipped[i] ^= 1
+
+		forged = append(forged, flipped)
+	}
+
+	return append(forged, encrypted[:len(encrypted)-1])
+}
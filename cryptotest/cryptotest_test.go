@@ -0,0 +1,153 @@
+package cryptotest
+
+import (
+	"crypto/ecdh"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/hkdf"
+
+	"github.com/platform-inf/go-ratchet/header"
+	"github.com/platform-inf/go-ratchet/keys"
+)
+
+type customRatchetCrypto struct{}
+
+func (c customRatchetCrypto) ComputeSharedKey(privateKey keys.Private, publicKey keys.Public) (keys.Shared, error) {
+	foreignPrivateKey, err := ecdh.X25519().NewPrivateKey(privateKey.Bytes)
+	if err != nil {
+		return keys.Shared{}, err
+	}
+
+	foreignPublicKey, err := ecdh.X25519().NewPublicKey(publicKey.Bytes)
+	if err != nil {
+		return keys.Shared{}, err
+	}
+
+	sharedKeyBytes, err := foreignPrivateKey.ECDH(foreignPublicKey)
+	if err != nil {
+		return keys.Shared{}, err
+	}
+
+	return keys.Shared{Bytes: sharedKeyBytes}, nil
+}
+
+func (c customRatchetCrypto) GenerateKeyPair() (keys.Private, keys.Public, error) {
+	foreignPrivateKey, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return keys.Private{}, keys.Public{}, err
+	}
+
+	return keys.Private{Bytes: foreignPrivateKey.Bytes()}, keys.Public{Bytes: foreignPrivateKey.PublicKey().Bytes()}, nil
+}
+
+type customRootCrypto struct{}
+
+func (c customRootCrypto) AdvanceChain(
+	rootKey keys.Root,
+	sharedKey keys.Shared,
+) (keys.Root, keys.MessageMaster, keys.Header, error) {
+	output := make([]byte, 3*keyLen)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, sharedKey.Bytes, rootKey.Bytes, nil), output); err != nil {
+		return keys.Root{}, keys.MessageMaster{}, keys.Header{}, err
+	}
+
+	return keys.Root{Bytes: output[:keyLen]},
+		keys.MessageMaster{Bytes: output[keyLen : 2*keyLen]},
+		keys.Header{Bytes: output[2*keyLen:]},
+		nil
+}
+
+// customChainCrypto implements both sending and receiving chain cryptos.
+type customChainCrypto struct{}
+
+func (c customChainCrypto) AdvanceChain(masterKey keys.MessageMaster) (keys.MessageMaster, keys.Message, error) {
+	mac := hmac.New(sha256.New, masterKey.Bytes)
+	mac.Write([]byte{1})
+	newMasterKey := mac.Sum(nil)
+
+	mac.Reset()
+	mac.Write([]byte{2})
+
+	return keys.MessageMaster{Bytes: newMasterKey}, keys.Message{Bytes: mac.Sum(nil)}, nil
+}
+
+func (c customChainCrypto) DecryptHeader(key keys.Header, encryptedHeader []byte) (header.Header, error) {
+	aead, err := chacha20poly1305.NewX(key.Bytes)
+	if err != nil {
+		return header.Header{}, err
+	}
+
+	if len(encryptedHeader) < aead.NonceSize() {
+		return header.Header{}, errors.New("too short")
+	}
+
+	nonce, ciphertext := encryptedHeader[:aead.NonceSize()], encryptedHeader[aead.NonceSize():]
+
+	encodedHeader, err := aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return header.Header{}, err
+	}
+
+	return header.Decode(encodedHeader)
+}
+
+func (c customChainCrypto) DecryptMessage(key keys.Message, encryptedData, auth []byte) ([]byte, error) {
+	aead, err := chacha20poly1305.New(key.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	// Note that message keys are used once, so the zero nonce is fine.
+	return aead.Open(nil, make([]byte, aead.NonceSize()), encryptedData, auth)
+}
+
+func (c customChainCrypto) EncryptHeader(key keys.Header, hdr header.Header) ([]byte, error) {
+	aead, err := chacha20poly1305.NewX(key.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("read nonce: %w", err)
+	}
+
+	return aead.Seal(nonce, nonce, hdr.Encode(), nil), nil
+}
+
+func (c customChainCrypto) EncryptMessage(key keys.Message, data, auth []byte) ([]byte, error) {
+	aead, err := chacha20poly1305.New(key.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	return aead.Seal(nil, make([]byte, aead.NonceSize()), data, auth), nil
+}
+
+func TestRun(t *testing.T) {
+	t.Parallel()
+
+	t.Run("custom cryptos", func(t *testing.T) {
+		t.Parallel()
+
+		Run(t, Cryptos{
+			Ratchet:   customRatchetCrypto{},
+			Root:      customRootCrypto{},
+			Sending:   customChainCrypto{},
+			Receiving: customChainCrypto{},
+		})
+	})
+
+	t.Run("default cryptos", func(t *testing.T) {
+		t.Parallel()
+
+		Run(t, Cryptos{})
+	})
+}
@@ -0,0 +1,30 @@
+package ratchet
+
+import (
+	"errors"
+
+	"github.com/platform-inf/go-ratchet/errlist"
+	"github.com/platform-inf/go-ratchet/receivingchain"
+)
+
+// wrapDecryptError makes sure that decryption errors are of type *receivingchain.DecryptError, including errors of
+// the transaction commit, which happen outside of the receiving chain.
+func wrapDecryptError(err error) error {
+	var decryptErr *receivingchain.DecryptError
+	if errors.As(err, &decryptErr) {
+		return err
+	}
+
+	reason := receivingchain.DecryptReasonUnknown
+	if errors.Is(err, errlist.ErrSkippedKeysStorage) {
+		reason = receivingchain.DecryptReasonSkippedKeysStorage
+	}
+
+	return &receivingchain.DecryptError{Reason: reason, Err: err}
+}
+
+// isForgedMessageError reports whether the message is not authenticated, although its header is decrypted.
+func isForgedMessageError(err error) bool {
+	var decryptErr *receivingchain.DecryptError
+	return errors.As(err, &decryptErr) && decryptErr.Reason == receivingchain.DecryptReasonForgedMessage
+}
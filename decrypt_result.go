@@ -0,0 +1,44 @@
+package ratchet
+
+import (
+	"slices"
+
+	"github.com/platform-inf/go-ratchet/header"
+)
+
+// DecryptResult describes the decrypted message, so applications can order messages and show gaps.
+type DecryptResult struct {
+	Data []byte
+	// Metadata is attached by EncryptWithMetadata or nil.
+	Metadata      []byte
+	MessageNumber uint64
+	// ReceivingEpoch is the number of the receiving chain, which the message belongs to, starting from 1. Messages are
+	// ordered by the receiving epoch and then by the message number. Note that it is zero for messages decrypted with
+	// skipped keys of too old chains and it differs from Stats.Epoch, which counts steps of both directions.
+	ReceivingEpoch uint64
+	// FromSkippedKey reports whether the message is decrypted with a skipped key, i.e. it arrived out of order.
+	FromSkippedKey bool
+	// DHRatchet reports whether the message triggered the Diffie-Hellman ratchet step.
+	DHRatchet bool
+}
+
+// DecryptWithInfo is like Decrypt, but also describes the decrypted message.
+func (r *Ratchet) DecryptWithInfo(encryptedHeader, encryptedData, auth []byte) (DecryptResult, error) {
+	data, info, err := r.decryptTo(nil, encryptedHeader, encryptedData, auth)
+	if err != nil {
+		return DecryptResult{}, err
+	}
+
+	metadata, _ := info.Header.Extension(header.ExtensionTypeApplication)
+
+	result := DecryptResult{
+		Data:           data,
+		Metadata:       slices.Clone(metadata),
+		MessageNumber:  info.Header.MessageNumber,
+		ReceivingEpoch: info.Epoch,
+		FromSkippedKey: info.SkippedKey,
+		DHRatchet:      info.Ratchet,
+	}
+
+	return result, nil
+}
@@ -4,6 +4,7 @@ import "errors"
 
 var (
 	ErrCrypto             = errors.New("crypto")
+	ErrDuplicateMessage   = errors.New("duplicate message")
 	ErrInvalidValue       = errors.New("invalid value")
 	ErrOption             = errors.New("option")
 	ErrSkippedKeysStorage = errors.New("skipped keys storage")
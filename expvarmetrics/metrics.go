@@ -0,0 +1,130 @@
+// Package expvarmetrics exports ratchet metrics with the standard expvar package.
+//
+// Counters without labels are exported as integers, counters with labels as maps of integers by labels and durations as
+// histograms with count, sum and cumulative buckets.
+package expvarmetrics
+
+import (
+	"expvar"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// histogramBounds are upper bounds of histogram buckets. Note that there is one more bucket without upper bound.
+var histogramBounds = [...]time.Duration{
+	time.Microsecond,
+	10 * time.Microsecond,
+	100 * time.Microsecond,
+	time.Millisecond,
+	10 * time.Millisecond,
+	100 * time.Millisecond,
+	time.Second,
+}
+
+// Metrics implements ratchet.Metrics with expvar variables.
+type Metrics struct {
+	mu   sync.Mutex
+	vars *expvar.Map
+}
+
+// New creates metrics, which store variables in passed map. Publish the map with expvar.NewMap or expvar.Publish.
+func New(vars *expvar.Map) *Metrics {
+	return &Metrics{vars: vars}
+}
+
+func (m *Metrics) AddCounter(name, label string, delta uint64) {
+	if label == "" {
+		m.vars.Add(name, int64(delta))
+		return
+	}
+
+	labels, ok := m.vars.Get(name).(*expvar.Map)
+	if !ok {
+		labels = m.getOrCreate(name, func() expvar.Var { return new(expvar.Map) }).(*expvar.Map)
+	}
+
+	labels.Add(label, int64(delta))
+}
+
+func (m *Metrics) ObserveDuration(name string, duration time.Duration) {
+	hist, ok := m.vars.Get(name).(*histogram)
+	if !ok {
+		hist = m.getOrCreate(name, func() expvar.Var { return new(histogram) }).(*histogram)
+	}
+
+	hist.observe(duration)
+}
+
+// getOrCreate returns variable by name and creates it if it does not exist.
+func (m *Metrics) getOrCreate(name string, create func() expvar.Var) expvar.Var {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if v := m.vars.Get(name); v != nil {
+		return v
+	}
+
+	v := create()
+	m.vars.Set(name, v)
+
+	return v
+}
+
+type histogram struct {
+	count   atomic.Uint64
+	sum     atomic.Int64
+	buckets [len(histogramBounds) + 1]atomic.Uint64
+}
+
+func (h *histogram) observe(duration time.Duration) {
+	h.count.Add(1)
+	h.sum.Add(int64(duration))
+
+	bucket := len(histogramBounds)
+
+	for i, bound := range histogramBounds {
+		if duration <= bound {
+			bucket = i
+			break
+		}
+	}
+
+	h.buckets[bucket].Add(1)
+}
+
+// String returns the histogram in JSON. Note that buckets are cumulative like in Prometheus.
+func (h *histogram) String() string {
+	var builder strings.Builder
+
+	builder.WriteString(`{"count": `)
+	builder.WriteString(strconv.FormatUint(h.count.Load(), 10))
+	builder.WriteString(`, "sum_ns": `)
+	builder.WriteString(strconv.FormatInt(h.sum.Load(), 10))
+	builder.WriteString(`, "buckets": {`)
+
+	var cumulativeCount uint64
+
+	for i := range h.buckets {
+		cumulativeCount += h.buckets[i].Load()
+
+		bound := "+Inf"
+		if i < len(histogramBounds) {
+			bound = histogramBounds[i].String()
+		}
+
+		if i > 0 {
+			builder.WriteString(", ")
+		}
+
+		builder.WriteString(strconv.Quote("le_" + bound))
+		builder.WriteString(": ")
+		builder.WriteString(strconv.FormatUint(cumulativeCount, 10))
+	}
+
+	builder.WriteString("}}")
+
+	return builder.String()
+}
@@ -0,0 +1,64 @@
+package expvarmetrics
+
+import (
+	"encoding/json"
+	"expvar"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/platform-inf/go-ratchet"
+)
+
+var _ ratchet.Metrics = (*Metrics)(nil)
+
+func TestMetrics(t *testing.T) {
+	t.Parallel()
+
+	metrics := New(new(expvar.Map))
+
+	var wg sync.WaitGroup
+
+	for range 10 {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			metrics.AddCounter(ratchet.MetricMessagesEncrypted, "", 2)
+			metrics.AddCounter(ratchet.MetricDecryptFailures, "crypto", 1)
+			metrics.ObserveDuration(ratchet.MetricEncryptDuration, 50*time.Microsecond)
+		}()
+	}
+
+	wg.Wait()
+
+	metrics.ObserveDuration(ratchet.MetricEncryptDuration, 2*time.Second)
+
+	var decoded struct {
+		MessagesEncrypted int            `json:"messages_encrypted"`
+		DecryptFailures   map[string]int `json:"decrypt_failures"`
+		EncryptDuration   struct {
+			Count   int            `json:"count"`
+			SumNs   int64          `json:"sum_ns"`
+			Buckets map[string]int `json:"buckets"`
+		} `json:"encrypt_duration"`
+	}
+
+	if err := json.Unmarshal([]byte(metrics.vars.String()), &decoded); err != nil {
+		t.Fatalf("String(): expected JSON but got error %v: %s", err, metrics.vars.String())
+	}
+
+	if decoded.MessagesEncrypted != 20 || decoded.DecryptFailures["crypto"] != 10 {
+		t.Fatalf("AddCounter(): invalid counters: %+v", decoded)
+	}
+
+	histogram := decoded.EncryptDuration
+	if histogram.Count != 11 || histogram.SumNs != int64(10*50*time.Microsecond+2*time.Second) {
+		t.Fatalf("ObserveDuration(): invalid count or sum: %+v", histogram)
+	}
+
+	if histogram.Buckets["le_10µs"] != 0 || histogram.Buckets["le_100µs"] != 10 || histogram.Buckets["le_+Inf"] != 11 {
+		t.Fatalf("ObserveDuration(): invalid buckets: %+v", histogram.Buckets)
+	}
+}
@@ -0,0 +1,46 @@
+package ratchet
+
+import (
+	"fmt"
+	"log/slog"
+)
+
+// Format prints the epoch, message numbers of the chains and fingerprints of the public keys.
+func (r Ratchet) Format(state fmt.State, verb rune) {
+	if verb == 'v' && state.Flag('#') {
+		_, _ = state.Write([]byte(r.GoString()))
+		return
+	}
+
+	_, _ = state.Write([]byte(r.String()))
+}
+
+func (r Ratchet) GoString() string {
+	return "ratchet." + r.String()
+}
+
+func (r Ratchet) LogValue() slog.Value {
+	var remotePublicKeyFingerprint string
+	if r.remotePublicKey != nil {
+		remotePublicKeyFingerprint = r.remotePublicKey.Fingerprint()
+	}
+
+	return slog.GroupValue(
+		slog.Uint64("epoch", r.rootChain.Epoch()),
+		slog.Uint64("sending_chain_next_message_number", r.sendingChain.NextMessageNumber()),
+		slog.Uint64("receiving_chain_next_message_number", r.receivingChain.NextMessageNumber()),
+		slog.String("local_public_key", r.localPublicKey.Fingerprint()),
+		slog.String("remote_public_key", remotePublicKeyFingerprint),
+	)
+}
+
+func (r Ratchet) String() string {
+	return fmt.Sprintf(
+		"Ratchet{epoch: %d, sending chain: %v, receiving chain: %v, local public key: %v, remote public key: %v}",
+		r.rootChain.Epoch(),
+		r.sendingChain,
+		r.receivingChain,
+		r.localPublicKey,
+		r.remotePublicKey,
+	)
+}
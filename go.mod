@@ -5,6 +5,5 @@ go 1.23.4
 require (
 	github.com/platform-inf/go-utils v0.1.2
 	golang.org/x/crypto v0.36.0
+	golang.org/x/sys v0.31.0
 )
-
-require golang.org/x/sys v0.31.0 // indirect
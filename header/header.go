@@ -1,41 +1,253 @@
 package header
 
 import (
+	"cmp"
 	"encoding/binary"
+	"errors"
 	"fmt"
+	"slices"
 
 	"github.com/platform-inf/go-ratchet/errlist"
 	"github.com/platform-inf/go-ratchet/keys"
 	"github.com/platform-inf/go-utils"
 )
 
+// Version is the version of the header encoding, which is the first byte of encoded header.
+const Version = 1
+
+// Header is encoded as the version byte, the message number, the previous sending chain messages count, the public key
+// with its length and extensions.
 type Header struct {
 	PublicKey                         keys.Public
 	PreviousSendingChainMessagesCount uint64
 	MessageNumber                     uint64
+	// Extensions are optional fields, which are encoded sorted by type. If types repeat, only the last extension of the
+	// type is encoded. Note that extensions of unknown types are decoded too, so newer participants may add fields
+	// without breaking older ones.
+	Extensions []Extension
+}
+
+// ExtensionType identifies the extension. Types are assigned by the library, see ExtensionTypeApplication for
+// application fields.
+type ExtensionType uint64
+
+const (
+	// ExtensionTypeApplication is the type of application metadata, which is encrypted together with the header.
+	ExtensionTypeApplication ExtensionType = 1
+	// ExtensionTypeNextPublicKey is the type of the next public key of the sender, which the recipient should use for
+	// its next Diffie-Hellman ratchet step.
+	ExtensionTypeNextPublicKey ExtensionType = 2
+)
+
+// Extension is encoded as type-length-value.
+type Extension struct {
+	Type  ExtensionType
+	Value []byte
 }
 
+// paddingStartByte marks the start of ISO/IEC 7816-4 padding, which is followed by zero bytes.
+const paddingStartByte = 0x80
+
+// fixedLen is the length of the version and the numbers.
+const fixedLen = 1 + 2*utils.Uint64Size
+
+// Decode decodes the header. Note that the public key and the extension values refer to the passed bytes.
 func Decode(bytes []byte) (Header, error) {
-	if len(bytes) < 2*utils.Uint64Size {
+	if len(bytes) < fixedLen {
 		return Header{}, fmt.Errorf("%w: not enough bytes", errlist.ErrInvalidValue)
 	}
 
+	if bytes[0] != Version {
+		return Header{}, fmt.Errorf("%w: unsupported version %d", errlist.ErrInvalidValue, bytes[0])
+	}
+
 	header := Header{}
-	header.MessageNumber = binary.LittleEndian.Uint64(bytes[:utils.Uint64Size])
-	header.PreviousSendingChainMessagesCount = binary.LittleEndian.Uint64(bytes[utils.Uint64Size : 2*utils.Uint64Size])
+	header.MessageNumber = binary.LittleEndian.Uint64(bytes[1 : 1+utils.Uint64Size])
+	header.PreviousSendingChainMessagesCount = binary.LittleEndian.Uint64(bytes[1+utils.Uint64Size : fixedLen])
 
-	if len(bytes) > 2*utils.Uint64Size {
-		header.PublicKey = keys.Public{Bytes: bytes[2*utils.Uint64Size:]}
+	publicKey, rest, err := decodeBytes(bytes[fixedLen:])
+	if err != nil {
+		return Header{}, fmt.Errorf("%w: public key: %w", errlist.ErrInvalidValue, err)
+	}
+
+	if len(publicKey) > 0 {
+		header.PublicKey = keys.Public{Bytes: publicKey}
+	}
+
+	for len(rest) > 0 {
+		extensionType, n := binary.Uvarint(rest)
+		if n <= 0 {
+			return Header{}, fmt.Errorf("%w: invalid extension type", errlist.ErrInvalidValue)
+		}
+
+		if len(header.Extensions) > 0 && ExtensionType(extensionType) <= header.Extensions[len(header.Extensions)-1].Type {
+			return Header{}, fmt.Errorf("%w: extension %d is not sorted or repeats", errlist.ErrInvalidValue, extensionType)
+		}
+
+		var value []byte
+
+		value, rest, err = decodeBytes(rest[n:])
+		if err != nil {
+			return Header{}, fmt.Errorf("%w: extension %d: %w", errlist.ErrInvalidValue, extensionType, err)
+		}
+
+		header.Extensions = append(header.Extensions, Extension{Type: ExtensionType(extensionType), Value: value})
 	}
 
 	return header, nil
 }
 
+// DecodePadded strips padding added by AppendPadded with the same block size and decodes the header. Note that padding
+// is checked strictly: the length must be a multiple of the block size and the padding must take at most one block.
+func DecodePadded(bytes []byte, blockSize int) (Header, error) {
+	if blockSize <= 0 {
+		return Header{}, fmt.Errorf("%w: non-positive block size %d", errlist.ErrInvalidValue, blockSize)
+	}
+
+	if len(bytes) == 0 || len(bytes)%blockSize != 0 {
+		return Header{}, fmt.Errorf(
+			"%w: length %d is not a multiple of block size %d", errlist.ErrInvalidValue, len(bytes), blockSize)
+	}
+
+	paddingStart := len(bytes) - 1
+	for paddingStart > len(bytes)-blockSize && bytes[paddingStart] == 0 {
+		paddingStart--
+	}
+
+	if bytes[paddingStart] != paddingStartByte {
+		return Header{}, fmt.Errorf("%w: invalid padding", errlist.ErrInvalidValue)
+	}
+
+	return Decode(bytes[:paddingStart])
+}
+
+// Append appends encoded header to dst and returns the extended buffer.
+func (h Header) Append(dst []byte) []byte {
+	dst = append(dst, Version)
+	dst = binary.LittleEndian.AppendUint64(dst, h.MessageNumber)
+	dst = binary.LittleEndian.AppendUint64(dst, h.PreviousSendingChainMessagesCount)
+	dst = appendBytes(dst, h.PublicKey.Bytes)
+
+	for _, extension := range h.sortedExtensions() {
+		dst = binary.AppendUvarint(dst, uint64(extension.Type))
+		dst = appendBytes(dst, extension.Value)
+	}
+
+	return dst
+}
+
+// AppendPadded appends encoded header padded with ISO/IEC 7816-4 scheme to a multiple of blockSize and returns the
+// extended buffer. Note that at least one byte of padding is always added. Panics if blockSize is not positive.
+func (h Header) AppendPadded(dst []byte, blockSize int) []byte {
+	paddedLen := h.PaddedLen(blockSize)
+
+	dst = h.Append(dst)
+	dst = append(dst, paddingStartByte)
+
+	return append(dst, make([]byte, paddedLen-h.EncodedLen()-1)...)
+}
+
 func (h Header) Encode() []byte {
-	var messageNumberBytes, previousMessagesCountBytes [utils.Uint64Size]byte
+	return h.Append(make([]byte, 0, h.EncodedLen()))
+}
+
+// EncodedLen returns length of encoded header.
+func (h Header) EncodedLen() int {
+	encodedLen := fixedLen + bytesEncodedLen(h.PublicKey.Bytes)
+	for _, extension := range h.sortedExtensions() {
+		encodedLen += uvarintLen(uint64(extension.Type)) + bytesEncodedLen(extension.Value)
+	}
+
+	return encodedLen
+}
+
+// Clone deep clones the header, so it does not refer to decoded bytes.
+func (h Header) Clone() Header {
+	h.PublicKey = h.PublicKey.Clone()
+
+	if h.Extensions != nil {
+		extensions := make([]Extension, 0, len(h.Extensions))
+		for _, extension := range h.Extensions {
+			extensions = append(extensions, Extension{Type: extension.Type, Value: slices.Clone(extension.Value)})
+		}
+
+		h.Extensions = extensions
+	}
+
+	return h
+}
+
+// Extension returns the value of the extension by type. Like encoding, it prefers the last extension of the type.
+func (h Header) Extension(extensionType ExtensionType) ([]byte, bool) {
+	for _, extension := range slices.Backward(h.Extensions) {
+		if extension.Type == extensionType {
+			return extension.Value, true
+		}
+	}
+
+	return nil, false
+}
+
+// PaddedLen returns length of encoded header padded by AppendPadded. Panics if blockSize is not positive.
+func (h Header) PaddedLen(blockSize int) int {
+	return (h.EncodedLen()/blockSize + 1) * blockSize
+}
+
+// sortedExtensions returns extensions sorted by type, where only the last extension of each type is kept. Note that
+// extensions are copied only if they are not sorted already.
+func (h Header) sortedExtensions() []Extension {
+	sorted := slices.IsSortedFunc(h.Extensions, func(a, b Extension) int {
+		if a.Type == b.Type {
+			return 1
+		}
 
-	binary.LittleEndian.PutUint64(messageNumberBytes[:], h.MessageNumber)
-	binary.LittleEndian.PutUint64(previousMessagesCountBytes[:], h.PreviousSendingChainMessagesCount)
+		return cmp.Compare(a.Type, b.Type)
+	})
+	if sorted {
+		return h.Extensions
+	}
+
+	extensions := slices.Clone(h.Extensions)
+	slices.SortStableFunc(extensions, func(a, b Extension) int { return cmp.Compare(a.Type, b.Type) })
+
+	deduplicated := extensions[:0]
+	for i, extension := range extensions {
+		if i+1 < len(extensions) && extensions[i+1].Type == extension.Type {
+			continue
+		}
+
+		deduplicated = append(deduplicated, extension)
+	}
+
+	return deduplicated
+}
+
+// appendBytes appends bytes prefixed with their length.
+func appendBytes(dst, bytes []byte) []byte {
+	return append(binary.AppendUvarint(dst, uint64(len(bytes))), bytes...)
+}
+
+func bytesEncodedLen(bytes []byte) int {
+	return uvarintLen(uint64(len(bytes))) + len(bytes)
+}
+
+// decodeBytes decodes bytes prefixed with their length and returns the rest.
+func decodeBytes(encoded []byte) (bytes []byte, rest []byte, err error) {
+	bytesLen, n := binary.Uvarint(encoded)
+	if n <= 0 {
+		return nil, nil, errors.New("invalid length")
+	}
+
+	if bytesLen > uint64(len(encoded)-n) {
+		return nil, nil, fmt.Errorf("length %d is greater than the rest %d", bytesLen, len(encoded)-n)
+	}
+
+	end := n + int(bytesLen)
+
+	return encoded[n:end:end], encoded[end:], nil
+}
 
-	return utils.ConcatByteSlices(messageNumberBytes[:], previousMessagesCountBytes[:], h.PublicKey.Bytes)
+func uvarintLen(x uint64) int {
+	var buf [binary.MaxVarintLen64]byte
+	return binary.PutUvarint(buf[:], x)
 }
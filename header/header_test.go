@@ -26,17 +26,39 @@ func TestHeaderSuccessEncodeAndDecode(t *testing.T) {
 				MessageNumber:                     321,
 			},
 			[]byte{
+				0x01,
 				0x41, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
 				0x7b, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
-				0x01, 0x02, 0x03, 0x04, 0x05,
+				0x05, 0x01, 0x02, 0x03, 0x04, 0x05,
 			},
 		},
 		{
 			"zero header",
 			Header{},
 			[]byte{
+				0x01,
 				0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
 				0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+				0x00,
+			},
+		},
+		{
+			"header with extensions",
+			Header{
+				PublicKey:     keys.Public{Bytes: []byte{0x0A}},
+				MessageNumber: 2,
+				Extensions: []Extension{
+					{Type: ExtensionTypeApplication, Value: []byte{0x0B, 0x0C}},
+					{Type: 300, Value: []byte{}},
+				},
+			},
+			[]byte{
+				0x01,
+				0x02, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+				0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+				0x01, 0x0A,
+				0x01, 0x02, 0x0B, 0x0C,
+				0xAC, 0x02, 0x00,
 			},
 		},
 	}
@@ -50,6 +72,15 @@ func TestHeaderSuccessEncodeAndDecode(t *testing.T) {
 				t.Fatalf("%+v.Encode(): expected %v but got %v", test.header, test.bytes, bytes)
 			}
 
+			if test.header.EncodedLen() != len(test.bytes) {
+				t.Fatalf("%+v.EncodedLen(): expected %d but got %d", test.header, len(test.bytes), test.header.EncodedLen())
+			}
+
+			prefix := []byte{0xFF, 0xFE}
+			if appended := test.header.Append(prefix); !slices.Equal(appended, append(prefix, test.bytes...)) {
+				t.Fatalf("%+v.Append(%v): expected %v but got %v", test.header, prefix, test.bytes, appended)
+			}
+
 			header, err := Decode(bytes)
 			if err != nil {
 				t.Fatalf("Decode(%v): expected no error but got %v", bytes, err)
@@ -81,6 +112,42 @@ func TestHeaderDecode(t *testing.T) {
 			"invalid value: not enough bytes",
 		},
 		{"nil bytes slice", nil, errlist.ErrInvalidValue, "invalid value: not enough bytes"},
+		{
+			"unsupported version",
+			append([]byte{0x02}, make([]byte, 17)...),
+			errlist.ErrInvalidValue,
+			"invalid value: unsupported version 2",
+		},
+		{
+			"no public key length",
+			append([]byte{Version}, make([]byte, 16)...),
+			errlist.ErrInvalidValue,
+			"invalid value: public key: invalid length",
+		},
+		{
+			"truncated public key",
+			append(append([]byte{Version}, make([]byte, 16)...), 0x02, 0x01),
+			errlist.ErrInvalidValue,
+			"invalid value: public key: length 2 is greater than the rest 1",
+		},
+		{
+			"truncated extension",
+			append(append([]byte{Version}, make([]byte, 16)...), 0x00, 0x01, 0x03, 0x01),
+			errlist.ErrInvalidValue,
+			"invalid value: extension 1: length 3 is greater than the rest 1",
+		},
+		{
+			"unsorted extensions",
+			append(append([]byte{Version}, make([]byte, 16)...), 0x00, 0x02, 0x00, 0x01, 0x00),
+			errlist.ErrInvalidValue,
+			"invalid value: extension 1 is not sorted or repeats",
+		},
+		{
+			"repeated extension",
+			append(append([]byte{Version}, make([]byte, 16)...), 0x00, 0x01, 0x00, 0x01, 0x00),
+			errlist.ErrInvalidValue,
+			"invalid value: extension 1 is not sorted or repeats",
+		},
 	}
 
 	for _, test := range tests {
@@ -93,3 +160,158 @@ func TestHeaderDecode(t *testing.T) {
 		})
 	}
 }
+
+func TestHeaderPadding(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		header    Header
+		blockSize int
+		bytesLen  int
+	}{
+		{"zero header", Header{}, 16, 32},
+		{"short public key", Header{PublicKey: keys.Public{Bytes: []byte{1}}, MessageNumber: 3}, 64, 64},
+		{
+			"long public key",
+			Header{PublicKey: keys.Public{Bytes: make([]byte, 45)}, PreviousSendingChainMessagesCount: 5},
+			64,
+			64,
+		},
+		{"block size 1", Header{PublicKey: keys.Public{Bytes: []byte{1, 2, 3}}}, 1, 22},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			bytes := test.header.AppendPadded(nil, test.blockSize)
+			if len(bytes) != test.bytesLen || test.header.PaddedLen(test.blockSize) != test.bytesLen {
+				t.Fatalf(
+					"%+v.AppendPadded(%d): expected length %d but got %d", test.header, test.blockSize, test.bytesLen, len(bytes))
+			}
+
+			header, err := DecodePadded(bytes, test.blockSize)
+			if err != nil {
+				t.Fatalf("DecodePadded(%v, %d): expected no error but got %v", bytes, test.blockSize, err)
+			}
+
+			if !reflect.DeepEqual(header, test.header) {
+				t.Fatalf("DecodePadded(%v, %d): expected %+v but got %+v", bytes, test.blockSize, test.header, header)
+			}
+		})
+	}
+}
+
+func TestHeaderDecodePadded(t *testing.T) {
+	t.Parallel()
+
+	validBytes := Header{}.AppendPadded(nil, 32)
+
+	tests := []struct {
+		name        string
+		bytes       []byte
+		blockSize   int
+		errorString string
+	}{
+		{"zero block size", validBytes, 0, "invalid value: non-positive block size 0"},
+		{"nil bytes slice", nil, 32, "invalid value: length 0 is not a multiple of block size 32"},
+		{"not multiple", validBytes[:31], 32, "invalid value: length 31 is not a multiple of block size 32"},
+		{"no padding start byte", make([]byte, 32), 32, "invalid value: invalid padding"},
+		{"non-zero padding byte", append(validBytes[:31:31], 1), 32, "invalid value: invalid padding"},
+		{"padding longer than block", validBytes, 8, "invalid value: invalid padding"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := DecodePadded(test.bytes, test.blockSize)
+			if !errors.Is(err, errlist.ErrInvalidValue) || err.Error() != test.errorString {
+				t.Fatalf("DecodePadded(%v, %d) expected error %q but got %v", test.bytes, test.blockSize, test.errorString, err)
+			}
+		})
+	}
+}
+
+func TestHeaderEncodeUnsortedExtensions(t *testing.T) {
+	t.Parallel()
+
+	extensions := []Extension{
+		{Type: 300, Value: []byte{1}},
+		{Type: ExtensionTypeApplication, Value: []byte{2}},
+		{Type: 300, Value: []byte{3}},
+		{Type: ExtensionTypeNextPublicKey, Value: []byte{4}},
+	}
+	header := Header{Extensions: extensions}
+
+	expected := Header{
+		Extensions: []Extension{
+			{Type: ExtensionTypeApplication, Value: []byte{2}},
+			{Type: ExtensionTypeNextPublicKey, Value: []byte{4}},
+			{Type: 300, Value: []byte{3}},
+		},
+	}
+
+	bytes := header.Encode()
+	if !slices.Equal(bytes, expected.Encode()) {
+		t.Fatalf("%+v.Encode(): expected %v but got %v", header, expected.Encode(), bytes)
+	}
+
+	if header.EncodedLen() != len(bytes) {
+		t.Fatalf("%+v.EncodedLen(): expected %d but got %d", header, len(bytes), header.EncodedLen())
+	}
+
+	decoded, err := Decode(bytes)
+	if err != nil {
+		t.Fatalf("Decode(%v): expected no error but got %v", bytes, err)
+	}
+
+	if !reflect.DeepEqual(decoded, expected) {
+		t.Fatalf("Decode(%v): expected %+v but got %+v", bytes, expected, decoded)
+	}
+
+	if extensions[0].Type != 300 || extensions[0].Value[0] != 1 {
+		t.Fatalf("%+v.Encode(): expected extensions not to be changed", header)
+	}
+
+	if value, ok := header.Extension(300); !ok || !slices.Equal(value, []byte{3}) {
+		t.Fatalf("%+v.Extension(300): expected %v but got %v, %t", header, []byte{3}, value, ok)
+	}
+}
+
+func TestHeaderExtension(t *testing.T) {
+	t.Parallel()
+
+	header := Header{Extensions: []Extension{{Type: ExtensionTypeApplication, Value: []byte{1}}}}
+
+	value, ok := header.Extension(ExtensionTypeApplication)
+	if !ok || !slices.Equal(value, []byte{1}) {
+		t.Fatalf("%+v.Extension(%d): expected %v but got %v, %t", header, ExtensionTypeApplication, []byte{1}, value, ok)
+	}
+
+	if value, ok = header.Extension(2); ok {
+		t.Fatalf("%+v.Extension(2): expected no value but got %v", header, value)
+	}
+}
+
+func TestHeaderClone(t *testing.T) {
+	t.Parallel()
+
+	header := Header{
+		PublicKey:  keys.Public{Bytes: []byte{1}},
+		Extensions: []Extension{{Type: ExtensionTypeApplication, Value: []byte{2}}},
+	}
+
+	clone := header.Clone()
+	if !reflect.DeepEqual(clone, header) {
+		t.Fatalf("%+v.Clone(): expected %+v but got %+v", header, header, clone)
+	}
+
+	clone.PublicKey.Bytes[0] = 3
+	clone.Extensions[0].Value[0] = 4
+
+	if header.PublicKey.Bytes[0] != 1 || header.Extensions[0].Value[0] != 2 {
+		t.Fatalf("%+v.Clone(): expected deep clone", header)
+	}
+}
@@ -0,0 +1,22 @@
+package ratchet
+
+import (
+	"fmt"
+
+	"github.com/platform-inf/go-ratchet/receivingchain"
+)
+
+// InspectHeader decrypts the header of the incoming message and classifies the message without changing the ratchet,
+// e.g. to route the message to the right conversation before decryption. Epoch of the result is the same as the
+// receiving epoch in DecryptResult.
+//
+// Like Decrypt, it returns *receivingchain.DecryptError for unknown header keys, duplicates and old messages. Note that
+// the header is not authenticated with the data here, so the message may still fail to decrypt.
+func (r Ratchet) InspectHeader(encryptedHeader []byte) (receivingchain.HeaderInfo, error) {
+	info, err := r.receivingChain.InspectHeader(encryptedHeader)
+	if err != nil {
+		return receivingchain.HeaderInfo{}, fmt.Errorf("receiving chain: %w", err)
+	}
+
+	return info, nil
+}
@@ -0,0 +1,87 @@
+// Package journal records side effects of a transaction, so they can be applied on commit or undone on rollback.
+//
+// Nil journal means that there is no transaction: commit actions are applied immediately and rollback actions are
+// dropped.
+package journal
+
+type Journal struct {
+	prepareActions  []func() error
+	commitActions   []func()
+	rollbackActions []func()
+}
+
+// Commit applies prepare actions and then commit actions in the order of registration and clears the journal.
+//
+// If a prepare action fails, the journal is rolled back instead and the error is returned.
+func (j *Journal) Commit() error {
+	if j == nil {
+		return nil
+	}
+
+	for _, action := range j.prepareActions {
+		if err := action(); err != nil {
+			j.Rollback()
+			return err
+		}
+	}
+
+	for _, action := range j.commitActions {
+		action()
+	}
+
+	j.reset()
+
+	return nil
+}
+
+// OnCommit registers action, which must be applied on commit, e.g. wiping of a superseded key.
+func (j *Journal) OnCommit(action func()) {
+	if j == nil {
+		action()
+		return
+	}
+
+	j.commitActions = append(j.commitActions, action)
+}
+
+// OnPrepare registers action, which may fail and must be applied on commit before other actions, e.g. commit of an
+// external storage transaction. Without journal action is dropped, because there is nothing to prepare.
+func (j *Journal) OnPrepare(action func() error) {
+	if j == nil {
+		return
+	}
+
+	j.prepareActions = append(j.prepareActions, action)
+}
+
+// OnRollback registers action, which must undo a change on rollback.
+func (j *Journal) OnRollback(action func()) {
+	if j == nil {
+		return
+	}
+
+	j.rollbackActions = append(j.rollbackActions, action)
+}
+
+// Rollback applies rollback actions in the reverse order of registration and clears the journal.
+func (j *Journal) Rollback() {
+	if j == nil {
+		return
+	}
+
+	for i := len(j.rollbackActions) - 1; i >= 0; i-- {
+		j.rollbackActions[i]()
+	}
+
+	j.reset()
+}
+
+func (j *Journal) reset() {
+	clear(j.prepareActions)
+	clear(j.commitActions)
+	clear(j.rollbackActions)
+
+	j.prepareActions = j.prepareActions[:0]
+	j.commitActions = j.commitActions[:0]
+	j.rollbackActions = j.rollbackActions[:0]
+}
@@ -0,0 +1,100 @@
+package journal
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestJournal(t *testing.T) {
+	t.Parallel()
+
+	t.Run("commit", func(t *testing.T) {
+		t.Parallel()
+
+		var journal Journal
+		var actions []int
+
+		journal.OnCommit(func() { actions = append(actions, 1) })
+		journal.OnRollback(func() { actions = append(actions, -1) })
+		journal.OnCommit(func() { actions = append(actions, 2) })
+
+		if len(actions) != 0 {
+			t.Fatalf("OnCommit(): applied actions before commit: %v", actions)
+		}
+
+		if err := journal.Commit(); err != nil {
+			t.Fatalf("Commit(): expected no error but got %v", err)
+		}
+
+		journal.Rollback()
+
+		if !slices.Equal(actions, []int{1, 2}) {
+			t.Fatalf("Commit(): expected actions [1 2] but got %v", actions)
+		}
+	})
+
+	t.Run("rollback", func(t *testing.T) {
+		t.Parallel()
+
+		var journal Journal
+		var actions []int
+
+		journal.OnRollback(func() { actions = append(actions, 1) })
+		journal.OnCommit(func() { actions = append(actions, -1) })
+		journal.OnRollback(func() { actions = append(actions, 2) })
+
+		journal.Rollback()
+
+		if err := journal.Commit(); err != nil {
+			t.Fatalf("Commit(): expected no error but got %v", err)
+		}
+
+		if !slices.Equal(actions, []int{2, 1}) {
+			t.Fatalf("Rollback(): expected actions [2 1] but got %v", actions)
+		}
+	})
+
+	t.Run("prepare error", func(t *testing.T) {
+		t.Parallel()
+
+		var journal Journal
+		var actions []int
+
+		prepareErr := errors.New("prepare")
+
+		journal.OnPrepare(func() error { return nil })
+		journal.OnCommit(func() { actions = append(actions, 1) })
+		journal.OnRollback(func() { actions = append(actions, -1) })
+		journal.OnPrepare(func() error { return prepareErr })
+
+		if err := journal.Commit(); !errors.Is(err, prepareErr) {
+			t.Fatalf("Commit(): expected prepare error but got %v", err)
+		}
+
+		if !slices.Equal(actions, []int{-1}) {
+			t.Fatalf("Commit(): expected rollback actions [-1] but got %v", actions)
+		}
+	})
+
+	t.Run("nil journal", func(t *testing.T) {
+		t.Parallel()
+
+		var journal *Journal
+		var actions []int
+
+		journal.OnCommit(func() { actions = append(actions, 1) })
+		journal.OnRollback(func() { actions = append(actions, -1) })
+
+		journal.OnPrepare(func() error { return errors.New("prepare") })
+		journal.Rollback()
+
+		if err := journal.Commit(); err != nil {
+			t.Fatalf("Commit(): expected no error but got %v", err)
+		}
+
+		if !slices.Equal(actions, []int{1}) {
+			t.Fatalf("nil journal: expected actions [1] but got %v", actions)
+		}
+	})
+}
@@ -0,0 +1,134 @@
+package keys
+
+import (
+	"os"
+	"sync"
+	"unsafe"
+)
+
+const lockedAllocatorSlotSize = 128
+
+// Allocator allocates memory for key bytes.
+type Allocator interface {
+	// Alloc must return zeroed bytes of passed size.
+	Alloc(size int) []byte
+
+	// Free must release memory of bytes returned by Alloc. Passed bytes are already wiped. Note that Free must ignore
+	// bytes, which are already released, so the same memory is never handed out twice.
+	Free(bytes []byte)
+}
+
+// LockedAllocator allocates key bytes in memory, which is locked into RAM and excluded from core dumps, so keys never
+// reach swap or dumps.
+//
+// Memory is split into fixed-size slots. Keys longer than a slot and all keys on platforms, where locking is not
+// supported or not allowed (e.g. because of RLIMIT_MEMLOCK), are allocated on the Go heap.
+//
+// Locked memory is never returned to the operating system, so the allocator is meant to be shared by all ratchets of
+// the process.
+type LockedAllocator struct {
+	mu       sync.Mutex
+	pages    [][]byte
+	slots    [][]byte
+	fallback bool
+}
+
+// NewLockedAllocator creates allocator and tries to lock the first memory page. Use Locked to check the result.
+func NewLockedAllocator() *LockedAllocator {
+	allocator := &LockedAllocator{}
+	allocator.grow()
+
+	return allocator
+}
+
+// Alloc allocates bytes in a locked slot. Note that empty bytes never take a slot, because Free can not identify them.
+func (a *LockedAllocator) Alloc(size int) []byte {
+	if size == 0 || size > lockedAllocatorSlotSize {
+		return make([]byte, size)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if len(a.slots) == 0 {
+		a.grow()
+	}
+
+	if len(a.slots) == 0 {
+		return make([]byte, size)
+	}
+
+	slot := a.slots[len(a.slots)-1]
+	a.slots = a.slots[:len(a.slots)-1]
+
+	return slot[:size:size]
+}
+
+func (a *LockedAllocator) Free(bytes []byte) {
+	if len(bytes) == 0 {
+		return
+	}
+
+	address := uintptr(unsafe.Pointer(unsafe.SliceData(bytes)))
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for _, page := range a.pages {
+		pageAddress := uintptr(unsafe.Pointer(unsafe.SliceData(page)))
+		if address < pageAddress || address >= pageAddress+uintptr(len(page)) {
+			continue
+		}
+
+		offset := int(address-pageAddress) / lockedAllocatorSlotSize * lockedAllocatorSlotSize
+
+		slot := page[offset : offset+lockedAllocatorSlotSize : offset+lockedAllocatorSlotSize]
+		if a.isFree(slot) {
+			return
+		}
+
+		clear(slot)
+
+		a.slots = append(a.slots, slot)
+
+		return
+	}
+}
+
+// Locked reports whether the allocator serves allocations from locked memory.
+func (a *LockedAllocator) Locked() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return !a.fallback
+}
+
+// isFree must be called with locked mutex.
+func (a *LockedAllocator) isFree(slot []byte) bool {
+	for _, freeSlot := range a.slots {
+		if unsafe.SliceData(freeSlot) == unsafe.SliceData(slot) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// grow must be called with locked mutex.
+func (a *LockedAllocator) grow() {
+	if a.fallback {
+		return
+	}
+
+	page, err := mapLockedMemory(os.Getpagesize())
+	if err != nil {
+		a.fallback = true
+		return
+	}
+
+	a.pages = append(a.pages, page)
+
+	for offset := 0; offset+lockedAllocatorSlotSize <= len(page); offset += lockedAllocatorSlotSize {
+		a.slots = append(a.slots, page[offset:offset+lockedAllocatorSlotSize:offset+lockedAllocatorSlotSize])
+	}
+}
@@ -0,0 +1,96 @@
+package keys
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestLockedAllocator(t *testing.T) {
+	t.Parallel()
+
+	allocator := NewLockedAllocator()
+
+	t.Run("alloc and free", func(t *testing.T) {
+		t.Parallel()
+
+		for _, size := range []int{0, 1, 32, lockedAllocatorSlotSize, lockedAllocatorSlotSize + 1} {
+			allocated := allocator.Alloc(size)
+			if len(allocated) != size || cap(allocated) != size {
+				t.Fatalf("Alloc(%d): returned bytes with len %d and cap %d", size, len(allocated), cap(allocated))
+			}
+
+			if !bytes.Equal(allocated, make([]byte, size)) {
+				t.Fatalf("Alloc(%d): returned not zeroed bytes %v", size, allocated)
+			}
+
+			for i := range allocated {
+				allocated[i] = 0xFF
+			}
+
+			allocator.Free(allocated)
+		}
+	})
+
+	t.Run("free and alloc reuses zeroed slot", func(t *testing.T) {
+		t.Parallel()
+
+		if !allocator.Locked() {
+			t.Skip("memory locking is not allowed")
+		}
+
+		allocated := allocator.Alloc(lockedAllocatorSlotSize)
+		copy(allocated, []byte{1, 2, 3})
+		allocator.Free(allocated)
+
+		reallocated := allocator.Alloc(lockedAllocatorSlotSize)
+		defer allocator.Free(reallocated)
+
+		if !bytes.Equal(reallocated, make([]byte, lockedAllocatorSlotSize)) {
+			t.Fatalf("Alloc(): returned not zeroed bytes %v", reallocated)
+		}
+	})
+
+	t.Run("empty bytes do not take slots", func(t *testing.T) {
+		t.Parallel()
+
+		allocator := NewLockedAllocator()
+		if !allocator.Locked() {
+			t.Skip("memory locking is not allowed")
+		}
+
+		allocator.mu.Lock()
+		slotsCount := len(allocator.slots)
+		allocator.mu.Unlock()
+
+		allocator.Free(allocator.Alloc(0))
+
+		allocator.mu.Lock()
+		defer allocator.mu.Unlock()
+
+		if len(allocator.slots) != slotsCount {
+			t.Fatalf("Alloc(0): expected %d free slots but got %d", slotsCount, len(allocator.slots))
+		}
+	})
+
+	t.Run("double free is ignored", func(t *testing.T) {
+		t.Parallel()
+
+		if !allocator.Locked() {
+			t.Skip("memory locking is not allowed")
+		}
+
+		allocated := allocator.Alloc(lockedAllocatorSlotSize)
+		allocator.Free(allocated)
+		allocator.Free(allocated)
+
+		first := allocator.Alloc(lockedAllocatorSlotSize)
+		defer allocator.Free(first)
+
+		second := allocator.Alloc(lockedAllocatorSlotSize)
+		defer allocator.Free(second)
+
+		if &first[0] == &second[0] {
+			t.Fatalf("Alloc(): returned the same memory %p twice after double Free()", &first[0])
+		}
+	})
+}
@@ -0,0 +1,64 @@
+package keys
+
+import (
+	"encoding/hex"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+const fingerprintLen = 8
+
+// fingerprintKey separates fingerprints from other hashes of the same key bytes.
+var fingerprintKey = []byte("go-ratchet key fingerprint")
+
+// Fingerprint returns the fingerprint of the header key.
+func (hk Header) Fingerprint() string {
+	return fingerprint(hk.Bytes)
+}
+
+// Fingerprint returns the fingerprint of the message key.
+func (mk Message) Fingerprint() string {
+	return fingerprint(mk.Bytes)
+}
+
+// Fingerprint returns the fingerprint of the message master key.
+func (mk MessageMaster) Fingerprint() string {
+	return fingerprint(mk.Bytes)
+}
+
+// Fingerprint returns the fingerprint of the private key.
+func (pk Private) Fingerprint() string {
+	return fingerprint(pk.Bytes)
+}
+
+// Fingerprint returns the fingerprint of the public key.
+func (pk Public) Fingerprint() string {
+	return fingerprint(pk.Bytes)
+}
+
+// Fingerprint returns the fingerprint of the root key.
+func (rk Root) Fingerprint() string {
+	return fingerprint(rk.Bytes)
+}
+
+// Fingerprint returns the fingerprint of the shared key.
+func (sk Shared) Fingerprint() string {
+	return fingerprint(sk.Bytes)
+}
+
+// fingerprint returns a short hex-encoded hash of key bytes, which identifies the key but does not allow to restore it.
+// Fingerprint of empty bytes is empty, so a missing key has no fingerprint.
+func fingerprint(bytes []byte) string {
+	if len(bytes) == 0 {
+		return ""
+	}
+
+	hash, err := blake2b.New(fingerprintLen, fingerprintKey)
+	if err != nil {
+		panic(err) // Note that the hash size and the key length are constant and valid.
+	}
+
+	_, _ = hash.Write(bytes)
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
@@ -0,0 +1,29 @@
+package keys
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestFingerprint(t *testing.T) {
+	t.Parallel()
+
+	key := Header{Bytes: []byte{1, 2, 3}}
+
+	fingerprint := key.Fingerprint()
+	if !regexp.MustCompile(`^[0-9a-f]{16}$`).MatchString(fingerprint) {
+		t.Fatalf("%+v.Fingerprint(): expected 16 hex digits but got %q", key, fingerprint)
+	}
+
+	if publicFingerprint := (Public{Bytes: key.Bytes}).Fingerprint(); publicFingerprint != fingerprint {
+		t.Fatalf("Fingerprint(): expected same fingerprint for same bytes but got %q and %q", fingerprint, publicFingerprint)
+	}
+
+	if otherFingerprint := (Header{Bytes: []byte{1, 2, 4}}).Fingerprint(); otherFingerprint == fingerprint {
+		t.Fatalf("Fingerprint(): expected different fingerprints but got %q", otherFingerprint)
+	}
+
+	if emptyFingerprint := (Header{}).Fingerprint(); emptyFingerprint != "" {
+		t.Fatalf("Fingerprint(): expected empty fingerprint of empty key but got %q", emptyFingerprint)
+	}
+}
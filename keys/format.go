@@ -0,0 +1,140 @@
+package keys
+
+import (
+	"fmt"
+	"log/slog"
+)
+
+func (hk Header) Format(state fmt.State, verb rune) {
+	formatKey(state, verb, "Header", hk.Bytes)
+}
+
+func (hk Header) GoString() string {
+	return goStringKey("Header", hk.Bytes)
+}
+
+func (hk Header) LogValue() slog.Value {
+	return slog.StringValue(fingerprint(hk.Bytes))
+}
+
+func (hk Header) String() string {
+	return stringKey("Header", hk.Bytes)
+}
+
+func (mk Message) Format(state fmt.State, verb rune) {
+	formatKey(state, verb, "Message", mk.Bytes)
+}
+
+func (mk Message) GoString() string {
+	return goStringKey("Message", mk.Bytes)
+}
+
+func (mk Message) LogValue() slog.Value {
+	return slog.StringValue(fingerprint(mk.Bytes))
+}
+
+func (mk Message) String() string {
+	return stringKey("Message", mk.Bytes)
+}
+
+func (mk MessageMaster) Format(state fmt.State, verb rune) {
+	formatKey(state, verb, "MessageMaster", mk.Bytes)
+}
+
+func (mk MessageMaster) GoString() string {
+	return goStringKey("MessageMaster", mk.Bytes)
+}
+
+func (mk MessageMaster) LogValue() slog.Value {
+	return slog.StringValue(fingerprint(mk.Bytes))
+}
+
+func (mk MessageMaster) String() string {
+	return stringKey("MessageMaster", mk.Bytes)
+}
+
+func (pk Private) Format(state fmt.State, verb rune) {
+	formatKey(state, verb, "Private", pk.Bytes)
+}
+
+func (pk Private) GoString() string {
+	return goStringKey("Private", pk.Bytes)
+}
+
+func (pk Private) LogValue() slog.Value {
+	return slog.StringValue(fingerprint(pk.Bytes))
+}
+
+func (pk Private) String() string {
+	return stringKey("Private", pk.Bytes)
+}
+
+func (pk Public) Format(state fmt.State, verb rune) {
+	formatKey(state, verb, "Public", pk.Bytes)
+}
+
+func (pk Public) GoString() string {
+	return goStringKey("Public", pk.Bytes)
+}
+
+func (pk Public) LogValue() slog.Value {
+	return slog.StringValue(fingerprint(pk.Bytes))
+}
+
+func (pk Public) String() string {
+	return stringKey("Public", pk.Bytes)
+}
+
+func (rk Root) Format(state fmt.State, verb rune) {
+	formatKey(state, verb, "Root", rk.Bytes)
+}
+
+func (rk Root) GoString() string {
+	return goStringKey("Root", rk.Bytes)
+}
+
+func (rk Root) LogValue() slog.Value {
+	return slog.StringValue(fingerprint(rk.Bytes))
+}
+
+func (rk Root) String() string {
+	return stringKey("Root", rk.Bytes)
+}
+
+func (sk Shared) Format(state fmt.State, verb rune) {
+	formatKey(state, verb, "Shared", sk.Bytes)
+}
+
+func (sk Shared) GoString() string {
+	return goStringKey("Shared", sk.Bytes)
+}
+
+func (sk Shared) LogValue() slog.Value {
+	return slog.StringValue(fingerprint(sk.Bytes))
+}
+
+func (sk Shared) String() string {
+	return stringKey("Shared", sk.Bytes)
+}
+
+// formatKey prints the type name and the fingerprint of key bytes instead of the bytes.
+func formatKey(state fmt.State, verb rune, typeName string, bytes []byte) {
+	if verb == 'v' && state.Flag('#') {
+		_, _ = state.Write([]byte(goStringKey(typeName, bytes)))
+		return
+	}
+
+	_, _ = state.Write([]byte(stringKey(typeName, bytes)))
+}
+
+func goStringKey(typeName string, bytes []byte) string {
+	return "keys." + stringKey(typeName, bytes)
+}
+
+func stringKey(typeName string, bytes []byte) string {
+	if len(bytes) == 0 {
+		return typeName + "{}"
+	}
+
+	return typeName + "{" + fingerprint(bytes) + "}"
+}
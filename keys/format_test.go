@@ -0,0 +1,46 @@
+package keys
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestFormat(t *testing.T) {
+	t.Parallel()
+
+	bytes := []byte{0xAB, 0xCD, 0xEF, 0x12}
+	key := Root{Bytes: bytes}
+	expected := "Root{" + key.Fingerprint() + "}"
+
+	tests := []struct {
+		format   string
+		arg      any
+		expected string
+	}{
+		{"%v", key, expected},
+		{"%+v", &key, expected},
+		{"%s", key, expected},
+		{"%x", key, expected},
+		{"%d", key, expected},
+		{"%#v", key, "keys." + expected},
+		{"%v", struct{ Key Private }{Private{Bytes: bytes}}, "{Private{" + key.Fingerprint() + "}}"},
+		{"%v", Shared{}, "Shared{}"},
+	}
+
+	for _, test := range tests {
+		if formatted := fmt.Sprintf(test.format, test.arg); formatted != test.expected {
+			t.Fatalf("Sprintf(%q): expected %q but got %q", test.format, test.expected, formatted)
+		}
+	}
+
+	var buffer strings.Builder
+
+	logger := slog.New(slog.NewTextHandler(&buffer, nil))
+	logger.Info("test", "key", Message{Bytes: bytes})
+
+	if !strings.Contains(buffer.String(), "key="+key.Fingerprint()) || strings.Contains(buffer.String(), "abcdef12") {
+		t.Fatalf("LogValue(): expected fingerprint in log but got %q", buffer.String())
+	}
+}
@@ -20,3 +20,12 @@ func (hk *Header) ClonePtr() *Header {
 
 	return &clone
 }
+
+// Wipe overwrites key bytes with zeros. Wipe does nothing for nil key.
+func (hk *Header) Wipe() {
+	if hk == nil {
+		return
+	}
+
+	clear(hk.Bytes)
+}
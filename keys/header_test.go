@@ -59,3 +59,29 @@ func TestHeaderClonePtr(t *testing.T) {
 		})
 	}
 }
+
+func TestHeaderWipe(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		key   *Header
+		wiped *Header
+	}{
+		{"nil ptr to header key", nil, nil},
+		{"ptr to zero header key", &Header{}, &Header{}},
+		{"ptr to full header key", &Header{Bytes: []byte{1, 2, 3, 4, 5}}, &Header{Bytes: make([]byte, 5)}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			test.key.Wipe()
+
+			if !reflect.DeepEqual(test.key, test.wiped) {
+				t.Fatalf("Wipe(): expected %+v but got %+v", test.wiped, test.key)
+			}
+		})
+	}
+}
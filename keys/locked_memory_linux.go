@@ -0,0 +1,30 @@
+//go:build linux
+
+package keys
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+func mapLockedMemory(size int) ([]byte, error) {
+	bytes, err := unix.Mmap(-1, 0, size, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_ANON|unix.MAP_PRIVATE)
+	if err != nil {
+		return nil, fmt.Errorf("mmap: %w", err)
+	}
+
+	if err := unix.Mlock(bytes); err != nil {
+		_ = unix.Munmap(bytes)
+		return nil, fmt.Errorf("mlock: %w", err)
+	}
+
+	if err := unix.Madvise(bytes, unix.MADV_DONTDUMP); err != nil {
+		_ = unix.Munlock(bytes)
+		_ = unix.Munmap(bytes)
+
+		return nil, fmt.Errorf("madvise: %w", err)
+	}
+
+	return bytes, nil
+}
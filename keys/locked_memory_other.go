@@ -0,0 +1,9 @@
+//go:build !linux
+
+package keys
+
+import "errors"
+
+func mapLockedMemory(_ int) ([]byte, error) {
+	return nil, errors.New("locked memory is not supported on this platform")
+}
@@ -10,3 +10,12 @@ func (mk Message) Clone() Message {
 	mk.Bytes = utils.CloneByteSlice(mk.Bytes)
 	return mk
 }
+
+// Wipe overwrites key bytes with zeros. Wipe does nothing for nil key.
+func (mk *Message) Wipe() {
+	if mk == nil {
+		return
+	}
+
+	clear(mk.Bytes)
+}
@@ -20,3 +20,12 @@ func (mk *MessageMaster) ClonePtr() *MessageMaster {
 
 	return &clone
 }
+
+// Wipe overwrites key bytes with zeros. Wipe does nothing for nil key.
+func (mk *MessageMaster) Wipe() {
+	if mk == nil {
+		return
+	}
+
+	clear(mk.Bytes)
+}
@@ -59,3 +59,33 @@ func TestMessageMasterClonePtr(t *testing.T) {
 		})
 	}
 }
+
+func TestMessageMasterWipe(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		key   *MessageMaster
+		wiped *MessageMaster
+	}{
+		{"nil ptr to message master key", nil, nil},
+		{"ptr to zero message master key", &MessageMaster{}, &MessageMaster{}},
+		{
+			"ptr to full message master key",
+			&MessageMaster{Bytes: []byte{1, 2, 3, 4, 5}},
+			&MessageMaster{Bytes: make([]byte, 5)},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			test.key.Wipe()
+
+			if !reflect.DeepEqual(test.key, test.wiped) {
+				t.Fatalf("Wipe(): expected %+v but got %+v", test.wiped, test.key)
+			}
+		})
+	}
+}
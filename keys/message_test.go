@@ -31,3 +31,29 @@ func TestMessageClone(t *testing.T) {
 		})
 	}
 }
+
+func TestMessageWipe(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		key   *Message
+		wiped *Message
+	}{
+		{"nil ptr to message key", nil, nil},
+		{"ptr to zero message key", &Message{}, &Message{}},
+		{"ptr to full message key", &Message{Bytes: []byte{1, 2, 3, 4, 5}}, &Message{Bytes: make([]byte, 5)}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			test.key.Wipe()
+
+			if !reflect.DeepEqual(test.key, test.wiped) {
+				t.Fatalf("Wipe(): expected %+v but got %+v", test.wiped, test.key)
+			}
+		})
+	}
+}
@@ -10,3 +10,54 @@ func (pk Private) Clone() Private {
 	pk.Bytes = utils.CloneByteSlice(pk.Bytes)
 	return pk
 }
+
+// Wipe overwrites key bytes with zeros. Wipe does nothing for nil key.
+func (pk *Private) Wipe() {
+	if pk == nil {
+		return
+	}
+
+	clear(pk.Bytes)
+}
+
+// CloneWith returns a clone of the key, whose bytes are allocated by passed allocator. Nil allocator means Go heap.
+func (pk Private) CloneWith(allocator Allocator) Private {
+	if allocator == nil {
+		return pk.Clone()
+	}
+
+	bytes := allocator.Alloc(len(pk.Bytes))
+	copy(bytes, pk.Bytes)
+	pk.Bytes = bytes
+
+	return pk
+}
+
+// Free wipes the key and releases its memory to passed allocator. Nil allocator means Go heap. Note that key bytes
+// are set to nil, so freeing the key again does nothing.
+func (pk *Private) Free(allocator Allocator) {
+	pk.Wipe()
+
+	if pk == nil {
+		return
+	}
+
+	if allocator != nil {
+		allocator.Free(pk.Bytes)
+	}
+
+	pk.Bytes = nil
+}
+
+// MoveTo returns a copy of the key in memory of passed allocator and wipes the source bytes. Nil allocator keeps the
+// key as is.
+func (pk Private) MoveTo(allocator Allocator) Private {
+	if allocator == nil {
+		return pk
+	}
+
+	moved := pk.CloneWith(allocator)
+	pk.Wipe()
+
+	return moved
+}
@@ -1,6 +1,7 @@
 package keys
 
 import (
+	"bytes"
 	"reflect"
 	"testing"
 )
@@ -31,3 +32,81 @@ func TestPrivateClone(t *testing.T) {
 		})
 	}
 }
+
+func TestPrivateWipe(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		key   *Private
+		wiped *Private
+	}{
+		{"nil ptr to private key", nil, nil},
+		{"ptr to zero private key", &Private{}, &Private{}},
+		{"ptr to full private key", &Private{Bytes: []byte{1, 2, 3, 4, 5}}, &Private{Bytes: make([]byte, 5)}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			test.key.Wipe()
+
+			if !reflect.DeepEqual(test.key, test.wiped) {
+				t.Fatalf("Wipe(): expected %+v but got %+v", test.wiped, test.key)
+			}
+		})
+	}
+}
+
+func TestPrivateMoveTo(t *testing.T) {
+	t.Parallel()
+
+	allocator := NewLockedAllocator()
+
+	t.Run("nil allocator", func(t *testing.T) {
+		t.Parallel()
+
+		key := Private{Bytes: []byte{1, 2, 3}}
+
+		moved := key.MoveTo(nil)
+		if &moved.Bytes[0] != &key.Bytes[0] {
+			t.Fatalf("%+v.MoveTo(nil): returned different memory", key)
+		}
+	})
+
+	t.Run("locked allocator", func(t *testing.T) {
+		t.Parallel()
+
+		key := Private{Bytes: []byte{1, 2, 3}}
+
+		moved := key.MoveTo(allocator)
+		if !bytes.Equal(moved.Bytes, []byte{1, 2, 3}) {
+			t.Fatalf("MoveTo(): returned different bytes %v", moved.Bytes)
+		}
+
+		if !bytes.Equal(key.Bytes, make([]byte, 3)) {
+			t.Fatalf("MoveTo(): source private key is not wiped: %v", key.Bytes)
+		}
+
+		clone := moved.CloneWith(allocator)
+		if !bytes.Equal(clone.Bytes, moved.Bytes) || &clone.Bytes[0] == &moved.Bytes[0] {
+			t.Fatalf("%+v.CloneWith(): returned %+v", moved, clone)
+		}
+
+		movedBytes := moved.Bytes
+		moved.Free(allocator)
+
+		if !bytes.Equal(movedBytes, make([]byte, 3)) {
+			t.Fatalf("Free(): private key is not wiped: %v", movedBytes)
+		}
+
+		if moved.Bytes != nil {
+			t.Fatalf("Free(): private key bytes are not nil: %v", moved.Bytes)
+		}
+
+		moved.Free(allocator)
+
+		clone.Free(allocator)
+	})
+}
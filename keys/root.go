@@ -10,3 +10,54 @@ func (rk Root) Clone() Root {
 	rk.Bytes = utils.CloneByteSlice(rk.Bytes)
 	return rk
 }
+
+// Wipe overwrites key bytes with zeros. Wipe does nothing for nil key.
+func (rk *Root) Wipe() {
+	if rk == nil {
+		return
+	}
+
+	clear(rk.Bytes)
+}
+
+// CloneWith returns a clone of the key, whose bytes are allocated by passed allocator. Nil allocator means Go heap.
+func (rk Root) CloneWith(allocator Allocator) Root {
+	if allocator == nil {
+		return rk.Clone()
+	}
+
+	bytes := allocator.Alloc(len(rk.Bytes))
+	copy(bytes, rk.Bytes)
+	rk.Bytes = bytes
+
+	return rk
+}
+
+// Free wipes the key and releases its memory to passed allocator. Nil allocator means Go heap. Note that key bytes
+// are set to nil, so freeing the key again does nothing.
+func (rk *Root) Free(allocator Allocator) {
+	rk.Wipe()
+
+	if rk == nil {
+		return
+	}
+
+	if allocator != nil {
+		allocator.Free(rk.Bytes)
+	}
+
+	rk.Bytes = nil
+}
+
+// MoveTo returns a copy of the key in memory of passed allocator and wipes the source bytes. Nil allocator keeps the
+// key as is.
+func (rk Root) MoveTo(allocator Allocator) Root {
+	if allocator == nil {
+		return rk
+	}
+
+	moved := rk.CloneWith(allocator)
+	rk.Wipe()
+
+	return moved
+}
@@ -3,3 +3,12 @@ package keys
 type Shared struct {
 	Bytes []byte
 }
+
+// Wipe overwrites key bytes with zeros. Wipe does nothing for nil key.
+func (sk *Shared) Wipe() {
+	if sk == nil {
+		return
+	}
+
+	clear(sk.Bytes)
+}
@@ -0,0 +1,32 @@
+package keys
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSharedWipe(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		key   *Shared
+		wiped *Shared
+	}{
+		{"nil ptr to shared key", nil, nil},
+		{"ptr to zero shared key", &Shared{}, &Shared{}},
+		{"ptr to full shared key", &Shared{Bytes: []byte{1, 2, 3, 4, 5}}, &Shared{Bytes: make([]byte, 5)}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			test.key.Wipe()
+
+			if !reflect.DeepEqual(test.key, test.wiped) {
+				t.Fatalf("Wipe(): expected %+v but got %+v", test.wiped, test.key)
+			}
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package ratchet
+
+import (
+	"context"
+	"log/slog"
+)
+
+// logObserver logs the ratchet lifecycle events at debug level and passes them to the next observer.
+type logObserver struct {
+	logger *slog.Logger
+	next   Observer
+}
+
+func newLogObserver(logger *slog.Logger, next Observer) Observer {
+	if next == nil {
+		next = NopObserver{}
+	}
+
+	return withMissingMessagesForwarding(logObserver{logger: logger, next: next}, next)
+}
+
+func (o logObserver) OnDHRatchet(direction Direction, epoch uint64) {
+	o.log("Diffie-Hellman ratchet step", slog.String("direction", direction.String()), slog.Uint64("epoch", epoch))
+	o.next.OnDHRatchet(direction, epoch)
+}
+
+func (o logObserver) OnDecryptFailure(err error) {
+	o.log("decrypt failure", slog.String("error", err.Error()))
+	o.next.OnDecryptFailure(err)
+}
+
+func (o logObserver) OnKeysSkipped(headerKeyFingerprint string, from, to uint64) {
+	o.log(
+		"message keys skipped",
+		slog.String("header_key", headerKeyFingerprint),
+		slog.Uint64("from", from),
+		slog.Uint64("to", to),
+		slog.Uint64("count", to-from),
+	)
+	o.next.OnKeysSkipped(headerKeyFingerprint, from, to)
+}
+
+func (o logObserver) OnSkippedKeyUsed(headerKeyFingerprint string, messageNumber uint64) {
+	o.log(
+		"skipped message key used",
+		slog.String("header_key", headerKeyFingerprint),
+		slog.Uint64("message_number", messageNumber),
+	)
+	o.next.OnSkippedKeyUsed(headerKeyFingerprint, messageNumber)
+}
+
+func (o logObserver) OnSkippedKeysEvicted(count int) {
+	o.log("skipped message keys evicted", slog.Int("count", count))
+	o.next.OnSkippedKeysEvicted(count)
+}
+
+func (o logObserver) log(message string, attrs ...slog.Attr) {
+	o.logger.LogAttrs(context.Background(), slog.LevelDebug, message, attrs...)
+}
@@ -0,0 +1,15 @@
+package messagechainscommon
+
+import "encoding/binary"
+
+// AppendMessageAuth appends authenticated data of the message to dst: the encrypted header, the session associated data
+// and the caller's auth, each prefixed with its uvarint length, so different splits of the same bytes never produce the
+// same authenticated data.
+func AppendMessageAuth(dst, encryptedHeader, associatedData, auth []byte) []byte {
+	for _, part := range [...][]byte{encryptedHeader, associatedData, auth} {
+		dst = binary.AppendUvarint(dst, uint64(len(part)))
+		dst = append(dst, part...)
+	}
+
+	return dst
+}
@@ -0,0 +1,44 @@
+package messagechainscommon
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestAppendMessageAuth(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name            string
+		dst             []byte
+		encryptedHeader []byte
+		associatedData  []byte
+		auth            []byte
+		expected        []byte
+	}{
+		{"zero args", nil, nil, nil, nil, []byte{0, 0, 0}},
+		{"full args", []byte{9}, []byte{1, 2}, []byte{3}, []byte{4, 5, 6}, []byte{9, 2, 1, 2, 1, 3, 3, 4, 5, 6}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			auth := AppendMessageAuth(test.dst, test.encryptedHeader, test.associatedData, test.auth)
+			if !bytes.Equal(auth, test.expected) {
+				t.Fatalf("AppendMessageAuth(): expected %v but got %v", test.expected, auth)
+			}
+		})
+	}
+
+	t.Run("different splits", func(t *testing.T) {
+		t.Parallel()
+
+		first := AppendMessageAuth(nil, []byte{1, 2}, []byte{3}, nil)
+		second := AppendMessageAuth(nil, []byte{1}, []byte{2, 3}, nil)
+
+		if bytes.Equal(first, second) {
+			t.Fatalf("AppendMessageAuth(): returned the same bytes %v for different splits", first)
+		}
+	})
+}
@@ -3,42 +3,144 @@ package messagechainscommon
 import (
 	"fmt"
 	"hash"
-	"io"
+	"sync"
 
 	"golang.org/x/crypto/blake2b"
 	cipher "golang.org/x/crypto/chacha20poly1305"
-	"golang.org/x/crypto/hkdf"
 
 	"github.com/platform-inf/go-ratchet/keys"
 )
 
 const cryptoMessageCipherKDFOutputLen = cipher.KeySize + cipher.NonceSizeX
 
+const (
+	macInnerPad = 0x36
+	macOuterPad = 0x5c
+)
+
 var (
-	cryptoMessageCipherKDFSalt = make([]byte, cryptoMessageCipherKDFOutputLen)
-	cryptoMessageCipherKDFInfo = []byte("message cipher")
+	cryptoMessageCipherKDFSalt    = make([]byte, cryptoMessageCipherKDFOutputLen)
+	cryptoMessageCipherKDFInfo    = []byte("message cipher")
+	cryptoMessageCipherKDFCounter = []byte{0x01}
+
+	cryptoMessageKeyByte       = []byte{0x01}
+	cryptoMessageMasterKeyByte = []byte{0x02}
 )
 
-func DeriveMessageCipherKeyAndNonce(messageKey keys.Message) ([]byte, []byte, error) {
-	var newHashErr error
+// macStates holds HMAC-BLAKE2b-512 states, which are reused between calls to reduce allocations.
+var macStates sync.Pool
+
+type macState struct {
+	inner hash.Hash
+	outer hash.Hash
 
-	getHasher := func() hash.Hash {
-		var hasher hash.Hash
-		hasher, newHashErr = blake2b.New512(nil)
+	keySum [blake2b.Size]byte
+	inPad  [blake2b.BlockSize]byte
+	outPad [blake2b.BlockSize]byte
+	sum    [blake2b.Size]byte
+}
 
-		return hasher
+// AdvanceChain derives the next message master key and the message key with HMAC-BLAKE2b-512.
+func AdvanceChain(masterKey keys.MessageMaster) (keys.MessageMaster, keys.Message, error) {
+	state, err := getMACState()
+	if err != nil {
+		return keys.MessageMaster{}, keys.Message{}, err
 	}
 
-	kdf := hkdf.New(getHasher, messageKey.Bytes, cryptoMessageCipherKDFSalt, cryptoMessageCipherKDFInfo)
+	defer putMACState(state)
+
+	// Note that both keys share one buffer to reduce allocations.
+	output := make([]byte, 0, 2*blake2b.Size)
+
+	state.start(masterKey.Bytes)
+	state.inner.Write(cryptoMessageMasterKeyByte)
+	output = state.appendSum(output)
 
-	output := make([]byte, cryptoMessageCipherKDFOutputLen)
-	if _, err := io.ReadFull(kdf, output); err != nil {
+	state.start(masterKey.Bytes)
+	state.inner.Write(cryptoMessageKeyByte)
+	output = state.appendSum(output)
+
+	return keys.MessageMaster{Bytes: output[:blake2b.Size:blake2b.Size]}, keys.Message{Bytes: output[blake2b.Size:]}, nil
+}
+
+// DeriveMessageCipherKeyAndNonce derives cipher key and nonce of the message with HKDF-BLAKE2b-512.
+func DeriveMessageCipherKeyAndNonce(messageKey keys.Message) ([]byte, []byte, error) {
+	state, err := getMACState()
+	if err != nil {
 		return nil, nil, fmt.Errorf("KDF: %w", err)
 	}
 
-	if newHashErr != nil {
-		return nil, nil, fmt.Errorf("new hash: %w", newHashErr)
-	}
+	defer putMACState(state)
+
+	state.start(cryptoMessageCipherKDFSalt)
+	state.inner.Write(messageKey.Bytes)
+	pseudorandomKey := state.appendSum(state.sum[:0])
+
+	// Note that the output is shorter than the hash, so the first expanded block is enough.
+	state.start(pseudorandomKey)
+	state.inner.Write(cryptoMessageCipherKDFInfo)
+	state.inner.Write(cryptoMessageCipherKDFCounter)
+	output := state.appendSum(make([]byte, 0, blake2b.Size))[:cryptoMessageCipherKDFOutputLen]
 
 	return output[:cipher.KeySize], output[cipher.KeySize:], nil
 }
+
+func getMACState() (*macState, error) {
+	if state, ok := macStates.Get().(*macState); ok {
+		return state, nil
+	}
+
+	inner, err := blake2b.New512(nil)
+	if err != nil {
+		return nil, fmt.Errorf("new hash: %w", err)
+	}
+
+	outer, err := blake2b.New512(nil)
+	if err != nil {
+		return nil, fmt.Errorf("new hash: %w", err)
+	}
+
+	return &macState{inner: inner, outer: outer}, nil
+}
+
+func putMACState(state *macState) {
+	state.inner.Reset()
+	state.outer.Reset()
+	clear(state.keySum[:])
+	clear(state.inPad[:])
+	clear(state.outPad[:])
+	clear(state.sum[:])
+
+	macStates.Put(state)
+}
+
+// appendSum appends MAC of the data written since start to dst. Note that dst may alias the state sum.
+func (s *macState) appendSum(dst []byte) []byte {
+	innerSum := s.inner.Sum(s.sum[:0])
+
+	s.outer.Reset()
+	s.outer.Write(s.outPad[:])
+	s.outer.Write(innerSum)
+
+	return s.outer.Sum(dst)
+}
+
+// start resets the state to compute MAC with passed key. Note that key may alias the state sum.
+func (s *macState) start(key []byte) {
+	if len(key) > blake2b.BlockSize {
+		s.inner.Reset()
+		s.inner.Write(key)
+		key = s.inner.Sum(s.keySum[:0])
+	}
+
+	clear(s.inPad[copy(s.inPad[:], key):])
+	s.outPad = s.inPad
+
+	for i := range s.inPad {
+		s.inPad[i] ^= macInnerPad
+		s.outPad[i] ^= macOuterPad
+	}
+
+	s.inner.Reset()
+	s.inner.Write(s.inPad[:])
+}
@@ -1,11 +1,57 @@
 package messagechainscommon
 
 import (
+	"bytes"
+	"crypto/hmac"
+	"hash"
+	"io"
 	"testing"
 
+	"golang.org/x/crypto/blake2b"
+	cipher "golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/hkdf"
+
 	"github.com/platform-inf/go-ratchet/keys"
 )
 
+func TestAdvanceChain(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		masterKey keys.MessageMaster
+	}{
+		{"zero key", keys.MessageMaster{}},
+		{"full key", keys.MessageMaster{Bytes: []byte{1, 2, 3}}},
+		{"key longer than block", keys.MessageMaster{Bytes: bytes.Repeat([]byte{1}, 2*blake2b.BlockSize)}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			masterKey, messageKey, err := AdvanceChain(test.masterKey)
+			if err != nil {
+				t.Fatalf("AdvanceChain(%+v): expected no error but got %v", test.masterKey, err)
+			}
+
+			mac := hmac.New(newTestHasher, test.masterKey.Bytes)
+			mac.Write(cryptoMessageMasterKeyByte)
+
+			if expected := mac.Sum(nil); !bytes.Equal(masterKey.Bytes, expected) {
+				t.Fatalf("AdvanceChain(%+v): expected master key %v but got %v", test.masterKey, expected, masterKey.Bytes)
+			}
+
+			mac.Reset()
+			mac.Write(cryptoMessageKeyByte)
+
+			if expected := mac.Sum(nil); !bytes.Equal(messageKey.Bytes, expected) {
+				t.Fatalf("AdvanceChain(%+v): expected message key %v but got %v", test.masterKey, expected, messageKey.Bytes)
+			}
+		})
+	}
+}
+
 func TestDeriveMessageCipherKeyAndNonce(t *testing.T) {
 	t.Parallel()
 
@@ -34,6 +80,24 @@ func TestDeriveMessageCipherKeyAndNonce(t *testing.T) {
 			if len(cipherNonce) == 0 {
 				t.Fatalf("DeriveMessageCipherKeyAndNonce(%+v): returned empty cipher nonce", test.messageKey)
 			}
+
+			kdf := hkdf.New(newTestHasher, test.messageKey.Bytes, cryptoMessageCipherKDFSalt, cryptoMessageCipherKDFInfo)
+
+			expected := make([]byte, cryptoMessageCipherKDFOutputLen)
+			if _, err := io.ReadFull(kdf, expected); err != nil {
+				t.Fatalf("hkdf.New(): expected no error but got %v", err)
+			}
+
+			if !bytes.Equal(cipherKey, expected[:cipher.KeySize]) || !bytes.Equal(cipherNonce, expected[cipher.KeySize:]) {
+				t.Fatalf(
+					"DeriveMessageCipherKeyAndNonce(%+v): expected %v but got %v and %v",
+					test.messageKey, expected, cipherKey, cipherNonce)
+			}
 		})
 	}
 }
+
+func newTestHasher() hash.Hash {
+	hasher, _ := blake2b.New512(nil)
+	return hasher
+}
@@ -0,0 +1,106 @@
+package ratchet
+
+import (
+	"errors"
+	"time"
+
+	"github.com/platform-inf/go-ratchet/receivingchain"
+)
+
+// Names of metrics reported to Metrics.
+const (
+	MetricDHRatchetSteps     = "dh_ratchet_steps"
+	MetricDecryptDuration    = "decrypt_duration"
+	MetricDecryptFailures    = "decrypt_failures"
+	MetricEncryptDuration    = "encrypt_duration"
+	MetricEncryptFailures    = "encrypt_failures"
+	MetricMessagesDecrypted  = "messages_decrypted"
+	MetricMessagesEncrypted  = "messages_encrypted"
+	MetricSkippedKeysEvicted = "skipped_keys_evicted"
+	MetricSkippedKeysStored  = "skipped_keys_stored"
+	MetricSkippedKeysUsed    = "skipped_keys_used"
+)
+
+// Metrics collects metrics of ratchets. Note that one Metrics is usually shared by many ratchets, so it must be safe
+// for concurrent use.
+type Metrics interface {
+	// AddCounter must add delta to the counter with the passed name and label. Label is empty for counters without
+	// labels, e.g. the cause of decryption failure is the label of MetricDecryptFailures.
+	AddCounter(name, label string, delta uint64)
+
+	// ObserveDuration must add the duration to the histogram with the passed name.
+	ObserveDuration(name string, duration time.Duration)
+}
+
+// metricsObserver counts the ratchet lifecycle events and passes them to the next observer.
+type metricsObserver struct {
+	metrics Metrics
+	next    Observer
+}
+
+func newMetricsObserver(metrics Metrics, next Observer) Observer {
+	if next == nil {
+		next = NopObserver{}
+	}
+
+	return withMissingMessagesForwarding(metricsObserver{metrics: metrics, next: next}, next)
+}
+
+func (o metricsObserver) OnDHRatchet(direction Direction, epoch uint64) {
+	o.metrics.AddCounter(MetricDHRatchetSteps, direction.String(), 1)
+	o.next.OnDHRatchet(direction, epoch)
+}
+
+func (o metricsObserver) OnDecryptFailure(err error) {
+	o.metrics.AddCounter(MetricDecryptFailures, decryptFailureCause(err), 1)
+	o.next.OnDecryptFailure(err)
+}
+
+func (o metricsObserver) OnKeysSkipped(headerKeyFingerprint string, from, to uint64) {
+	o.metrics.AddCounter(MetricSkippedKeysStored, "", to-from)
+	o.next.OnKeysSkipped(headerKeyFingerprint, from, to)
+}
+
+func (o metricsObserver) OnSkippedKeyUsed(headerKeyFingerprint string, messageNumber uint64) {
+	o.metrics.AddCounter(MetricSkippedKeysUsed, "", 1)
+	o.next.OnSkippedKeyUsed(headerKeyFingerprint, messageNumber)
+}
+
+func (o metricsObserver) OnSkippedKeysEvicted(count int) {
+	o.metrics.AddCounter(MetricSkippedKeysEvicted, "", uint64(count))
+	o.next.OnSkippedKeysEvicted(count)
+}
+
+// decryptFailureCause returns label of MetricDecryptFailures by decryption failure reason.
+func decryptFailureCause(err error) string {
+	var decryptErr *receivingchain.DecryptError
+	if errors.As(err, &decryptErr) {
+		return decryptErr.Reason.String()
+	}
+
+	return receivingchain.DecryptReasonUnknown.String()
+}
+
+func (r *Ratchet) recordDecrypt(start time.Time, err error) {
+	// Note that decryption failures are counted by the metrics observer.
+	if r.cfg.metrics == nil || err != nil {
+		return
+	}
+
+	r.cfg.metrics.AddCounter(MetricMessagesDecrypted, "", 1)
+	r.cfg.metrics.ObserveDuration(MetricDecryptDuration, time.Since(start))
+}
+
+func (r *Ratchet) recordEncrypt(start time.Time, err error) {
+	if r.cfg.metrics == nil {
+		return
+	}
+
+	if err != nil {
+		r.cfg.metrics.AddCounter(MetricEncryptFailures, "", 1)
+		return
+	}
+
+	r.cfg.metrics.AddCounter(MetricMessagesEncrypted, "", 1)
+	r.cfg.metrics.ObserveDuration(MetricEncryptDuration, time.Since(start))
+}
@@ -0,0 +1,20 @@
+package ratchet
+
+import (
+	"fmt"
+
+	"github.com/platform-inf/go-ratchet/receivingchain"
+)
+
+// MissingMessages returns messages, which are skipped, but not decrypted yet, sorted by receiving epoch and message
+// number. Use it to request re-delivery of these messages. Observer reports when they are filled or expire.
+//
+// Note that the receiving epoch is the same as in DecryptResult.
+func (r Ratchet) MissingMessages() ([]receivingchain.MissingMessage, error) {
+	messages, err := r.receivingChain.MissingMessages()
+	if err != nil {
+		return nil, fmt.Errorf("receiving chain: %w", err)
+	}
+
+	return messages, nil
+}
@@ -0,0 +1,88 @@
+package ratchet
+
+import "github.com/platform-inf/go-ratchet/receivingchain"
+
+// Direction is the direction of the chain, which is upgraded by Diffie-Hellman ratchet step.
+type Direction int
+
+const (
+	DirectionSending Direction = iota + 1
+	DirectionReceiving
+)
+
+func (d Direction) String() string {
+	switch d {
+	case DirectionSending:
+		return "sending"
+	case DirectionReceiving:
+		return "receiving"
+	default:
+		return "unknown"
+	}
+}
+
+// Observer receives events of the ratchet lifecycle. Keys are identified by their fingerprints. Implement
+// receivingchain.MissingMessagesObserver to receive changes of missing messages too.
+//
+// Note that events are reported only after the ratchet state is committed, so events of failed Encrypt and Decrypt
+// calls are never reported except OnDecryptFailure. Observer must not call the ratchet.
+type Observer interface {
+	receivingchain.Observer
+
+	// OnDHRatchet is called when Diffie-Hellman ratchet step upgrades the chain of the passed direction. Epoch is the
+	// number of Diffie-Hellman ratchet steps including this one.
+	OnDHRatchet(direction Direction, epoch uint64)
+
+	// OnDecryptFailure is called when Decrypt fails. The ratchet state is not changed in this case.
+	OnDecryptFailure(err error)
+}
+
+// NopObserver ignores all events. Embed it to implement only the needed Observer methods.
+type NopObserver struct{}
+
+func (NopObserver) OnDHRatchet(Direction, uint64)        {}
+func (NopObserver) OnDecryptFailure(error)               {}
+func (NopObserver) OnKeysSkipped(string, uint64, uint64) {}
+func (NopObserver) OnSkippedKeyUsed(string, uint64)      {}
+func (NopObserver) OnSkippedKeysEvicted(int)             {}
+
+// missingMessagesForwarder passes events of missing messages, which the wrapping observer does not handle, to the
+// next observer.
+type missingMessagesForwarder struct {
+	Observer
+
+	next receivingchain.MissingMessagesObserver
+}
+
+// withMissingMessagesForwarding makes the wrapping observer implement receivingchain.MissingMessagesObserver only if
+// the next observer implements it, so missing messages are not resolved for nothing.
+func withMissingMessagesForwarding(observer Observer, next Observer) Observer {
+	if missingMessagesObserver, ok := next.(receivingchain.MissingMessagesObserver); ok {
+		return missingMessagesForwarder{Observer: observer, next: missingMessagesObserver}
+	}
+
+	return observer
+}
+
+func (f missingMessagesForwarder) OnMissingMessageFilled(message receivingchain.MissingMessage) {
+	f.next.OnMissingMessageFilled(message)
+}
+
+func (f missingMessagesForwarder) OnMissingMessagesExpired(messages []receivingchain.MissingMessage) {
+	f.next.OnMissingMessagesExpired(messages)
+}
+
+func (r *Ratchet) notifyDHRatchet(direction Direction) {
+	if r.cfg.observer == nil {
+		return
+	}
+
+	observer, epoch := r.cfg.observer, r.rootChain.Epoch()
+	r.cfg.journal.OnCommit(func() { observer.OnDHRatchet(direction, epoch) })
+}
+
+func (r *Ratchet) notifyDecryptFailure(err error) {
+	if r.cfg.observer != nil {
+		r.cfg.observer.OnDecryptFailure(err)
+	}
+}
@@ -0,0 +1,128 @@
+// Package padding hides exact length of message data. Data is padded with ISO/IEC 7816-4 scheme: the 0x80 byte
+// followed by zero bytes. Padded length is chosen by Scheme.
+package padding
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"math/bits"
+	"slices"
+
+	"github.com/platform-inf/go-ratchet/errlist"
+)
+
+const startByte = 0x80
+
+// Scheme chooses padded length of data.
+type Scheme interface {
+	// PaddedLen must return padded length, which is greater than the passed data length, because at least one byte of
+	// padding is always added. It must be deterministic.
+	PaddedLen(dataLen int) int
+}
+
+// Append appends data padded according to the scheme to dst and returns the extended buffer.
+func Append(dst, data []byte, scheme Scheme) []byte {
+	paddedLen := scheme.PaddedLen(len(data))
+
+	dst = slices.Grow(dst, paddedLen)
+	dst = append(dst, data...)
+	dst = append(dst, startByte)
+
+	return append(dst, make([]byte, paddedLen-len(data)-1)...)
+}
+
+// Strip returns padded data without padding added by Append with the same scheme. Note that the returned slice shares
+// memory with the passed one.
+//
+// Padding is found in constant time, which depends only on the padded length.
+func Strip(padded []byte, scheme Scheme) ([]byte, error) {
+	paddingStart := 0
+	found := 0
+	invalid := 0
+
+	for i := len(padded) - 1; i >= 0; i-- {
+		isZero := subtle.ConstantTimeByteEq(padded[i], 0)
+		isStart := subtle.ConstantTimeByteEq(padded[i], startByte)
+		isFirstStart := isStart & (found ^ 1)
+
+		paddingStart = subtle.ConstantTimeSelect(isFirstStart, i, paddingStart)
+		invalid |= (found ^ 1) & (isZero ^ 1) & (isStart ^ 1)
+		found |= isStart
+	}
+
+	if found == 0 || invalid == 1 || scheme.PaddedLen(paddingStart) != len(padded) {
+		return nil, fmt.Errorf("%w: invalid padding", errlist.ErrInvalidValue)
+	}
+
+	return padded[:paddingStart], nil
+}
+
+// BlockScheme pads data to a multiple of the block size.
+type BlockScheme struct {
+	size int
+}
+
+func NewBlockScheme(size int) (BlockScheme, error) {
+	if size <= 0 {
+		return BlockScheme{}, fmt.Errorf("%w: non-positive block size %d", errlist.ErrInvalidValue, size)
+	}
+
+	return BlockScheme{size: size}, nil
+}
+
+func (s BlockScheme) PaddedLen(dataLen int) int {
+	return (dataLen/s.size + 1) * s.size
+}
+
+// BucketsScheme pads data to the smallest bucket size, which is enough for the data. Data, which does not fit into the
+// largest bucket, is padded to a multiple of the largest bucket size.
+type BucketsScheme struct {
+	sizes []int
+}
+
+func NewBucketsScheme(sizes ...int) (BucketsScheme, error) {
+	if len(sizes) == 0 {
+		return BucketsScheme{}, fmt.Errorf("%w: no bucket sizes", errlist.ErrInvalidValue)
+	}
+
+	sizes = slices.Clone(sizes)
+	slices.Sort(sizes)
+
+	if sizes[0] <= 0 {
+		return BucketsScheme{}, fmt.Errorf("%w: non-positive bucket size %d", errlist.ErrInvalidValue, sizes[0])
+	}
+
+	return BucketsScheme{sizes: slices.Compact(sizes)}, nil
+}
+
+func (s BucketsScheme) PaddedLen(dataLen int) int {
+	for _, size := range s.sizes {
+		if dataLen < size {
+			return size
+		}
+	}
+
+	largestSize := s.sizes[len(s.sizes)-1]
+
+	return (dataLen/largestSize + 1) * largestSize
+}
+
+// PadmeScheme pads data with Padmé scheme, which leaks O(log log L) bits of the data length L with at most 12% of
+// overhead. See https://petsymposium.org/popets/2019/popets-2019-0056.pdf.
+type PadmeScheme struct{}
+
+func (s PadmeScheme) PaddedLen(dataLen int) int {
+	// Note that the length with the padding start byte is rounded.
+	length := dataLen + 1
+
+	exponent := bits.Len(uint(length)) - 1
+	lastBitsCount := exponent - bits.Len(uint(exponent))
+
+	if lastBitsCount <= 0 {
+		return length
+	}
+
+	mask := 1<<lastBitsCount - 1
+
+	return (length + mask) &^ mask
+}
@@ -0,0 +1,106 @@
+package padding
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/platform-inf/go-ratchet/errlist"
+)
+
+func TestSchemes(t *testing.T) {
+	t.Parallel()
+
+	blockScheme, err := NewBlockScheme(16)
+	if err != nil {
+		t.Fatalf("NewBlockScheme(): expected no error but got %v", err)
+	}
+
+	bucketsScheme, err := NewBucketsScheme(256, 32, 64, 32)
+	if err != nil {
+		t.Fatalf("NewBucketsScheme(): expected no error but got %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		scheme     Scheme
+		dataLens   []int
+		paddedLens []int
+	}{
+		{"block", blockScheme, []int{0, 15, 16, 100}, []int{16, 16, 32, 112}},
+		{"buckets", bucketsScheme, []int{0, 31, 32, 100, 255, 256, 600}, []int{32, 32, 64, 256, 256, 512, 768}},
+		{"padme", PadmeScheme{}, []int{0, 1, 7, 8, 99, 1000, 100000}, []int{1, 2, 8, 10, 104, 1024, 100352}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			for i, dataLen := range test.dataLens {
+				data := bytes.Repeat([]byte{0x80}, dataLen)
+
+				padded := Append([]byte{1, 2}, data, test.scheme)
+				if len(padded) != 2+test.paddedLens[i] {
+					t.Fatalf("Append(%d): expected padded length %d but got %d", dataLen, test.paddedLens[i], len(padded)-2)
+				}
+
+				stripped, err := Strip(padded[2:], test.scheme)
+				if err != nil {
+					t.Fatalf("Strip(%d): expected no error but got %v", dataLen, err)
+				}
+
+				if !bytes.Equal(stripped, data) {
+					t.Fatalf("Strip(%d): expected %v but got %v", dataLen, data, stripped)
+				}
+			}
+		})
+	}
+}
+
+func TestStrip(t *testing.T) {
+	t.Parallel()
+
+	blockScheme, err := NewBlockScheme(4)
+	if err != nil {
+		t.Fatalf("NewBlockScheme(): expected no error but got %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		padded []byte
+	}{
+		{"nil padded", nil},
+		{"no padding start byte", []byte{1, 0, 0, 0}},
+		{"zero bytes only", []byte{0, 0, 0, 0}},
+		{"non-zero padding byte", []byte{1, 0x80, 0, 1}},
+		{"wrong padded length", []byte{1, 0x80, 0, 0, 0, 0, 0, 0}},
+		{"not multiple of block size", []byte{1, 2, 0x80}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := Strip(test.padded, blockScheme)
+			if !errors.Is(err, errlist.ErrInvalidValue) || err.Error() != "invalid value: invalid padding" {
+				t.Fatalf("Strip(%v): expected invalid padding error but got %v", test.padded, err)
+			}
+		})
+	}
+}
+
+func TestNewSchemeErrors(t *testing.T) {
+	t.Parallel()
+
+	if _, err := NewBlockScheme(0); err == nil || err.Error() != "invalid value: non-positive block size 0" {
+		t.Fatalf("NewBlockScheme(0): expected error but got %v", err)
+	}
+
+	if _, err := NewBucketsScheme(); err == nil || err.Error() != "invalid value: no bucket sizes" {
+		t.Fatalf("NewBucketsScheme(): expected error but got %v", err)
+	}
+
+	if _, err := NewBucketsScheme(16, -1); err == nil || err.Error() != "invalid value: non-positive bucket size -1" {
+		t.Fatalf("NewBucketsScheme(16, -1): expected error but got %v", err)
+	}
+}
@@ -1,30 +1,51 @@
+// Package ratchet implements the Double Ratchet algorithm for end-to-end encrypted conversations.
+//
+// Ratchets, chains and keys implement fmt.Formatter, fmt.GoStringer, fmt.Stringer and slog.LogValuer, which print only
+// non-secret state and key fingerprints. So secrets never leak through formatting or logging with any verb.
 package ratchet
 
 import (
+	"bytes"
 	"fmt"
+	"slices"
+	"time"
 
 	"github.com/platform-inf/go-ratchet/errlist"
+	"github.com/platform-inf/go-ratchet/header"
+	"github.com/platform-inf/go-ratchet/journal"
 	"github.com/platform-inf/go-ratchet/keys"
 	"github.com/platform-inf/go-ratchet/receivingchain"
 	"github.com/platform-inf/go-ratchet/rootchain"
 	"github.com/platform-inf/go-ratchet/sendingchain"
-	"github.com/platform-inf/go-utils"
+	"github.com/platform-inf/go-ratchet/verification"
 )
 
 // Ratchet is the participant of the conversation.
 //
+// Ratchet takes ownership of the keys passed to its constructors and wipes them as soon as they are superseded. Call
+// Destroy when the ratchet is no longer needed to wipe the remaining keys.
+//
 // Please note that the structure is not safe for concurrent programs.
 type Ratchet struct {
 	localPrivateKey         keys.Private
 	localPublicKey          keys.Public
+	nextLocalPrivateKey     *keys.Private
+	nextLocalPublicKey      *keys.Public
 	remotePublicKey         *keys.Public
 	rootChain               rootchain.Chain
 	sendingChain            sendingchain.Chain
 	receivingChain          receivingchain.Chain
 	needSendingChainRatchet bool
+	sendingChainRatchetedAt time.Time
 	cfg                     config
 }
 
+// NewRecipient creates the ratchet of the participant, who receives the first message.
+//
+// Note that the ratchet takes ownership of the passed keys: the private key is moved to the keys allocator, and the
+// private, root and header keys are wiped once superseded. So pass clones of keys, which are still needed, e.g. by the
+// remote participant in tests.
+//
 // TODO: try to reduce arguments count.
 func NewRecipient(
 	localPrivateKey keys.Private,
@@ -39,23 +60,23 @@ func NewRecipient(
 		return Ratchet{}, fmt.Errorf("new config: %w", err)
 	}
 
-	rootChain, err := rootchain.New(rootKey, cfg.rootOptions...)
+	rootChain, err := rootchain.New(rootKey, cfg.allRootOptions()...)
 	if err != nil {
 		return Ratchet{}, fmt.Errorf("new root chain: %w", err)
 	}
 
-	sendingChain, err := sendingchain.New(nil, nil, sendingChainNextHeaderKey, 0, 0, cfg.sendingOptions...)
+	sendingChain, err := sendingchain.New(nil, nil, sendingChainNextHeaderKey, 0, 0, cfg.allSendingOptions()...)
 	if err != nil {
 		return Ratchet{}, fmt.Errorf("new sending chain: %w", err)
 	}
 
-	receivingChain, err := receivingchain.New(nil, nil, receivingChainNextHeaderKey, 0, cfg.receivingOptions...)
+	receivingChain, err := receivingchain.New(nil, nil, receivingChainNextHeaderKey, 0, cfg.allReceivingOptions()...)
 	if err != nil {
 		return Ratchet{}, fmt.Errorf("new receiving chain: %w", err)
 	}
 
 	ratchet := Ratchet{
-		localPrivateKey: localPrivateKey,
+		localPrivateKey: localPrivateKey.MoveTo(cfg.keysAllocator),
 		localPublicKey:  localPublicKey,
 		rootChain:       rootChain,
 		sendingChain:    sendingChain,
@@ -66,6 +87,11 @@ func NewRecipient(
 	return ratchet, nil
 }
 
+// NewSender creates the ratchet of the participant, who sends the first message.
+//
+// Note that the ratchet takes ownership of the passed keys: the root and header keys are wiped once superseded. So pass
+// clones of keys, which are still needed, e.g. by the remote participant in tests.
+//
 // TODO: try to reduce arguments count.
 func NewSender(
 	remotePublicKey keys.Public,
@@ -79,17 +105,23 @@ func NewSender(
 		return Ratchet{}, fmt.Errorf("new config: %w", err)
 	}
 
+	if err := validatePublicKey(cfg.crypto, remotePublicKey); err != nil {
+		return Ratchet{}, fmt.Errorf("remote public key: %w", err)
+	}
+
 	localPrivateKey, localPublicKey, err := cfg.crypto.GenerateKeyPair()
 	if err != nil {
 		return Ratchet{}, fmt.Errorf("%w: generate key pair: %w", errlist.ErrCrypto, err)
 	}
 
-	sharedKey, err := cfg.crypto.ComputeSharedKey(localPrivateKey, remotePublicKey)
+	sharedKey, err := computeSharedKey(cfg.crypto, localPrivateKey, remotePublicKey)
 	if err != nil {
 		return Ratchet{}, fmt.Errorf("%w: compute shared key: %w", errlist.ErrCrypto, err)
 	}
 
-	rootChain, err := rootchain.New(rootKey, cfg.rootOptions...)
+	defer sharedKey.Wipe()
+
+	rootChain, err := rootchain.New(rootKey, cfg.allRootOptions()...)
 	if err != nil {
 		return Ratchet{}, fmt.Errorf("new root chain: %w", err)
 	}
@@ -100,72 +132,237 @@ func NewSender(
 	}
 
 	sendingChain, err := sendingchain.New(
-		&sendingChainKey, &sendingChainHeaderKey, sendingChainNextHeaderKey, 0, 0, cfg.sendingOptions...)
+		&sendingChainKey, &sendingChainHeaderKey, sendingChainNextHeaderKey, 0, 0, cfg.allSendingOptions()...)
 	if err != nil {
+		cfg.journal.Rollback()
 		return Ratchet{}, fmt.Errorf("new sending chain: %w", err)
 	}
 
-	receivingChain, err := receivingchain.New(nil, nil, receivingChainNextHeaderKey, 0, cfg.receivingOptions...)
+	receivingChain, err := receivingchain.New(nil, nil, receivingChainNextHeaderKey, 0, cfg.allReceivingOptions()...)
 	if err != nil {
+		cfg.journal.Rollback()
 		return Ratchet{}, fmt.Errorf("new receiving chain: %w", err)
 	}
 
+	// Note that the root chain records the advance in the journal, so it is committed here. Otherwise the first failed
+	// decryption would roll the advance back and wipe the current root key.
+	if err := cfg.journal.Commit(); err != nil {
+		return Ratchet{}, fmt.Errorf("commit: %w", err)
+	}
+
 	ratchet := Ratchet{
-		localPrivateKey: localPrivateKey,
-		localPublicKey:  localPublicKey,
-		remotePublicKey: &remotePublicKey,
-		rootChain:       rootChain,
-		sendingChain:    sendingChain,
-		receivingChain:  receivingChain,
-		cfg:             cfg,
+		localPrivateKey:         localPrivateKey.MoveTo(cfg.keysAllocator),
+		localPublicKey:          localPublicKey,
+		remotePublicKey:         &remotePublicKey,
+		rootChain:               rootChain,
+		sendingChain:            sendingChain,
+		receivingChain:          receivingChain,
+		sendingChainRatchetedAt: cfg.now(),
+		cfg:                     cfg,
 	}
 
 	return ratchet, nil
 }
 
+// AssociatedData returns associated data of the conversation set by WithAssociatedData.
+func (r Ratchet) AssociatedData() []byte {
+	return slices.Clone(r.cfg.associatedData)
+}
+
 func (r Ratchet) Clone() Ratchet {
-	r.localPrivateKey = r.localPrivateKey.Clone()
+	r.localPrivateKey = r.localPrivateKey.CloneWith(r.cfg.keysAllocator)
 	r.localPublicKey = r.localPublicKey.Clone()
 	r.remotePublicKey = r.remotePublicKey.ClonePtr()
-	r.rootChain = r.rootChain.Clone()
-	r.sendingChain = r.sendingChain.Clone()
-	r.receivingChain = r.receivingChain.Clone()
+
+	if r.nextLocalPrivateKey != nil {
+		nextLocalPrivateKey := r.nextLocalPrivateKey.CloneWith(r.cfg.keysAllocator)
+		r.nextLocalPrivateKey = &nextLocalPrivateKey
+		r.nextLocalPublicKey = r.nextLocalPublicKey.ClonePtr()
+	}
+
+	// Note that the clone gets its own journal, so the clone and the ratchet may be used concurrently.
+	r.cfg.journal = &journal.Journal{}
+	r.rootChain = r.rootChain.CloneWithJournal(r.cfg.journal)
+	r.sendingChain = r.sendingChain.CloneWithJournal(r.cfg.journal)
+	r.receivingChain = r.receivingChain.CloneWithJournal(r.cfg.journal)
 
 	return r
 }
 
-func (r *Ratchet) Decrypt(encryptedHeader, encryptedData, auth []byte) (data []byte, err error) {
-	err = utils.UpdateWithTx(r, r.Clone(), func(r *Ratchet) error {
-		data, err = r.receivingChain.Decrypt(encryptedHeader, encryptedData, auth, r.ratchetReceivingChain)
-		return err
-	})
+func (r *Ratchet) Decrypt(encryptedHeader, encryptedData, auth []byte) ([]byte, error) {
+	return r.DecryptTo(nil, encryptedHeader, encryptedData, auth)
+}
 
+// DecryptTo appends decrypted data to dst and returns the extended buffer. Reuse dst across calls to avoid allocations.
+func (r *Ratchet) DecryptTo(dst, encryptedHeader, encryptedData, auth []byte) ([]byte, error) {
+	data, _, err := r.decryptTo(dst, encryptedHeader, encryptedData, auth)
 	return data, err
 }
 
-func (r *Ratchet) Encrypt(data, auth []byte) (encryptedHeader []byte, encryptedData []byte, err error) {
-	err = utils.UpdateWithTx(r, r.Clone(), func(r *Ratchet) error {
+// DecryptWithMetadata decrypts the message and returns metadata attached by EncryptWithMetadata. Note that metadata is
+// nil if the sender attached none.
+func (r *Ratchet) DecryptWithMetadata(encryptedHeader, encryptedData, auth []byte) ([]byte, []byte, error) {
+	data, info, err := r.decryptTo(nil, encryptedHeader, encryptedData, auth)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	metadata, _ := info.Header.Extension(header.ExtensionTypeApplication)
+
+	return data, slices.Clone(metadata), nil
+}
+
+// Destroy wipes all keys of the ratchet. The ratchet must not be used after destroying.
+func (r *Ratchet) Destroy() {
+	r.localPrivateKey.Free(r.cfg.keysAllocator)
+	r.nextLocalPrivateKey.Free(r.cfg.keysAllocator)
+	r.rootChain.Wipe()
+	r.sendingChain.Wipe()
+	r.receivingChain.Wipe()
+}
+
+func (r *Ratchet) Encrypt(data, auth []byte) ([]byte, []byte, error) {
+	return r.EncryptTo(nil, nil, data, auth)
+}
+
+// EncryptTo appends encrypted header and data to dstHeader and dstData and returns the extended buffers. Reuse the
+// buffers across calls to avoid allocations.
+func (r *Ratchet) EncryptTo(dstHeader, dstData, data, auth []byte) ([]byte, []byte, error) {
+	return r.encryptTo(dstHeader, dstData, data, nil, auth)
+}
+
+// EncryptWithMetadata encrypts the message and attaches application metadata to its header, so the metadata is
+// encrypted with the header key and authenticated with the message. Note that metadata changes the header length, so
+// use header padding with a block size, which fits the metadata, to hide it.
+func (r *Ratchet) EncryptWithMetadata(data, metadata, auth []byte) ([]byte, []byte, error) {
+	if metadata == nil {
+		metadata = []byte{}
+	}
+
+	return r.encryptTo(nil, nil, data, metadata, auth)
+}
+
+func (r *Ratchet) decryptTo(
+	dst []byte,
+	encryptedHeader []byte,
+	encryptedData []byte,
+	auth []byte,
+) (data []byte, info receivingchain.DecryptInfo, err error) {
+	start := time.Now()
+
+	decrypt := func(useNextLocalPrivateKey bool) (ratcheted bool, err error) {
+		err = r.updateWithTx(func(r *Ratchet) error {
+			ratchet := func(remotePublicKey keys.Public) error {
+				ratcheted = true
+				return r.ratchetReceivingChain(remotePublicKey, useNextLocalPrivateKey)
+			}
+
+			data, info, err = r.receivingChain.DecryptToWithInfo(dst, encryptedHeader, encryptedData, auth, ratchet)
+			if err != nil {
+				return err
+			}
+
+			return r.followRemoteRekey(info)
+		})
+
+		return ratcheted, err
+	}
+
+	useNextLocalPrivateKey := r.nextLocalPrivateKey != nil
+
+	// Note that the remote participant performs its step with the current public key if it has not received the next
+	// one before the step, which is known only when the message is authenticated.
+	ratcheted, err := decrypt(useNextLocalPrivateKey)
+	if useNextLocalPrivateKey && ratcheted && isForgedMessageError(err) {
+		_, err = decrypt(false)
+	}
+
+	if err != nil {
+		err = wrapDecryptError(err)
+		r.notifyDecryptFailure(err)
+	}
+
+	r.recordDecrypt(start, err)
+
+	return data, info, err
+}
+
+// encryptTo encrypts the message and attaches metadata to its header, if metadata is not nil.
+func (r *Ratchet) encryptTo(
+	dstHeader []byte,
+	dstData []byte,
+	data []byte,
+	metadata []byte,
+	auth []byte,
+) (encryptedHeader []byte, encryptedData []byte, err error) {
+	start := time.Now()
+
+	err = r.updateWithTx(func(r *Ratchet) error {
+		if err := r.applyRekeyPolicies(); err != nil {
+			return fmt.Errorf("apply rekey policies: %w", err)
+		}
+
 		if err := r.ratchetSendingChainIfNeeded(); err != nil {
 			return fmt.Errorf("ratchet sending chain: %w", err)
 		}
 
-		header := r.sendingChain.PrepareHeader(r.localPublicKey)
-		encryptedHeader, encryptedData, err = r.sendingChain.Encrypt(header, data, auth)
+		preparedHeader := r.sendingChain.PrepareHeader(r.localPublicKey)
+		if metadata != nil {
+			preparedHeader.Extensions = append(
+				preparedHeader.Extensions, header.Extension{Type: header.ExtensionTypeApplication, Value: metadata})
+		}
+
+		if r.nextLocalPublicKey != nil {
+			preparedHeader.Extensions = append(
+				preparedHeader.Extensions,
+				header.Extension{Type: header.ExtensionTypeNextPublicKey, Value: r.nextLocalPublicKey.Bytes},
+			)
+		}
+
+		encryptedHeader, encryptedData, err = r.sendingChain.EncryptTo(dstHeader, dstData, preparedHeader, data, auth)
 
 		return err
 	})
 
+	r.recordEncrypt(start, err)
+
 	return encryptedHeader, encryptedData, err
 }
 
-func (r *Ratchet) ratchetReceivingChain(remotePublicKey keys.Public) error {
+// ShortAuthenticationString returns the short authentication string of the current root chain epoch. Participants get
+// the same string at the same epoch, i.e. after the same Diffie-Hellman ratchet steps, so compare strings only if their
+// epochs are equal.
+func (r Ratchet) ShortAuthenticationString() (verification.ShortAuthenticationString, error) {
+	bytes, err := r.rootChain.DeriveShortAuthenticationString(verification.ShortAuthenticationStringBytesLen)
+	if err != nil {
+		return verification.ShortAuthenticationString{}, fmt.Errorf("derive from root chain: %w", err)
+	}
+
+	return verification.ShortAuthenticationString{Epoch: r.rootChain.Epoch(), Bytes: bytes}, nil
+}
+
+// ratchetReceivingChain performs the receiving step with the current or the next local private key, see Rekey.
+func (r *Ratchet) ratchetReceivingChain(remotePublicKey keys.Public, useNextLocalPrivateKey bool) error {
+	// Note that the remote participant must generate a new key pair for every step, so the same key means a bug or an
+	// attack.
+	if r.remotePublicKey != nil && bytes.Equal(r.remotePublicKey.Bytes, remotePublicKey.Bytes) {
+		return fmt.Errorf("%w: remote public key is not changed", errlist.ErrInvalidValue)
+	}
+
 	r.remotePublicKey = &remotePublicKey
 
-	sharedKey, err := r.cfg.crypto.ComputeSharedKey(r.localPrivateKey, remotePublicKey)
+	localPrivateKey := r.localPrivateKey
+	if useNextLocalPrivateKey {
+		localPrivateKey = *r.nextLocalPrivateKey
+	}
+
+	sharedKey, err := computeSharedKey(r.cfg.crypto, localPrivateKey, remotePublicKey)
 	if err != nil {
 		return fmt.Errorf("%w: compute shared secret key for receiving chain upgrade: %w", errlist.ErrCrypto, err)
 	}
 
+	defer sharedKey.Wipe()
+
 	newMasterKey, newNextHeaderKey, err := r.rootChain.Advance(sharedKey)
 	if err != nil {
 		return fmt.Errorf("advance root chain for receiving chain upgrade: %w", err)
@@ -174,6 +371,18 @@ func (r *Ratchet) ratchetReceivingChain(remotePublicKey keys.Public) error {
 	r.receivingChain.Upgrade(newMasterKey, newNextHeaderKey)
 	r.needSendingChainRatchet = true
 
+	// Note that the remote participant can not perform another step before it receives the sending step, which
+	// generates a new key pair anyway, so the next key pair is no longer needed.
+	if r.nextLocalPrivateKey != nil {
+		allocator := r.cfg.keysAllocator
+		nextLocalPrivateKey := r.nextLocalPrivateKey
+
+		r.cfg.journal.OnCommit(func() { nextLocalPrivateKey.Free(allocator) })
+
+		r.nextLocalPrivateKey, r.nextLocalPublicKey = nil, nil
+	}
+	r.notifyDHRatchet(DirectionReceiving)
+
 	return nil
 }
 
@@ -182,22 +391,31 @@ func (r *Ratchet) ratchetSendingChainIfNeeded() error {
 		return nil
 	}
 
-	var err error
-
-	r.localPrivateKey, r.localPublicKey, err = r.cfg.crypto.GenerateKeyPair()
+	localPrivateKey, localPublicKey, err := r.cfg.crypto.GenerateKeyPair()
 	if err != nil {
 		return fmt.Errorf("%w: generate new key pair: %w", errlist.ErrCrypto, err)
 	}
 
+	allocator := r.cfg.keysAllocator
+	oldLocalPrivateKey := r.localPrivateKey
+	localPrivateKey = localPrivateKey.MoveTo(allocator)
+
+	r.cfg.journal.OnCommit(func() { oldLocalPrivateKey.Free(allocator) })
+	r.cfg.journal.OnRollback(func() { localPrivateKey.Free(allocator) })
+
+	r.localPrivateKey, r.localPublicKey = localPrivateKey, localPublicKey
+
 	if r.remotePublicKey == nil {
 		return fmt.Errorf("%w: remote public key is nil", errlist.ErrInvalidValue)
 	}
 
-	sharedKey, err := r.cfg.crypto.ComputeSharedKey(r.localPrivateKey, *r.remotePublicKey)
+	sharedKey, err := computeSharedKey(r.cfg.crypto, r.localPrivateKey, *r.remotePublicKey)
 	if err != nil {
 		return fmt.Errorf("%w: compute shared secret key for sending chain upgrade: %w", errlist.ErrCrypto, err)
 	}
 
+	defer sharedKey.Wipe()
+
 	newMasterKey, newNextHeaderKey, err := r.rootChain.Advance(sharedKey)
 	if err != nil {
 		return fmt.Errorf("advance root chain for sending chain upgrade: %w", err)
@@ -205,6 +423,31 @@ func (r *Ratchet) ratchetSendingChainIfNeeded() error {
 
 	r.sendingChain.Upgrade(newMasterKey, newNextHeaderKey)
 	r.needSendingChainRatchet = false
+	r.sendingChainRatchetedAt = r.cfg.now()
+	r.notifyDHRatchet(DirectionSending)
+
+	return nil
+}
+
+// updateWithTx applies update to the ratchet and keeps the changes only if there are no errors.
+//
+// Note that the ratchet is copied shallowly, because chains never change keys in place: they record wiping of
+// superseded keys and changes of the skipped keys storage in the journal, which is committed or rolled back here.
+// Therefore, the cost of the transaction does not depend on the number of skipped keys.
+func (r *Ratchet) updateWithTx(update func(r *Ratchet) error) error {
+	snapshot := *r
+
+	if err := update(r); err != nil {
+		r.cfg.journal.Rollback()
+		*r = snapshot
+
+		return err
+	}
+
+	if err := r.cfg.journal.Commit(); err != nil {
+		*r = snapshot
+		return fmt.Errorf("commit: %w", err)
+	}
 
 	return nil
 }
@@ -0,0 +1,1776 @@
+package ratchet
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	cipher "golang.org/x/crypto/chacha20poly1305"
+
+	"github.com/platform-inf/go-ratchet/errlist"
+	"github.com/platform-inf/go-ratchet/keys"
+	"github.com/platform-inf/go-ratchet/padding"
+	"github.com/platform-inf/go-ratchet/receivingchain"
+)
+
+var testSenderHeaderKey = keys.Header{Bytes: bytes.Repeat([]byte{2}, 32)}
+
+func newTestRatchets(tb testing.TB, options ...Option) (Ratchet, Ratchet) {
+	tb.Helper()
+
+	return newTestRatchetsWithOptions(tb, options, options)
+}
+
+func newTestRatchetsWithOptions(tb testing.TB, senderOptions, recipientOptions []Option) (Ratchet, Ratchet) {
+	tb.Helper()
+
+	recipientPrivateKey, recipientPublicKey, err := newDefaultCrypto().GenerateKeyPair()
+	if err != nil {
+		tb.Fatalf("GenerateKeyPair(): expected no error but got %v", err)
+	}
+
+	rootKey := keys.Root{Bytes: bytes.Repeat([]byte{1}, 32)}
+	senderHeaderKey := testSenderHeaderKey.Clone()
+	recipientHeaderKey := keys.Header{Bytes: bytes.Repeat([]byte{3}, 32)}
+
+	sender, err := NewSender(
+		recipientPublicKey.Clone(), rootKey.Clone(), senderHeaderKey.Clone(), recipientHeaderKey.Clone(), senderOptions...)
+	if err != nil {
+		tb.Fatalf("NewSender(): expected no error but got %v", err)
+	}
+
+	recipient, err := NewRecipient(
+		recipientPrivateKey, recipientPublicKey, rootKey, recipientHeaderKey, senderHeaderKey, recipientOptions...)
+	if err != nil {
+		tb.Fatalf("NewRecipient(): expected no error but got %v", err)
+	}
+
+	return sender, recipient
+}
+
+// encryptTestMessages encrypts count messages, whose data is the message index.
+func encryptTestMessages(tb testing.TB, sender *Ratchet, count int) ([][]byte, [][]byte) {
+	tb.Helper()
+
+	encryptedHeaders := make([][]byte, count)
+	encryptedDatas := make([][]byte, count)
+
+	for i := range count {
+		var err error
+
+		encryptedHeaders[i], encryptedDatas[i], err = sender.Encrypt([]byte{byte(i)}, nil)
+		if err != nil {
+			tb.Fatalf("Encrypt(%d): expected no error but got %v", i, err)
+		}
+	}
+
+	return encryptedHeaders, encryptedDatas
+}
+
+func TestRatchetEncryptToAndDecryptTo(t *testing.T) {
+	t.Parallel()
+
+	sender, recipient := newTestRatchets(t)
+
+	headerPrefix := []byte{1, 2}
+	dataPrefix := []byte{3, 4, 5}
+
+	for i := range 3 {
+		data := []byte{byte(i), 6, 7, 8}
+		auth := []byte{9, byte(i)}
+
+		encryptedHeader, encryptedData, err := sender.EncryptTo(headerPrefix, dataPrefix, data, auth)
+		if err != nil {
+			t.Fatalf("EncryptTo(%v, %v, %v, %v): expected no error but got %v", headerPrefix, dataPrefix, data, auth, err)
+		}
+
+		if !bytes.HasPrefix(encryptedHeader, headerPrefix) || !bytes.HasPrefix(encryptedData, dataPrefix) {
+			t.Fatalf("EncryptTo(): prefixes are not kept: %v, %v", encryptedHeader, encryptedData)
+		}
+
+		decryptedData, err := recipient.DecryptTo(
+			dataPrefix, encryptedHeader[len(headerPrefix):], encryptedData[len(dataPrefix):], auth)
+		if err != nil {
+			t.Fatalf("DecryptTo(): expected no error but got %v", err)
+		}
+
+		if !bytes.Equal(decryptedData, append(dataPrefix, data...)) {
+			t.Fatalf("DecryptTo(): expected %v but got %v", append(dataPrefix, data...), decryptedData)
+		}
+	}
+}
+
+// benchmarkAllocsRuns is the count of messages, which benchmarks use to check allocations per message.
+const benchmarkAllocsRuns = 100
+
+func BenchmarkRatchetEncrypt(b *testing.B) {
+	sender, _ := newTestRatchets(b)
+	data := make([]byte, 256)
+
+	encrypt := func() {
+		if _, _, err := sender.Encrypt(data, nil); err != nil {
+			b.Fatalf("Encrypt(): expected no error but got %v", err)
+		}
+	}
+
+	checkAllocsPerMessage(b, 7, encrypt)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for range b.N {
+		encrypt()
+	}
+}
+
+func BenchmarkRatchetEncryptTo(b *testing.B) {
+	sender, _ := newTestRatchets(b)
+	data := make([]byte, 256)
+
+	var encryptedHeader, encryptedData []byte
+
+	encrypt := func() {
+		var err error
+
+		encryptedHeader, encryptedData, err = sender.EncryptTo(encryptedHeader[:0], encryptedData[:0], data, nil)
+		if err != nil {
+			b.Fatalf("EncryptTo(): expected no error but got %v", err)
+		}
+	}
+
+	checkAllocsPerMessage(b, 5, encrypt)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for range b.N {
+		encrypt()
+	}
+}
+
+func BenchmarkRatchetDecrypt(b *testing.B) {
+	benchmarkRatchetDecrypt(b, 0, 20, func(recipient *Ratchet, _, encryptedHeader, encryptedData []byte) ([]byte, error) {
+		return recipient.Decrypt(encryptedHeader, encryptedData, nil)
+	})
+}
+
+func BenchmarkRatchetDecryptTo(b *testing.B) {
+	benchmarkRatchetDecrypt(b, 0, 19, func(recipient *Ratchet, dst, header, data []byte) ([]byte, error) {
+		return recipient.DecryptTo(dst[:0], header, data, nil)
+	})
+}
+
+// BenchmarkRatchetDecryptWithSkippedKeys shows that the cost of a message does not depend on skipped keys count.
+func BenchmarkRatchetDecryptWithSkippedKeys(b *testing.B) {
+	benchmarks := []struct {
+		skippedKeysCount int
+		maxAllocs        float64
+	}{
+		{0, 20},
+		{100, 26},
+		{1000, 26},
+	}
+
+	for _, benchmark := range benchmarks {
+		b.Run(strconv.Itoa(benchmark.skippedKeysCount), func(b *testing.B) {
+			benchmarkRatchetDecrypt(
+				b,
+				benchmark.skippedKeysCount,
+				benchmark.maxAllocs,
+				func(recipient *Ratchet, _, header, data []byte) ([]byte, error) {
+					return recipient.Decrypt(header, data, nil)
+				})
+		})
+	}
+}
+
+func benchmarkRatchetDecrypt(
+	b *testing.B,
+	skippedKeysCount int,
+	maxAllocs float64,
+	decrypt func(recipient *Ratchet, dst, encryptedHeader, encryptedData []byte) ([]byte, error),
+) {
+	b.Helper()
+
+	sender, recipient := newTestRatchets(b)
+	data := make([]byte, 256)
+
+	for range skippedKeysCount {
+		if _, _, err := sender.Encrypt(data, nil); err != nil {
+			b.Fatalf("Encrypt(): expected no error but got %v", err)
+		}
+	}
+
+	if skippedKeysCount > 0 {
+		encryptedHeader, encryptedData, err := sender.Encrypt(data, nil)
+		if err != nil {
+			b.Fatalf("Encrypt(): expected no error but got %v", err)
+		}
+
+		if _, err := recipient.Decrypt(encryptedHeader, encryptedData, nil); err != nil {
+			b.Fatalf("Decrypt(): expected no error but got %v", err)
+		}
+	}
+
+	// Note that AllocsPerRun makes one more warm-up run.
+	messagesCount := benchmarkAllocsRuns + 1 + b.N
+	encryptedHeaders := make([][]byte, messagesCount)
+	encryptedDatas := make([][]byte, messagesCount)
+
+	for i := range messagesCount {
+		var err error
+
+		encryptedHeaders[i], encryptedDatas[i], err = sender.Encrypt(data, nil)
+		if err != nil {
+			b.Fatalf("Encrypt(): expected no error but got %v", err)
+		}
+	}
+
+	var (
+		decryptedData []byte
+		messageIndex  int
+	)
+
+	decryptNext := func() {
+		var err error
+
+		decryptedData, err = decrypt(
+			&recipient, decryptedData, encryptedHeaders[messageIndex], encryptedDatas[messageIndex])
+		if err != nil {
+			b.Fatalf("decrypt(): expected no error but got %v", err)
+		}
+
+		messageIndex++
+	}
+
+	checkAllocsPerMessage(b, maxAllocs, decryptNext)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for range b.N {
+		decryptNext()
+	}
+}
+
+// checkAllocsPerMessage fails the benchmark, when a message takes more allocations than expected, so allocations do
+// not grow unnoticed.
+func checkAllocsPerMessage(b *testing.B, maxAllocs float64, message func()) {
+	b.Helper()
+
+	if allocs := testing.AllocsPerRun(benchmarkAllocsRuns, message); allocs > maxAllocs {
+		b.Fatalf("expected at most %v allocations per message but got %v", maxAllocs, allocs)
+	}
+}
+
+func TestRatchetOutOfOrderMessages(t *testing.T) {
+	t.Parallel()
+
+	sender, recipient := newTestRatchets(t)
+
+	type message struct {
+		data, encryptedHeader, encryptedData []byte
+	}
+
+	messages := make([]message, 5)
+
+	for i := range messages {
+		messages[i].data = []byte{byte(i)}
+
+		var err error
+
+		messages[i].encryptedHeader, messages[i].encryptedData, err = sender.Encrypt(messages[i].data, nil)
+		if err != nil {
+			t.Fatalf("Encrypt(): expected no error but got %v", err)
+		}
+	}
+
+	for _, i := range []int{3, 0, 4, 2, 1} {
+		data, err := recipient.Decrypt(messages[i].encryptedHeader, messages[i].encryptedData, nil)
+		if err != nil {
+			t.Fatalf("Decrypt(%d): expected no error but got %v", i, err)
+		}
+
+		if !bytes.Equal(data, messages[i].data) {
+			t.Fatalf("Decrypt(%d): expected %v but got %v", i, messages[i].data, data)
+		}
+	}
+}
+
+func TestRatchetDecryptErrors(t *testing.T) {
+	t.Parallel()
+
+	evictingStorage := newTestTxSkippedKeysStorage()
+
+	tests := []struct {
+		name                  string
+		recipientOptions      []Option
+		decrypt               func(recipient *Ratchet, encryptedHeaders, encryptedDatas [][]byte) error
+		expectedReason        receivingchain.DecryptReason
+		expectedMessageNumber int
+		expectedErr           error
+	}{
+		{
+			"unknown header key",
+			nil,
+			func(recipient *Ratchet, _, encryptedDatas [][]byte) error {
+				_, err := recipient.Decrypt(bytes.Repeat([]byte{1}, 64), encryptedDatas[0], nil)
+				return err
+			},
+			receivingchain.DecryptReasonUnknownHeaderKey,
+			-1,
+			errlist.ErrCrypto,
+		},
+		{
+			"forged message",
+			nil,
+			func(recipient *Ratchet, encryptedHeaders, encryptedDatas [][]byte) error {
+				_, err := recipient.Decrypt(encryptedHeaders[1], encryptedDatas[0], nil)
+				return err
+			},
+			receivingchain.DecryptReasonForgedMessage,
+			1,
+			errlist.ErrCrypto,
+		},
+		{
+			"forged message with skipped key",
+			nil,
+			func(recipient *Ratchet, encryptedHeaders, encryptedDatas [][]byte) error {
+				if _, err := recipient.Decrypt(encryptedHeaders[2], encryptedDatas[2], nil); err != nil {
+					return err
+				}
+
+				_, err := recipient.Decrypt(encryptedHeaders[1], encryptedDatas[0], nil)
+
+				return err
+			},
+			receivingchain.DecryptReasonForgedMessage,
+			1,
+			errlist.ErrCrypto,
+		},
+		{
+			"duplicate message",
+			nil,
+			func(recipient *Ratchet, encryptedHeaders, encryptedDatas [][]byte) error {
+				if _, err := recipient.Decrypt(encryptedHeaders[0], encryptedDatas[0], nil); err != nil {
+					return err
+				}
+
+				_, err := recipient.Decrypt(encryptedHeaders[0], encryptedDatas[0], nil)
+
+				return err
+			},
+			receivingchain.DecryptReasonDuplicateMessage,
+			0,
+			errlist.ErrDuplicateMessage,
+		},
+		{
+			"duplicate message with skipped key",
+			nil,
+			func(recipient *Ratchet, encryptedHeaders, encryptedDatas [][]byte) error {
+				for _, i := range []int{2, 1} {
+					if _, err := recipient.Decrypt(encryptedHeaders[i], encryptedDatas[i], nil); err != nil {
+						return err
+					}
+				}
+
+				_, err := recipient.Decrypt(encryptedHeaders[1], encryptedDatas[1], nil)
+
+				return err
+			},
+			receivingchain.DecryptReasonDuplicateMessage,
+			1,
+			errlist.ErrDuplicateMessage,
+		},
+		{
+			"old message",
+			[]Option{WithReceivingChainOptions(receivingchain.WithSkippedKeysStorage(evictingStorage))},
+			func(recipient *Ratchet, encryptedHeaders, encryptedDatas [][]byte) error {
+				if _, err := recipient.Decrypt(encryptedHeaders[2], encryptedDatas[2], nil); err != nil {
+					return err
+				}
+
+				clear(evictingStorage.messageKeys)
+
+				_, err := recipient.Decrypt(encryptedHeaders[0], encryptedDatas[0], nil)
+
+				return err
+			},
+			receivingchain.DecryptReasonOldMessage,
+			0,
+			nil,
+		},
+		{
+			"too many skipped keys",
+			[]Option{WithReceivingChainOptions(receivingchain.WithMaxSkippedKeysCount(1))},
+			func(recipient *Ratchet, encryptedHeaders, encryptedDatas [][]byte) error {
+				_, err := recipient.Decrypt(encryptedHeaders[2], encryptedDatas[2], nil)
+				return err
+			},
+			receivingchain.DecryptReasonTooManySkippedKeys,
+			2,
+			nil,
+		},
+		{
+			"too many skipped keys with custom storage",
+			[]Option{
+				WithReceivingChainOptions(
+					receivingchain.WithSkippedKeysStorage(newTestTxSkippedKeysStorage()),
+					receivingchain.WithMaxSkippedKeysCount(1),
+				),
+			},
+			func(recipient *Ratchet, encryptedHeaders, encryptedDatas [][]byte) error {
+				_, err := recipient.Decrypt(encryptedHeaders[2], encryptedDatas[2], nil)
+				return err
+			},
+			receivingchain.DecryptReasonTooManySkippedKeys,
+			2,
+			nil,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			sender, recipient := newTestRatchetsWithOptions(t, nil, test.recipientOptions)
+
+			encryptedHeaders, encryptedDatas := encryptTestMessages(t, &sender, 3)
+
+			err := test.decrypt(&recipient, encryptedHeaders, encryptedDatas)
+
+			var decryptErr *receivingchain.DecryptError
+			if !errors.As(err, &decryptErr) {
+				t.Fatalf("Decrypt(): expected decrypt error but got %v", err)
+			}
+
+			if decryptErr.Reason != test.expectedReason {
+				t.Fatalf("Decrypt(): expected reason %v but got %v", test.expectedReason, decryptErr.Reason)
+			}
+
+			if test.expectedErr != nil && !errors.Is(err, test.expectedErr) {
+				t.Fatalf("Decrypt(): expected error %v but got %v", test.expectedErr, err)
+			}
+
+			if test.expectedMessageNumber < 0 {
+				if decryptErr.Header != nil {
+					t.Fatalf("Decrypt(): expected no header but got %+v", decryptErr.Header)
+				}
+
+				return
+			}
+
+			if decryptErr.Header == nil || decryptErr.Header.MessageNumber != uint64(test.expectedMessageNumber) {
+				t.Fatalf(
+					"Decrypt(): expected header message number %d but got %+v", test.expectedMessageNumber, decryptErr.Header)
+			}
+		})
+	}
+}
+
+func TestRatchetDecryptDuplicateMessageOfPreviousEpoch(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name          string
+		messagesCount int
+		// received are indexes of messages of the first epoch, which bob decrypts. The first one is duplicated later.
+		received []int
+		// expectedHeader reports whether the duplicate is reported with decrypted header, i.e. whether the header key of
+		// the epoch is still kept with skipped keys.
+		expectedHeader bool
+	}{
+		{"without skipped keys", 1, []int{0}, false},
+		{"with skipped keys", 3, []int{0, 2}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			alice, bob := newTestRatchets(t)
+
+			encryptedHeaders, encryptedDatas := encryptTestMessages(t, &alice, test.messagesCount)
+
+			for _, i := range test.received {
+				if _, err := bob.Decrypt(encryptedHeaders[i], encryptedDatas[i], nil); err != nil {
+					t.Fatalf("Decrypt(%d): expected no error but got %v", i, err)
+				}
+			}
+
+			// Note that the reply and the next message make both participants perform Diffie-Hellman ratchet steps, so
+			// bob's receiving chain no longer has the header key of the first messages.
+			for _, pair := range [][2]*Ratchet{{&bob, &alice}, {&alice, &bob}} {
+				replyHeader, replyData, err := pair[0].Encrypt([]byte{2}, nil)
+				if err != nil {
+					t.Fatalf("Encrypt(): expected no error but got %v", err)
+				}
+
+				if _, err = pair[1].Decrypt(replyHeader, replyData, nil); err != nil {
+					t.Fatalf("Decrypt(): expected no error but got %v", err)
+				}
+			}
+
+			duplicated := test.received[0]
+
+			_, err := bob.Decrypt(encryptedHeaders[duplicated], encryptedDatas[duplicated], nil)
+			if !errors.Is(err, errlist.ErrDuplicateMessage) {
+				t.Fatalf("Decrypt(): expected duplicate message error but got %v", err)
+			}
+
+			var decryptErr *receivingchain.DecryptError
+			if !errors.As(err, &decryptErr) || decryptErr.Reason != receivingchain.DecryptReasonDuplicateMessage {
+				t.Fatalf("Decrypt(): expected duplicate message reason but got %v", err)
+			}
+
+			if (decryptErr.Header != nil) != test.expectedHeader {
+				t.Fatalf("Decrypt(): expected header %t but got %+v", test.expectedHeader, decryptErr.Header)
+			}
+		})
+	}
+}
+
+type zeroSharedKeyCrypto struct {
+	defaultCrypto
+}
+
+func (c zeroSharedKeyCrypto) ComputeSharedKey(keys.Private, keys.Public) (keys.Shared, error) {
+	return keys.Shared{Bytes: make([]byte, 32)}, nil
+}
+
+func TestRatchetPublicKeyValidation(t *testing.T) {
+	t.Parallel()
+
+	_, validPublicKey, err := newDefaultCrypto().GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("GenerateKeyPair(): expected no error but got %v", err)
+	}
+
+	lowOrderPublicKey := make([]byte, 32)
+	lowOrderPublicKey[0] = 1
+
+	primePublicKey := bytes.Repeat([]byte{0xFF}, 32)
+	primePublicKey[0], primePublicKey[31] = 0xED, 0x7F
+
+	highBitPublicKey := slices.Clone(validPublicKey.Bytes)
+	highBitPublicKey[31] |= 0x80
+
+	tests := []struct {
+		name      string
+		publicKey []byte
+		options   []Option
+	}{
+		{"short public key", validPublicKey.Bytes[:31], nil},
+		{"long public key", append(slices.Clone(validPublicKey.Bytes), 0), nil},
+		{"high bit public key", highBitPublicKey, nil},
+		{"public key equal to prime", primePublicKey, nil},
+		{"zero public key", make([]byte, 32), nil},
+		{"low order public key", lowOrderPublicKey, nil},
+		{
+			"zero shared key of custom crypto",
+			validPublicKey.Bytes,
+			[]Option{WithCrypto(zeroSharedKeyCrypto{newDefaultCrypto()})},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := NewSender(
+				keys.Public{Bytes: test.publicKey},
+				keys.Root{Bytes: bytes.Repeat([]byte{1}, 32)},
+				keys.Header{Bytes: bytes.Repeat([]byte{2}, 32)},
+				keys.Header{Bytes: bytes.Repeat([]byte{3}, 32)},
+				test.options...,
+			)
+			if !errors.Is(err, errlist.ErrInvalidValue) {
+				t.Fatalf("NewSender(%v): expected invalid value error but got %v", test.publicKey, err)
+			}
+		})
+	}
+
+	t.Run("invalid public key in header", func(t *testing.T) {
+		t.Parallel()
+
+		sender, recipient := newTestRatchets(t)
+		sender.localPublicKey = keys.Public{Bytes: []byte{1, 2, 3}}
+
+		encryptedHeader, encryptedData, err := sender.Encrypt([]byte{1}, nil)
+		if err != nil {
+			t.Fatalf("Encrypt(): expected no error but got %v", err)
+		}
+
+		_, err = recipient.Decrypt(encryptedHeader, encryptedData, nil)
+
+		var decryptErr *receivingchain.DecryptError
+		if !errors.As(err, &decryptErr) || decryptErr.Reason != receivingchain.DecryptReasonInvalidPublicKey {
+			t.Fatalf("Decrypt(): expected invalid public key error but got %v", err)
+		}
+
+		if !errors.Is(err, errlist.ErrInvalidValue) {
+			t.Fatalf("Decrypt(): expected invalid value error but got %v", err)
+		}
+	})
+
+	t.Run("ratchet to the same public key", func(t *testing.T) {
+		t.Parallel()
+
+		sender, recipient := newTestRatchets(t)
+
+		encryptedHeader, encryptedData, err := sender.Encrypt([]byte{1}, nil)
+		if err != nil {
+			t.Fatalf("Encrypt(): expected no error but got %v", err)
+		}
+
+		if _, err = recipient.Decrypt(encryptedHeader, encryptedData, nil); err != nil {
+			t.Fatalf("Decrypt(): expected no error but got %v", err)
+		}
+
+		err = recipient.ratchetReceivingChain(sender.localPublicKey.Clone(), false)
+		if !errors.Is(err, errlist.ErrInvalidValue) {
+			t.Fatalf("ratchetReceivingChain(): expected invalid value error but got %v", err)
+		}
+	})
+}
+
+func TestRatchetDecryptRollback(t *testing.T) {
+	t.Parallel()
+
+	sender, recipient := newTestRatchets(t)
+
+	encryptedHeader, encryptedData, err := sender.Encrypt([]byte{1, 2, 3}, nil)
+	if err != nil {
+		t.Fatalf("Encrypt(): expected no error but got %v", err)
+	}
+
+	forgedData := bytes.Clone(encryptedData)
+	forgedData[0] ^= 0xFF
+
+	if _, err := recipient.Decrypt(encryptedHeader, forgedData, nil); err == nil {
+		t.Fatal("Decrypt(): expected error for forged data but got nil")
+	}
+
+	data, err := recipient.Decrypt(encryptedHeader, encryptedData, nil)
+	if err != nil {
+		t.Fatalf("Decrypt(): expected no error after rollback but got %v", err)
+	}
+
+	if !bytes.Equal(data, []byte{1, 2, 3}) {
+		t.Fatalf("Decrypt(): expected %v but got %v", []byte{1, 2, 3}, data)
+	}
+}
+
+func TestRatchetDecryptRollbackBeforeFirstReply(t *testing.T) {
+	t.Parallel()
+
+	sender, recipient := newTestRatchets(t)
+
+	if _, err := sender.Decrypt(bytes.Repeat([]byte{1}, 64), bytes.Repeat([]byte{2}, 64), nil); err == nil {
+		t.Fatal("Decrypt(): expected error for forged message but got nil")
+	}
+
+	encryptedHeader, encryptedData, err := sender.Encrypt([]byte{1, 2, 3}, nil)
+	if err != nil {
+		t.Fatalf("Encrypt(): expected no error but got %v", err)
+	}
+
+	if _, err := recipient.Decrypt(encryptedHeader, encryptedData, nil); err != nil {
+		t.Fatalf("Decrypt(): expected no error but got %v", err)
+	}
+
+	encryptedHeader, encryptedData, err = recipient.Encrypt([]byte{4, 5, 6}, nil)
+	if err != nil {
+		t.Fatalf("Encrypt(): expected no error but got %v", err)
+	}
+
+	data, err := sender.Decrypt(encryptedHeader, encryptedData, nil)
+	if err != nil {
+		t.Fatalf("Decrypt(): expected no error for reply but got %v", err)
+	}
+
+	if !bytes.Equal(data, []byte{4, 5, 6}) {
+		t.Fatalf("Decrypt(): expected %v but got %v", []byte{4, 5, 6}, data)
+	}
+}
+
+func TestRatchetCloneConcurrentUse(t *testing.T) {
+	t.Parallel()
+
+	sender, recipient := newTestRatchets(t)
+
+	encryptedHeader, encryptedData, err := sender.Encrypt([]byte{1, 2, 3}, nil)
+	if err != nil {
+		t.Fatalf("Encrypt(): expected no error but got %v", err)
+	}
+
+	converse := func(sender, recipient Ratchet) {
+		if _, err := recipient.Decrypt(encryptedHeader, bytes.Repeat([]byte{1}, len(encryptedData)), nil); err == nil {
+			t.Error("Decrypt(): expected error for forged message but got nil")
+			return
+		}
+
+		if _, err := recipient.Decrypt(encryptedHeader, encryptedData, nil); err != nil {
+			t.Errorf("Decrypt(): expected no error but got %v", err)
+			return
+		}
+
+		replyHeader, replyData, err := recipient.Encrypt([]byte{4, 5, 6}, nil)
+		if err != nil {
+			t.Errorf("Encrypt(): expected no error but got %v", err)
+			return
+		}
+
+		if _, err := sender.Decrypt(replyHeader, replyData, nil); err != nil {
+			t.Errorf("Decrypt(): expected no error for reply but got %v", err)
+		}
+	}
+
+	var wg sync.WaitGroup
+
+	for range 4 {
+		senderClone, recipientClone := sender.Clone(), recipient.Clone()
+
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+			converse(senderClone, recipientClone)
+		}()
+	}
+
+	converse(sender, recipient)
+	wg.Wait()
+}
+
+type testTxSkippedKeysStorage struct {
+	messageKeys       map[string]map[uint64]keys.Message
+	backupMessageKeys map[string]map[uint64]keys.Message
+	commitErr         error
+	beginsCount       int
+	commitsCount      int
+	rollbacksCount    int
+}
+
+func newTestTxSkippedKeysStorage() *testTxSkippedKeysStorage {
+	return &testTxSkippedKeysStorage{messageKeys: make(map[string]map[uint64]keys.Message)}
+}
+
+func (st *testTxSkippedKeysStorage) Add(headerKey keys.Header, messageNumber uint64, messageKey keys.Message) error {
+	if _, ok := st.messageKeys[string(headerKey.Bytes)]; !ok {
+		st.messageKeys[string(headerKey.Bytes)] = make(map[uint64]keys.Message)
+	}
+
+	st.messageKeys[string(headerKey.Bytes)][messageNumber] = messageKey.Clone()
+
+	return nil
+}
+
+func (st *testTxSkippedKeysStorage) Begin() error {
+	st.beginsCount++
+	st.backupMessageKeys = st.cloneMessageKeys()
+
+	return nil
+}
+
+func (st *testTxSkippedKeysStorage) Clone() receivingchain.SkippedKeysStorage {
+	clone := *st
+	clone.messageKeys = st.cloneMessageKeys()
+
+	return &clone
+}
+
+func (st *testTxSkippedKeysStorage) Commit() error {
+	st.commitsCount++
+	return st.commitErr
+}
+
+func (st *testTxSkippedKeysStorage) Delete(headerKey keys.Header, messageNumber uint64) error {
+	delete(st.messageKeys[string(headerKey.Bytes)], messageNumber)
+	return nil
+}
+
+func (st *testTxSkippedKeysStorage) GetIter() (receivingchain.SkippedKeysIter, error) {
+	iter := func(yield receivingchain.SkippedKeysYield) {
+		for headerKey, messageNumberKeys := range st.messageKeys {
+			messageNumberKeysIter := func(yield receivingchain.SkippedMessageNumberKeysYield) {
+				for messageNumber, messageKey := range messageNumberKeys {
+					if !yield(messageNumber, messageKey) {
+						return
+					}
+				}
+			}
+
+			if !yield(keys.Header{Bytes: []byte(headerKey)}, messageNumberKeysIter) {
+				return
+			}
+		}
+	}
+
+	return iter, nil
+}
+
+func (st *testTxSkippedKeysStorage) Rollback() error {
+	st.rollbacksCount++
+	st.messageKeys = st.backupMessageKeys
+
+	return nil
+}
+
+func (st *testTxSkippedKeysStorage) cloneMessageKeys() map[string]map[uint64]keys.Message {
+	clone := make(map[string]map[uint64]keys.Message, len(st.messageKeys))
+
+	for headerKey, messageNumberKeys := range st.messageKeys {
+		clone[headerKey] = make(map[uint64]keys.Message, len(messageNumberKeys))
+
+		for messageNumber, messageKey := range messageNumberKeys {
+			clone[headerKey][messageNumber] = messageKey.Clone()
+		}
+	}
+
+	return clone
+}
+
+func TestRatchetDestroyTwice(t *testing.T) {
+	t.Parallel()
+
+	allocator := keys.NewLockedAllocator()
+	if !allocator.Locked() {
+		t.Skip("memory locking is not allowed")
+	}
+
+	sender, recipient := newTestRatchets(t, WithKeysAllocator(allocator))
+
+	encryptedHeader, encryptedData, err := sender.Encrypt([]byte{1, 2, 3}, nil)
+	if err != nil {
+		t.Fatalf("Encrypt(): expected no error but got %v", err)
+	}
+
+	if _, err := recipient.Decrypt(encryptedHeader, encryptedData, nil); err != nil {
+		t.Fatalf("Decrypt(): expected no error but got %v", err)
+	}
+
+	for _, ratchet := range []*Ratchet{&sender, &recipient} {
+		ratchet.Destroy()
+		ratchet.Destroy()
+	}
+
+	allocated := make(map[*byte]struct{})
+
+	for range 128 {
+		key := allocator.Alloc(32)
+
+		if _, ok := allocated[&key[0]]; ok {
+			t.Fatalf("Alloc(): returned the same memory %p twice after double Destroy()", &key[0])
+		}
+
+		allocated[&key[0]] = struct{}{}
+	}
+}
+
+func TestRatchetDecryptWithTxSkippedKeysStorage(t *testing.T) {
+	t.Parallel()
+
+	storage := newTestTxSkippedKeysStorage()
+	sender, recipient := newTestRatchets(t, WithReceivingChainOptions(receivingchain.WithSkippedKeysStorage(storage)))
+
+	encryptedHeaders, encryptedDatas := encryptTestMessages(t, &sender, 3)
+
+	storage.commitErr = errors.New("commit failed")
+
+	_, err := recipient.Decrypt(encryptedHeaders[2], encryptedDatas[2], nil)
+	if !errors.Is(err, errlist.ErrSkippedKeysStorage) || !errors.Is(err, storage.commitErr) {
+		t.Fatalf("Decrypt(): expected commit error but got %v", err)
+	}
+
+	var decryptErr *receivingchain.DecryptError
+	if !errors.As(err, &decryptErr) || decryptErr.Reason != receivingchain.DecryptReasonSkippedKeysStorage {
+		t.Fatalf("Decrypt(): expected skipped keys storage reason but got %v", err)
+	}
+
+	if storage.beginsCount != 1 || storage.commitsCount != 1 || storage.rollbacksCount != 1 {
+		t.Fatalf("Decrypt(): expected rollback after failed commit but got %+v", storage)
+	}
+
+	if len(storage.messageKeys) != 0 {
+		t.Fatalf("Decrypt(): skipped keys are not rolled back: %+v", storage.messageKeys)
+	}
+
+	storage.commitErr = nil
+
+	for _, i := range []int{2, 0, 1} {
+		data, err := recipient.Decrypt(encryptedHeaders[i], encryptedDatas[i], nil)
+		if err != nil {
+			t.Fatalf("Decrypt(%d): expected no error but got %v", i, err)
+		}
+
+		if !bytes.Equal(data, []byte{byte(i)}) {
+			t.Fatalf("Decrypt(%d): expected %v but got %v", i, []byte{byte(i)}, data)
+		}
+	}
+
+	if storage.beginsCount != 4 || storage.commitsCount != 4 || storage.rollbacksCount != 1 {
+		t.Fatalf("Decrypt(): expected 3 more commits but got %+v", storage)
+	}
+}
+
+func TestRatchetHeaderPadding(t *testing.T) {
+	t.Parallel()
+
+	const blockSize = 64
+
+	alice, bob := newTestRatchets(t, WithHeaderPadding(blockSize))
+
+	var encryptedHeaderLens []int
+
+	for i, sender := range []*Ratchet{&alice, &alice, &bob, &alice, &bob, &bob} {
+		recipient := &bob
+		if sender == &bob {
+			recipient = &alice
+		}
+
+		data := []byte(strconv.Itoa(i))
+
+		encryptedHeader, encryptedData, err := sender.Encrypt(data, nil)
+		if err != nil {
+			t.Fatalf("Encrypt(%d): expected no error but got %v", i, err)
+		}
+
+		encryptedHeaderLens = append(encryptedHeaderLens, len(encryptedHeader))
+
+		decryptedData, err := recipient.Decrypt(encryptedHeader, encryptedData, nil)
+		if err != nil {
+			t.Fatalf("Decrypt(%d): expected no error but got %v", i, err)
+		}
+
+		if !bytes.Equal(decryptedData, data) {
+			t.Fatalf("Decrypt(%d): expected %v but got %v", i, data, decryptedData)
+		}
+	}
+
+	// Note that encrypted header consists of nonce, padded header and tag.
+	expectedEncryptedHeaderLen := cipher.NonceSizeX + blockSize + cipher.Overhead
+
+	for i, encryptedHeaderLen := range encryptedHeaderLens {
+		if encryptedHeaderLen != expectedEncryptedHeaderLen {
+			t.Fatalf(
+				"Encrypt(%d): expected encrypted header length %d but got %d", i, expectedEncryptedHeaderLen, encryptedHeaderLen)
+		}
+	}
+}
+
+func TestRatchetMetadata(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		metadata []byte
+	}{
+		{"metadata", []byte("content-type: text/plain")},
+		{"empty metadata", []byte{}},
+		{"nil metadata", nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			sender, recipient := newTestRatchets(t)
+			data := []byte{1, 2, 3}
+
+			encryptedHeader, encryptedData, err := sender.EncryptWithMetadata(data, test.metadata, nil)
+			if err != nil {
+				t.Fatalf("EncryptWithMetadata(): expected no error but got %v", err)
+			}
+
+			decryptedData, metadata, err := recipient.DecryptWithMetadata(encryptedHeader, encryptedData, nil)
+			if err != nil {
+				t.Fatalf("DecryptWithMetadata(): expected no error but got %v", err)
+			}
+
+			if !bytes.Equal(decryptedData, data) {
+				t.Fatalf("DecryptWithMetadata(): expected data %v but got %v", data, decryptedData)
+			}
+
+			if !bytes.Equal(metadata, test.metadata) || metadata == nil {
+				t.Fatalf("DecryptWithMetadata(): expected metadata %v but got %v", test.metadata, metadata)
+			}
+		})
+	}
+
+	t.Run("no metadata", func(t *testing.T) {
+		t.Parallel()
+
+		sender, recipient := newTestRatchets(t)
+
+		encryptedHeader, encryptedData, err := sender.Encrypt([]byte{1}, nil)
+		if err != nil {
+			t.Fatalf("Encrypt(): expected no error but got %v", err)
+		}
+
+		_, metadata, err := recipient.DecryptWithMetadata(encryptedHeader, encryptedData, nil)
+		if err != nil || metadata != nil {
+			t.Fatalf("DecryptWithMetadata(): expected nil metadata and no error but got %v and %v", metadata, err)
+		}
+	})
+}
+
+func TestRatchetDecryptWithInfo(t *testing.T) {
+	t.Parallel()
+
+	alice, bob := newTestRatchets(t)
+
+	type message struct {
+		encryptedHeader []byte
+		encryptedData   []byte
+	}
+
+	encrypt := func(sender *Ratchet, count int) []message {
+		messages := make([]message, 0, count)
+
+		for range count {
+			encryptedHeader, encryptedData, err := sender.Encrypt([]byte{1}, nil)
+			if err != nil {
+				t.Fatalf("Encrypt(): expected no error but got %v", err)
+			}
+
+			messages = append(messages, message{encryptedHeader, encryptedData})
+		}
+
+		return messages
+	}
+
+	decrypt := func(recipient *Ratchet, message message, expected DecryptResult) {
+		result, err := recipient.DecryptWithInfo(message.encryptedHeader, message.encryptedData, nil)
+		if err != nil {
+			t.Fatalf("DecryptWithInfo(): expected no error but got %v", err)
+		}
+
+		expected.Data = []byte{1}
+		if !reflect.DeepEqual(result, expected) {
+			t.Fatalf("DecryptWithInfo(): expected %+v but got %+v", expected, result)
+		}
+	}
+
+	aliceMessages := encrypt(&alice, 4)
+
+	decrypt(&bob, aliceMessages[0], DecryptResult{MessageNumber: 0, ReceivingEpoch: 1, DHRatchet: true})
+	decrypt(&bob, aliceMessages[2], DecryptResult{MessageNumber: 2, ReceivingEpoch: 1})
+	decrypt(&bob, aliceMessages[1], DecryptResult{MessageNumber: 1, ReceivingEpoch: 1, FromSkippedKey: true})
+
+	bobMessages := encrypt(&bob, 1)
+	decrypt(&alice, bobMessages[0], DecryptResult{MessageNumber: 0, ReceivingEpoch: 1, DHRatchet: true})
+
+	aliceMessages = append(aliceMessages, encrypt(&alice, 1)...)
+
+	decrypt(&bob, aliceMessages[4], DecryptResult{MessageNumber: 0, ReceivingEpoch: 2, DHRatchet: true})
+	decrypt(&bob, aliceMessages[3], DecryptResult{MessageNumber: 3, ReceivingEpoch: 1, FromSkippedKey: true})
+}
+
+func TestRatchetInspectHeader(t *testing.T) {
+	t.Parallel()
+
+	alice, bob := newTestRatchets(t)
+
+	encryptedHeaders, encryptedDatas := encryptTestMessages(t, &alice, 4)
+
+	inspect := func(encryptedHeader []byte) (receivingchain.HeaderInfo, error) {
+		statsBefore, err := bob.Stats()
+		if err != nil {
+			t.Fatalf("Stats(): expected no error but got %v", err)
+		}
+
+		info, err := bob.InspectHeader(encryptedHeader)
+
+		statsAfter, statsErr := bob.Stats()
+		if statsErr != nil {
+			t.Fatalf("Stats(): expected no error but got %v", statsErr)
+		}
+
+		if !reflect.DeepEqual(statsAfter, statsBefore) {
+			t.Fatalf("InspectHeader(): expected unchanged stats %+v but got %+v", statsBefore, statsAfter)
+		}
+
+		return info, err
+	}
+
+	checkInfo := func(i int, expectedClass receivingchain.HeaderClass, expectedEpoch uint64) {
+		info, err := inspect(encryptedHeaders[i])
+		if err != nil {
+			t.Fatalf("InspectHeader(%d): expected no error but got %v", i, err)
+		}
+
+		if info.Class != expectedClass || info.Epoch != expectedEpoch || info.Header.MessageNumber != uint64(i) {
+			t.Fatalf(
+				"InspectHeader(%d): expected %s message %d of epoch %d but got %s message %d of epoch %d",
+				i, expectedClass, i, expectedEpoch, info.Class, info.Header.MessageNumber, info.Epoch)
+		}
+	}
+
+	checkReason := func(encryptedHeader []byte, expectedReason receivingchain.DecryptReason) {
+		_, err := inspect(encryptedHeader)
+
+		var decryptErr *receivingchain.DecryptError
+		if !errors.As(err, &decryptErr) || decryptErr.Reason != expectedReason {
+			t.Fatalf("InspectHeader(): expected %s error but got %v", expectedReason, err)
+		}
+	}
+
+	decrypt := func(i int) {
+		if _, err := bob.Decrypt(encryptedHeaders[i], encryptedDatas[i], nil); err != nil {
+			t.Fatalf("Decrypt(%d): expected no error but got %v", i, err)
+		}
+	}
+
+	checkInfo(2, receivingchain.HeaderClassNewEpoch, 1)
+	decrypt(2)
+
+	checkInfo(0, receivingchain.HeaderClassSkipped, 1)
+	checkInfo(3, receivingchain.HeaderClassCurrent, 1)
+	checkReason(encryptedHeaders[2], receivingchain.DecryptReasonDuplicateMessage)
+
+	decrypt(0)
+	checkReason(encryptedHeaders[0], receivingchain.DecryptReasonDuplicateMessage)
+
+	checkReason(bytes.Repeat([]byte{1}, 64), receivingchain.DecryptReasonUnknownHeaderKey)
+}
+
+func TestRatchetPadding(t *testing.T) {
+	t.Parallel()
+
+	scheme, err := padding.NewBucketsScheme(64, 256)
+	if err != nil {
+		t.Fatalf("NewBucketsScheme(): expected no error but got %v", err)
+	}
+
+	sender, recipient := newTestRatchets(t, WithPadding(scheme))
+
+	for _, dataLen := range []int{0, 1, 63, 64, 200} {
+		data := bytes.Repeat([]byte{0x80}, dataLen)
+
+		encryptedHeader, encryptedData, err := sender.Encrypt(data, nil)
+		if err != nil {
+			t.Fatalf("Encrypt(%d): expected no error but got %v", dataLen, err)
+		}
+
+		if expectedLen := scheme.PaddedLen(dataLen) + cipher.Overhead; len(encryptedData) != expectedLen {
+			t.Fatalf("Encrypt(%d): expected encrypted data length %d but got %d", dataLen, expectedLen, len(encryptedData))
+		}
+
+		decryptedData, err := recipient.Decrypt(encryptedHeader, encryptedData, nil)
+		if err != nil {
+			t.Fatalf("Decrypt(%d): expected no error but got %v", dataLen, err)
+		}
+
+		if !bytes.Equal(decryptedData, data) {
+			t.Fatalf("Decrypt(%d): expected %v but got %v", dataLen, data, decryptedData)
+		}
+	}
+
+	t.Run("padding mismatch", func(t *testing.T) {
+		t.Parallel()
+
+		sender, recipient := newTestRatchets(t, WithReceivingChainOptions(receivingchain.WithPadding(scheme)))
+
+		encryptedHeader, encryptedData, err := sender.Encrypt([]byte{1, 2, 3}, nil)
+		if err != nil {
+			t.Fatalf("Encrypt(): expected no error but got %v", err)
+		}
+
+		_, err = recipient.Decrypt(encryptedHeader, encryptedData, nil)
+		if !errors.Is(err, errlist.ErrInvalidValue) {
+			t.Fatalf("Decrypt(): expected invalid padding error but got %v", err)
+		}
+	})
+}
+
+func TestRatchetAssociatedData(t *testing.T) {
+	t.Parallel()
+
+	associatedData := []byte("alice identity key|bob identity key")
+
+	tests := []struct {
+		name                    string
+		senderOptions           []Option
+		recipientOptions        []Option
+		expectedDecryptionError bool
+	}{
+		{
+			"same associated data",
+			[]Option{WithAssociatedData(associatedData)},
+			[]Option{WithAssociatedData(associatedData)},
+			false,
+		},
+		{
+			"different associated data",
+			[]Option{WithAssociatedData(associatedData)},
+			[]Option{WithAssociatedData([]byte{1})},
+			true,
+		},
+		{"recipient without associated data", []Option{WithAssociatedData(associatedData)}, nil, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			sender, recipient := newTestRatchetsWithOptions(t, test.senderOptions, test.recipientOptions)
+
+			if !bytes.Equal(sender.AssociatedData(), associatedData) {
+				t.Fatalf("AssociatedData(): expected %v but got %v", associatedData, sender.AssociatedData())
+			}
+
+			encryptedHeader, encryptedData, err := sender.Encrypt([]byte{1, 2, 3}, []byte{4})
+			if err != nil {
+				t.Fatalf("Encrypt(): expected no error but got %v", err)
+			}
+
+			_, err = recipient.Decrypt(encryptedHeader, encryptedData, []byte{4})
+			if test.expectedDecryptionError != (err != nil) {
+				t.Fatalf("Decrypt(): expected error %t but got %v", test.expectedDecryptionError, err)
+			}
+		})
+	}
+}
+
+func TestRatchetShortAuthenticationString(t *testing.T) {
+	t.Parallel()
+
+	alice, bob := newTestRatchets(t)
+
+	for i, sender := range []*Ratchet{&alice, &bob, &alice} {
+		recipient := &bob
+		if sender == &bob {
+			recipient = &alice
+		}
+
+		encryptedHeader, encryptedData, err := sender.Encrypt([]byte{byte(i)}, nil)
+		if err != nil {
+			t.Fatalf("Encrypt(%d): expected no error but got %v", i, err)
+		}
+
+		if _, err = recipient.Decrypt(encryptedHeader, encryptedData, nil); err != nil {
+			t.Fatalf("Decrypt(%d): expected no error but got %v", i, err)
+		}
+
+		aliceSAS, err := alice.ShortAuthenticationString()
+		if err != nil {
+			t.Fatalf("ShortAuthenticationString(): expected no error but got %v", err)
+		}
+
+		bobSAS, err := bob.ShortAuthenticationString()
+		if err != nil {
+			t.Fatalf("ShortAuthenticationString(): expected no error but got %v", err)
+		}
+
+		if aliceSAS.Epoch != bobSAS.Epoch || aliceSAS.Emoji() != bobSAS.Emoji() {
+			t.Fatalf("ShortAuthenticationString(%d): expected equal strings but got %s and %s", i, aliceSAS, bobSAS)
+		}
+	}
+}
+
+func TestRatchetStats(t *testing.T) {
+	t.Parallel()
+
+	sender, recipient := newTestRatchets(t)
+
+	encryptedHeaders, encryptedDatas := encryptTestMessages(t, &sender, 4)
+
+	if _, err := recipient.Decrypt(encryptedHeaders[3], encryptedDatas[3], nil); err != nil {
+		t.Fatalf("Decrypt(): expected no error but got %v", err)
+	}
+
+	senderStats, err := sender.Stats()
+	if err != nil {
+		t.Fatalf("Stats(): expected no error but got %v", err)
+	}
+
+	recipientStats, err := recipient.Stats()
+	if err != nil {
+		t.Fatalf("Stats(): expected no error but got %v", err)
+	}
+
+	expectedSenderStats := Stats{
+		Epoch:                         1,
+		SendingChainNextMessageNumber: 4,
+		SkippedKeysCounts:             map[string]int{},
+		LocalPublicKeyFingerprint:     sender.localPublicKey.Fingerprint(),
+		RemotePublicKeyFingerprint:    recipient.localPublicKey.Fingerprint(),
+	}
+
+	if !reflect.DeepEqual(senderStats, expectedSenderStats) {
+		t.Fatalf("Stats(): expected %+v but got %+v", expectedSenderStats, senderStats)
+	}
+
+	expectedRecipientStats := Stats{
+		Epoch:                           1,
+		ReceivingChainNextMessageNumber: 4,
+		SkippedKeysCounts:               map[string]int{testSenderHeaderKey.Fingerprint(): 3},
+		NeedSendingChainRatchet:         true,
+		LocalPublicKeyFingerprint:       recipient.localPublicKey.Fingerprint(),
+		RemotePublicKeyFingerprint:      sender.localPublicKey.Fingerprint(),
+	}
+
+	if !reflect.DeepEqual(recipientStats, expectedRecipientStats) {
+		t.Fatalf("Stats(): expected %+v but got %+v", expectedRecipientStats, recipientStats)
+	}
+}
+
+type testObserver struct {
+	NopObserver
+
+	events []string
+}
+
+func (o *testObserver) OnDHRatchet(direction Direction, epoch uint64) {
+	o.events = append(o.events, fmt.Sprintf("dh ratchet %s %d", direction, epoch))
+}
+
+func (o *testObserver) OnDecryptFailure(error) {
+	o.events = append(o.events, "decrypt failure")
+}
+
+func (o *testObserver) OnKeysSkipped(_ string, from, to uint64) {
+	o.events = append(o.events, fmt.Sprintf("keys skipped %d-%d", from, to))
+}
+
+func (o *testObserver) OnMissingMessageFilled(message receivingchain.MissingMessage) {
+	o.events = append(o.events, fmt.Sprintf("missing message filled %d/%d", message.Epoch, message.MessageNumber))
+}
+
+func (o *testObserver) OnMissingMessagesExpired(messages []receivingchain.MissingMessage) {
+	o.events = append(o.events, fmt.Sprintf("missing messages expired %v", messages))
+}
+
+func (o *testObserver) OnSkippedKeyUsed(_ string, messageNumber uint64) {
+	o.events = append(o.events, fmt.Sprintf("skipped key used %d", messageNumber))
+}
+
+func TestRatchetObserver(t *testing.T) {
+	t.Parallel()
+
+	aliceObserver := &testObserver{}
+	bobObserver := &testObserver{}
+
+	alice, bob := newTestRatchetsWithOptions(t, []Option{WithObserver(aliceObserver)}, []Option{WithObserver(bobObserver)})
+
+	encryptedHeaders, encryptedDatas := encryptTestMessages(t, &alice, 3)
+
+	forgedData := slices.Clone(encryptedDatas[2])
+	forgedData[0] ^= 0xFF
+
+	if _, err := bob.Decrypt(encryptedHeaders[2], forgedData, nil); err == nil {
+		t.Fatal("Decrypt(): expected error for forged data but got nil")
+	}
+
+	for _, i := range []int{2, 0} {
+		if _, err := bob.Decrypt(encryptedHeaders[i], encryptedDatas[i], nil); err != nil {
+			t.Fatalf("Decrypt(%d): expected no error but got %v", i, err)
+		}
+	}
+
+	encryptedHeader, encryptedData, err := bob.Encrypt([]byte{3}, nil)
+	if err != nil {
+		t.Fatalf("Encrypt(): expected no error but got %v", err)
+	}
+
+	if _, err = alice.Decrypt(encryptedHeader, encryptedData, nil); err != nil {
+		t.Fatalf("Decrypt(): expected no error but got %v", err)
+	}
+
+	expectedBobEvents := []string{
+		"decrypt failure",
+		"dh ratchet receiving 1",
+		"keys skipped 0-2",
+		"skipped key used 0",
+		"missing message filled 1/0",
+		"dh ratchet sending 2",
+	}
+
+	if !slices.Equal(bobObserver.events, expectedBobEvents) {
+		t.Fatalf("Observer: expected events %v but got %v", expectedBobEvents, bobObserver.events)
+	}
+
+	expectedAliceEvents := []string{"dh ratchet receiving 2"}
+
+	if !slices.Equal(aliceObserver.events, expectedAliceEvents) {
+		t.Fatalf("Observer: expected events %v but got %v", expectedAliceEvents, aliceObserver.events)
+	}
+}
+
+func TestRatchetMissingMessages(t *testing.T) {
+	t.Parallel()
+
+	// Note that the logger and the metrics wrap the observer, so they must pass events of missing messages to it.
+	bobObserver := &testObserver{}
+	bobOptions := []Option{
+		WithObserver(bobObserver),
+		WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+		WithMetrics(&testMetrics{counters: make(map[string]uint64), durations: make(map[string]int)}),
+	}
+	alice, bob := newTestRatchetsWithOptions(t, nil, bobOptions)
+
+	transfer := func(sender, recipient *Ratchet, count int, decryptNumbers ...int) {
+		encryptedHeaders, encryptedDatas := encryptTestMessages(t, sender, count)
+
+		for _, i := range decryptNumbers {
+			if _, err := recipient.Decrypt(encryptedHeaders[i], encryptedDatas[i], nil); err != nil {
+				t.Fatalf("Decrypt(%d): expected no error but got %v", i, err)
+			}
+		}
+	}
+
+	checkMissingMessages := func(expected []receivingchain.MissingMessage) {
+		messages, err := bob.MissingMessages()
+		if err != nil {
+			t.Fatalf("MissingMessages(): expected no error but got %v", err)
+		}
+
+		if !slices.Equal(messages, expected) {
+			t.Fatalf("MissingMessages(): expected %v but got %v", expected, messages)
+		}
+	}
+
+	checkMissingMessages(nil)
+
+	transfer(&alice, &bob, 4, 3, 1)
+	checkMissingMessages([]receivingchain.MissingMessage{{Epoch: 1, MessageNumber: 0}, {Epoch: 1, MessageNumber: 2}})
+
+	// Note that the default storage keeps skipped keys of 4 header keys, so skipped keys of the 5th epoch evict older
+	// ones.
+	for range 4 {
+		transfer(&bob, &alice, 1, 0)
+		transfer(&alice, &bob, 2, 1)
+	}
+
+	checkMissingMessages([]receivingchain.MissingMessage{{Epoch: 5, MessageNumber: 0}})
+
+	expectedEvent := "missing messages expired [{1 0} {1 2} {2 0} {3 0} {4 0}]"
+	if !slices.Contains(bobObserver.events, expectedEvent) {
+		t.Fatalf("Observer: expected event %q but got %v", expectedEvent, bobObserver.events)
+	}
+
+	if !slices.Contains(bobObserver.events, "missing message filled 1/1") {
+		t.Fatalf("Observer: expected filled missing message but got %v", bobObserver.events)
+	}
+
+	observer := newMetricsObserver(&testMetrics{}, newLogObserver(slog.Default(), NopObserver{}))
+	if _, ok := observer.(receivingchain.MissingMessagesObserver); ok {
+		t.Fatal("Observer: expected no events of missing messages for observer, which does not receive them")
+	}
+}
+
+func TestRatchetLoggingAndFormatting(t *testing.T) {
+	t.Parallel()
+
+	var logs bytes.Buffer
+
+	logger := slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	sender, recipient := newTestRatchetsWithOptions(t, nil, []Option{WithLogger(logger)})
+
+	encryptedHeader, encryptedData, err := sender.Encrypt([]byte{1}, nil)
+	if err != nil {
+		t.Fatalf("Encrypt(): expected no error but got %v", err)
+	}
+
+	if _, err = recipient.Decrypt(encryptedHeader, []byte{1, 2, 3}, nil); err == nil {
+		t.Fatal("Decrypt(): expected error for forged data but got nil")
+	}
+
+	if _, err = recipient.Decrypt(encryptedHeader, encryptedData, nil); err != nil {
+		t.Fatalf("Decrypt(): expected no error but got %v", err)
+	}
+
+	logger.Debug("ratchet", "ratchet", recipient)
+
+	for _, expected := range []string{
+		`msg="decrypt failure"`,
+		`msg="Diffie-Hellman ratchet step" direction=receiving epoch=1`,
+		"ratchet.epoch=1",
+	} {
+		if !strings.Contains(logs.String(), expected) {
+			t.Fatalf("WithLogger(): expected %q in logs but got %q", expected, logs.String())
+		}
+	}
+
+	privateKeyHex := hex.EncodeToString(recipient.localPrivateKey.Bytes)
+	headerKeyDecimal := strings.Trim(fmt.Sprint(testSenderHeaderKey.Bytes[:4]), "[]")
+
+	for _, format := range []string{"%v", "%+v", "%#v", "%s", "%x", "%d"} {
+		formatted := fmt.Sprintf(format, recipient) + fmt.Sprintf(format, recipient.receivingChain)
+		if strings.Contains(formatted, privateKeyHex) || strings.Contains(formatted, headerKeyDecimal) {
+			t.Fatalf("Sprintf(%q): formatted ratchet contains keys: %s", format, formatted)
+		}
+	}
+
+	if strings.Contains(logs.String(), privateKeyHex) {
+		t.Fatalf("WithLogger(): logs contain keys: %s", logs.String())
+	}
+}
+
+type testMetrics struct {
+	counters  map[string]uint64
+	durations map[string]int
+}
+
+func (m *testMetrics) AddCounter(name, label string, delta uint64) {
+	if label != "" {
+		name += "." + label
+	}
+
+	m.counters[name] += delta
+}
+
+func (m *testMetrics) ObserveDuration(name string, _ time.Duration) {
+	m.durations[name]++
+}
+
+func TestRatchetMetrics(t *testing.T) {
+	t.Parallel()
+
+	metrics := &testMetrics{counters: make(map[string]uint64), durations: make(map[string]int)}
+	sender, recipient := newTestRatchets(t, WithMetrics(metrics))
+
+	encryptedHeaders, encryptedDatas := encryptTestMessages(t, &sender, 3)
+
+	if _, err := recipient.Decrypt(encryptedHeaders[2], []byte{1, 2, 3}, nil); err == nil {
+		t.Fatal("Decrypt(): expected error for forged data but got nil")
+	}
+
+	for _, i := range []int{2, 1} {
+		if _, err := recipient.Decrypt(encryptedHeaders[i], encryptedDatas[i], nil); err != nil {
+			t.Fatalf("Decrypt(%d): expected no error but got %v", i, err)
+		}
+	}
+
+	expectedCounters := map[string]uint64{
+		MetricMessagesEncrypted:                   3,
+		MetricMessagesDecrypted:                   2,
+		MetricDecryptFailures + ".forged_message": 1,
+		MetricDHRatchetSteps + ".receiving":       1,
+		MetricSkippedKeysStored:                   2,
+		MetricSkippedKeysUsed:                     1,
+	}
+
+	if !reflect.DeepEqual(metrics.counters, expectedCounters) {
+		t.Fatalf("WithMetrics(): expected counters %v but got %v", expectedCounters, metrics.counters)
+	}
+
+	expectedDurations := map[string]int{MetricEncryptDuration: 3, MetricDecryptDuration: 2}
+
+	if !reflect.DeepEqual(metrics.durations, expectedDurations) {
+		t.Fatalf("WithMetrics(): expected durations %v but got %v", expectedDurations, metrics.durations)
+	}
+}
+
+func TestRatchetRekey(t *testing.T) {
+	t.Parallel()
+
+	t.Run("rekey", func(t *testing.T) {
+		t.Parallel()
+
+		sender, recipient := newTestRatchets(t)
+
+		encryptedHeaders, encryptedDatas := encryptTestMessages(t, &sender, 2)
+		epoch := sender.rootChain.Epoch()
+
+		if err := sender.Rekey(); err != nil {
+			t.Fatalf("Rekey(): expected no error but got %v", err)
+		}
+
+		nextLocalPublicKey := sender.nextLocalPublicKey.Clone()
+
+		rekeyedHeaders, rekeyedDatas := encryptTestMessages(t, &sender, 2)
+
+		if sender.rootChain.Epoch() != epoch {
+			t.Fatalf("Rekey(): expected no root chain advance before reply but got epoch %d", sender.rootChain.Epoch())
+		}
+		encryptedHeaders = append(encryptedHeaders, rekeyedHeaders...)
+		encryptedDatas = append(encryptedDatas, rekeyedDatas...)
+
+		// Note that the second message is decrypted after the rekeyed ones with a skipped key.
+		for _, i := range []int{0, 2, 3, 1} {
+			data, err := recipient.Decrypt(encryptedHeaders[i], encryptedDatas[i], nil)
+			if err != nil {
+				t.Fatalf("Decrypt(%d): expected no error but got %v", i, err)
+			}
+
+			if !bytes.Equal(data, []byte{byte(i % 2)}) {
+				t.Fatalf("Decrypt(%d): expected %v but got %v", i, []byte{byte(i % 2)}, data)
+			}
+		}
+
+		if !bytes.Equal(recipient.remotePublicKey.Bytes, nextLocalPublicKey.Bytes) {
+			t.Fatalf("Decrypt(): expected next remote public key %v but got %v", nextLocalPublicKey, recipient.remotePublicKey)
+		}
+
+		encryptedHeader, encryptedData, err := recipient.Encrypt([]byte{4}, nil)
+		if err != nil {
+			t.Fatalf("Encrypt(): expected no error for reply but got %v", err)
+		}
+
+		if _, err = sender.Decrypt(encryptedHeader, encryptedData, nil); err != nil {
+			t.Fatalf("Decrypt(): expected no error for reply but got %v", err)
+		}
+
+		if sender.nextLocalPrivateKey != nil || sender.nextLocalPublicKey != nil {
+			t.Fatal("Decrypt(): expected next key pair to be dropped after receiving step")
+		}
+	})
+
+	t.Run("rekey without remote public key", func(t *testing.T) {
+		t.Parallel()
+
+		_, recipient := newTestRatchets(t)
+
+		if err := recipient.Rekey(); !errors.Is(err, errlist.ErrInvalidValue) {
+			t.Fatalf("Rekey(): expected invalid value error but got %v", err)
+		}
+	})
+
+	crossingTests := []struct {
+		name string
+		// followRekey makes bob receive the rekeyed message before his reply, so his step uses the next public key.
+		followRekey bool
+	}{
+		{"crossing messages before remote follows rekey", false},
+		{"crossing messages after remote follows rekey", true},
+	}
+
+	for _, test := range crossingTests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			alice, bob := newTestRatchets(t)
+
+			transfer := func(from, to *Ratchet, count int) {
+				t.Helper()
+
+				encryptedHeaders, encryptedDatas := encryptTestMessages(t, from, count)
+
+				for i := range encryptedHeaders {
+					if _, err := to.Decrypt(encryptedHeaders[i], encryptedDatas[i], nil); err != nil {
+						t.Fatalf("Decrypt(%d): expected no error but got %v", i, err)
+					}
+				}
+			}
+
+			transfer(&alice, &bob, 1)
+
+			if err := alice.Rekey(); err != nil {
+				t.Fatalf("Rekey(): expected no error but got %v", err)
+			}
+
+			aliceHeaders, aliceDatas := encryptTestMessages(t, &alice, 2)
+
+			if test.followRekey {
+				if _, err := bob.Decrypt(aliceHeaders[0], aliceDatas[0], nil); err != nil {
+					t.Fatalf("Decrypt(): expected no error for rekeyed message but got %v", err)
+				}
+			}
+
+			// Note that messages of both participants are in flight at the same time.
+			bobHeaders, bobDatas := encryptTestMessages(t, &bob, 2)
+
+			for i := range aliceHeaders {
+				if test.followRekey && i == 0 {
+					continue
+				}
+
+				if _, err := bob.Decrypt(aliceHeaders[i], aliceDatas[i], nil); err != nil {
+					t.Fatalf("Decrypt(%d): expected no error for alice message but got %v", i, err)
+				}
+			}
+
+			for i := range bobHeaders {
+				if _, err := alice.Decrypt(bobHeaders[i], bobDatas[i], nil); err != nil {
+					t.Fatalf("Decrypt(%d): expected no error for bob message but got %v", i, err)
+				}
+			}
+
+			transfer(&alice, &bob, 2)
+			transfer(&bob, &alice, 2)
+
+			if alice.rootChain.Epoch() != bob.rootChain.Epoch() {
+				t.Fatalf("Decrypt(): expected equal epochs but got %d and %d", alice.rootChain.Epoch(), bob.rootChain.Epoch())
+			}
+
+			aliceSAS, err := alice.ShortAuthenticationString()
+			if err != nil {
+				t.Fatalf("ShortAuthenticationString(): expected no error but got %v", err)
+			}
+
+			bobSAS, err := bob.ShortAuthenticationString()
+			if err != nil {
+				t.Fatalf("ShortAuthenticationString(): expected no error but got %v", err)
+			}
+
+			if !reflect.DeepEqual(aliceSAS, bobSAS) {
+				t.Fatalf("ShortAuthenticationString(): expected equal strings but got %s and %s", aliceSAS, bobSAS)
+			}
+		})
+	}
+
+	tests := []struct {
+		name            string
+		options         []Option
+		advanceClock    time.Duration
+		expectedRekeyed []bool
+	}{
+		{"every messages", []Option{WithRekeyEveryMessages(2)}, 0, []bool{false, false, true, true}},
+		{"interval", []Option{WithRekeyInterval(time.Minute)}, 40 * time.Second, []bool{false, false, true, true}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			clock := time.Now()
+			now := func() time.Time { return clock }
+
+			sender, recipient := newTestRatchetsWithOptions(t, test.options, nil)
+			sender.cfg.now = now
+			sender.sendingChainRatchetedAt = clock
+
+			for i, expectedRekeyed := range test.expectedRekeyed {
+				if i > 0 {
+					clock = clock.Add(test.advanceClock)
+				}
+
+				encryptedHeader, encryptedData, err := sender.Encrypt([]byte{byte(i)}, nil)
+				if err != nil {
+					t.Fatalf("Encrypt(%d): expected no error but got %v", i, err)
+				}
+
+				if (sender.nextLocalPublicKey != nil) != expectedRekeyed {
+					t.Fatalf(
+						"Encrypt(%d): expected rekeyed %t but got next public key %v", i, expectedRekeyed, sender.nextLocalPublicKey)
+				}
+
+				data, err := recipient.Decrypt(encryptedHeader, encryptedData, nil)
+				if err != nil {
+					t.Fatalf("Decrypt(%d): expected no error but got %v", i, err)
+				}
+
+				if !bytes.Equal(data, []byte{byte(i)}) {
+					t.Fatalf("Decrypt(%d): expected %v but got %v", i, []byte{byte(i)}, data)
+				}
+			}
+
+			if !bytes.Equal(recipient.remotePublicKey.Bytes, sender.nextLocalPublicKey.Bytes) {
+				t.Fatalf(
+					"Decrypt(): expected next remote public key %v but got %v", sender.nextLocalPublicKey, recipient.remotePublicKey)
+			}
+		})
+	}
+}
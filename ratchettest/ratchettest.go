@@ -0,0 +1,382 @@
+// Package ratchettest simulates conversations over an unreliable network to test ratchets and layers, which wrap them.
+//
+// Run sends messages in random directions of random conversations, while the network drops, duplicates, delays,
+// reorders and corrupts them. All random decisions are made by a PRNG seeded with Config.Seed, so a failed run is
+// reproduced with the same seed.
+package ratchettest
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	cryptorand "crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"reflect"
+	"testing"
+
+	ratchet "github.com/platform-inf/go-ratchet"
+	"github.com/platform-inf/go-ratchet/keys"
+	"github.com/platform-inf/go-ratchet/receivingchain"
+)
+
+// Endpoint is a participant of the conversation, e.g. *ratchet.Ratchet or a layer, which wraps it. Note that errors
+// of Decrypt must wrap *receivingchain.DecryptError to tell expired messages from failures.
+type Endpoint interface {
+	Encrypt(data, auth []byte) (encryptedHeader, encryptedData []byte, err error)
+	Decrypt(encryptedHeader, encryptedData, auth []byte) ([]byte, error)
+}
+
+// Conversation is a pair of endpoints. The first endpoint must be able to send the first message, e.g. the ratchet
+// created with ratchet.NewSender.
+type Conversation [2]Endpoint
+
+// Config configures the network. Rates are probabilities in [0, 1] and delays are measured in sent messages.
+type Config struct {
+	Seed          uint64
+	MessagesCount int
+	MaxDelay      int
+	DropRate      float64
+	DuplicateRate float64
+	CorruptRate   float64
+}
+
+// Result contains counters of the run.
+type Result struct {
+	Sent       int
+	Dropped    int
+	Duplicated int
+	Corrupted  int
+	Delivered  int
+	Decrypted  int
+	// Expired is the number of messages, which are not decrypted because their keys are evicted or they are too old,
+	// e.g. because of long delays. Note that such failures are expected, because ratchets keep a bounded number of keys.
+	Expired int
+	// RejectedDuplicates is the number of rejected duplicated deliveries.
+	RejectedDuplicates int
+	// RejectedForgeries is the number of rejected corrupted messages.
+	RejectedForgeries int
+}
+
+type packet struct {
+	conversation    int
+	recipient       int
+	id              uint64
+	data            []byte
+	encryptedHeader []byte
+	encryptedData   []byte
+	deliverAt       int
+	corrupted       bool
+}
+
+// Run simulates conversations and fails the test if a delivered message is not decrypted for an unexpected reason,
+// if a duplicated or corrupted message is decrypted, if a rejected message changes the endpoint state or if endpoints
+// can not exchange messages over a reliable network at the end.
+func Run(tb testing.TB, cfg Config, conversations ...Conversation) Result {
+	tb.Helper()
+
+	if len(conversations) == 0 {
+		tb.Fatal("Run(): expected at least one conversation")
+	}
+
+	sim := simulator{
+		tb:            tb,
+		cfg:           cfg,
+		conversations: conversations,
+		random:        rand.New(rand.NewPCG(cfg.Seed, cfg.Seed)), //nolint:gosec // Simulation needs reproducibility.
+		decrypted:     make(map[uint64]bool),
+		lastDecrypted: make(map[direction]uint64),
+	}
+
+	// Note that the first endpoint sends the first message reliably, so the second endpoint is able to reply.
+	for i := range conversations {
+		sim.deliver(sim.encrypt(i, 0))
+	}
+
+	for step := range cfg.MessagesCount {
+		sim.step = step
+
+		conversation := sim.random.IntN(len(conversations))
+		sim.send(sim.encrypt(conversation, sim.random.IntN(2)))
+		sim.deliverDue()
+	}
+
+	sim.step = cfg.MessagesCount + cfg.MaxDelay
+	sim.deliverDue()
+
+	for i := range conversations {
+		for _, sender := range []int{0, 1, 0} {
+			if !sim.deliver(sim.encrypt(i, sender)) {
+				tb.Fatalf("Run(): conversation %d is inconsistent, message from endpoint %d is not decrypted", i, sender)
+			}
+		}
+	}
+
+	return sim.result
+}
+
+// NewConversation creates ratchets of a new conversation with shared initial keys. Note that both ratchets get the same
+// options, so pass stateful options, e.g. storages, with NewConversationWithOptions.
+func NewConversation(tb testing.TB, options ...ratchet.Option) (*ratchet.Ratchet, *ratchet.Ratchet) {
+	tb.Helper()
+
+	return NewConversationWithOptions(tb, options, options)
+}
+
+// NewConversationWithOptions is like NewConversation, but the sender and the recipient get different options, e.g.
+// their own storages.
+func NewConversationWithOptions(
+	tb testing.TB,
+	senderOptions []ratchet.Option,
+	recipientOptions []ratchet.Option,
+) (*ratchet.Ratchet, *ratchet.Ratchet) {
+	tb.Helper()
+
+	sender, recipient, err := newConversation(senderOptions, recipientOptions)
+	if err != nil {
+		tb.Fatalf("NewConversation(): expected no error but got %v", err)
+	}
+
+	return sender, recipient
+}
+
+type simulator struct {
+	tb            testing.TB
+	cfg           Config
+	conversations []Conversation
+	random        *rand.Rand
+	step          int
+	nextID        uint64
+	inFlight      []packet
+	decrypted     map[uint64]bool
+	lastDecrypted map[direction]uint64
+	result        Result
+}
+
+// direction identifies the recipient of the conversation.
+type direction struct {
+	conversation int
+	recipient    int
+}
+
+func (sim *simulator) encrypt(conversation, sender int) packet {
+	sim.tb.Helper()
+
+	sim.nextID++
+
+	data := binary.BigEndian.AppendUint64(nil, sim.nextID)
+	for range sim.random.IntN(32) {
+		data = append(data, byte(sim.random.Uint32()))
+	}
+
+	encryptedHeader, encryptedData, err := sim.conversations[conversation][sender].Encrypt(data, nil)
+	if err != nil {
+		sim.tb.Fatalf(
+			"Encrypt(%d): conversation %d endpoint %d expected no error but got %v", sim.nextID, conversation, sender, err)
+	}
+
+	sim.result.Sent++
+
+	return packet{
+		conversation:    conversation,
+		recipient:       1 - sender,
+		id:              sim.nextID,
+		data:            data,
+		encryptedHeader: encryptedHeader,
+		encryptedData:   encryptedData,
+	}
+}
+
+func (sim *simulator) send(p packet) {
+	if sim.random.Float64() < sim.cfg.DropRate {
+		sim.result.Dropped++
+		return
+	}
+
+	if sim.random.Float64() < sim.cfg.CorruptRate {
+		sim.result.Corrupted++
+		p = sim.corrupt(p)
+	}
+
+	sim.schedule(p)
+
+	if sim.random.Float64() < sim.cfg.DuplicateRate {
+		sim.result.Duplicated++
+		sim.schedule(p)
+	}
+}
+
+// corrupt flips a random bit of the encrypted header or the encrypted data.
+func (sim *simulator) corrupt(p packet) packet {
+	p.corrupted = true
+
+	target := &p.encryptedHeader
+	if sim.random.IntN(2) == 0 {
+		target = &p.encryptedData
+	}
+
+	*target = bytes.Clone(*target)
+	(*target)[sim.random.IntN(len(*target))] ^= 1 << sim.random.IntN(8)
+
+	return p
+}
+
+func (sim *simulator) schedule(p packet) {
+	p.deliverAt = sim.step + 1
+	if sim.cfg.MaxDelay > 0 {
+		p.deliverAt += sim.random.IntN(sim.cfg.MaxDelay + 1)
+	}
+
+	sim.inFlight = append(sim.inFlight, p)
+}
+
+func (sim *simulator) deliverDue() {
+	sim.tb.Helper()
+
+	due := sim.inFlight[:0:0]
+	inFlight := sim.inFlight[:0]
+
+	for _, p := range sim.inFlight {
+		if p.deliverAt <= sim.step {
+			due = append(due, p)
+		} else {
+			inFlight = append(inFlight, p)
+		}
+	}
+
+	sim.inFlight = inFlight
+
+	// Note that packets due at the same step are delivered in random order.
+	sim.random.Shuffle(len(due), func(i, j int) { due[i], due[j] = due[j], due[i] })
+
+	for _, p := range due {
+		sim.deliver(p)
+	}
+}
+
+// deliver decrypts the packet and checks the result. It returns whether the packet is decrypted.
+func (sim *simulator) deliver(p packet) bool {
+	sim.tb.Helper()
+
+	sim.result.Delivered++
+
+	recipient := sim.conversations[p.conversation][p.recipient]
+	stateBefore := stats(recipient)
+
+	data, err := recipient.Decrypt(p.encryptedHeader, p.encryptedData, nil)
+
+	switch {
+	case p.corrupted:
+		if err == nil {
+			sim.tb.Fatalf("Decrypt(%d): expected corrupted message to be rejected", p.id)
+		}
+
+		sim.result.RejectedForgeries++
+	case sim.decrypted[p.id]:
+		if err == nil {
+			sim.tb.Fatalf("Decrypt(%d): expected duplicated message to be rejected", p.id)
+		}
+
+		sim.result.RejectedDuplicates++
+	case err != nil:
+		// Note that header keys of old epochs are evicted, so the unknown header key is expected only if the network
+		// delayed the message after later messages of the same direction.
+		overtaken := sim.lastDecrypted[direction{p.conversation, p.recipient}] > p.id
+		if !isExpired(err, overtaken) {
+			sim.tb.Fatalf("Decrypt(%d): conversation %d expected no error but got %v", p.id, p.conversation, err)
+		}
+
+		sim.result.Expired++
+	default:
+		if !bytes.Equal(data, p.data) {
+			sim.tb.Fatalf("Decrypt(%d): expected %v but got %v", p.id, p.data, data)
+		}
+
+		sim.result.Decrypted++
+		sim.decrypted[p.id] = true
+
+		if d := (direction{p.conversation, p.recipient}); sim.lastDecrypted[d] < p.id {
+			sim.lastDecrypted[d] = p.id
+		}
+
+		return true
+	}
+
+	if stateAfter := stats(recipient); !reflect.DeepEqual(stateBefore, stateAfter) {
+		sim.tb.Fatalf("Decrypt(%d): rejected message changed state from %+v to %+v", p.id, stateBefore, stateAfter)
+	}
+
+	return false
+}
+
+// isExpired reports whether the message is not decrypted because its skipped key or header key is evicted. The header
+// key may be evicted only if the message is overtaken by later messages.
+func isExpired(err error, overtaken bool) bool {
+	var decryptErr *receivingchain.DecryptError
+	if !errors.As(err, &decryptErr) {
+		return false
+	}
+
+	switch decryptErr.Reason {
+	case receivingchain.DecryptReasonOldMessage:
+		return true
+	case receivingchain.DecryptReasonUnknownHeaderKey:
+		return overtaken
+	default:
+		return false
+	}
+}
+
+// stats returns the state of endpoints, which report it like *ratchet.Ratchet, or nil.
+func stats(endpoint Endpoint) any {
+	statter, ok := endpoint.(interface{ Stats() (ratchet.Stats, error) })
+	if !ok {
+		return nil
+	}
+
+	stats, err := statter.Stats()
+	if err != nil {
+		return err.Error()
+	}
+
+	return stats
+}
+
+func newConversation(senderOptions, recipientOptions []ratchet.Option) (*ratchet.Ratchet, *ratchet.Ratchet, error) {
+	foreignPrivateKey, err := ecdh.X25519().GenerateKey(cryptorand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("generate key: %w", err)
+	}
+
+	secret := make([]byte, 3*32)
+	if _, err := cryptorand.Read(secret); err != nil {
+		return nil, nil, fmt.Errorf("read random: %w", err)
+	}
+
+	rootKey := keys.Root{Bytes: secret[:32]}
+	senderHeaderKey := keys.Header{Bytes: secret[32:64]}
+	recipientHeaderKey := keys.Header{Bytes: secret[64:]}
+	recipientPublicKey := keys.Public{Bytes: foreignPrivateKey.PublicKey().Bytes()}
+
+	// Note that ratchets take ownership of the passed keys, so the sender gets clones of the shared keys.
+	sender, err := ratchet.NewSender(
+		recipientPublicKey.Clone(), rootKey.Clone(), senderHeaderKey.Clone(), recipientHeaderKey.Clone(), senderOptions...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("new sender: %w", err)
+	}
+
+	recipient, err := ratchet.NewRecipient(
+		keys.Private{Bytes: foreignPrivateKey.Bytes()},
+		recipientPublicKey,
+		rootKey,
+		recipientHeaderKey,
+		senderHeaderKey,
+		recipientOptions...,
+	)
+	if err != nil {
+		return nil, nil, fmt.Errorf("new recipient: %w", err)
+	}
+
+	return &sender, &recipient, nil
+}
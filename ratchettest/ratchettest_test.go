@@ -0,0 +1,68 @@
+package ratchettest
+
+import (
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		cfg  Config
+	}{
+		{"reliable network", Config{Seed: 1, MessagesCount: 200}},
+		{"reordering", Config{Seed: 2, MessagesCount: 200, MaxDelay: 5}},
+		{"unreliable network", Config{
+			Seed:          3,
+			MessagesCount: 500,
+			MaxDelay:      5,
+			DropRate:      0.1,
+			DuplicateRate: 0.1,
+			CorruptRate:   0.05,
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			conversations := make([]Conversation, 3)
+			for i := range conversations {
+				sender, recipient := NewConversation(t)
+				conversations[i] = Conversation{sender, recipient}
+			}
+
+			result := Run(t, test.cfg, conversations...)
+
+			// Note that each conversation also sends the first message and 3 messages of the final check.
+			expectedSent := test.cfg.MessagesCount + 4*len(conversations)
+			if result.Sent != expectedSent {
+				t.Fatalf("Run(): expected %d sent messages but got %+v", expectedSent, result)
+			}
+
+			if test.cfg.DuplicateRate > 0 && result.RejectedDuplicates == 0 {
+				t.Fatalf("Run(): expected rejected duplicates but got %+v", result)
+			}
+
+			if test.cfg.CorruptRate > 0 && result.RejectedForgeries == 0 {
+				t.Fatalf("Run(): expected rejected forgeries but got %+v", result)
+			}
+		})
+	}
+}
+
+func TestRunIsReproducible(t *testing.T) {
+	t.Parallel()
+
+	cfg := Config{Seed: 4, MessagesCount: 100, MaxDelay: 3, DropRate: 0.1, DuplicateRate: 0.1, CorruptRate: 0.1}
+
+	run := func() Result {
+		sender, recipient := NewConversation(t)
+		return Run(t, cfg, Conversation{sender, recipient})
+	}
+
+	if first, second := run(), run(); first != second {
+		t.Fatalf("Run(): expected the same result for the same seed but got %+v and %+v", first, second)
+	}
+}
@@ -1,27 +1,45 @@
 package receivingchain
 
 import (
+	"crypto/subtle"
 	"errors"
 	"fmt"
 
 	"github.com/platform-inf/go-ratchet/errlist"
 	"github.com/platform-inf/go-ratchet/header"
+	"github.com/platform-inf/go-ratchet/journal"
 	"github.com/platform-inf/go-ratchet/keys"
-	"github.com/platform-inf/go-utils"
+	"github.com/platform-inf/go-ratchet/messagechainscommon"
 )
 
 // Ratchet receiving chain.
 //
-// Please note that this structure may corrupt its state in case of errors. Therefore, clone the data at the top level
-// and replace the current data with it if there are no errors.
+// Please note that this structure may corrupt its state in case of errors. Therefore, copy the data at the top level,
+// pass a journal with WithJournal and restore the copy with journal rollback if there are errors.
 type Chain struct {
 	masterKey         *keys.MessageMaster
 	headerKey         *keys.Header
 	nextHeaderKey     keys.Header
 	nextMessageNumber uint64
+	epoch             uint64
+	consumedMessages  *consumedMessages
+	headerKeyEpochs   *headerKeyEpochs
+	authBuffer        []byte
 	cfg               config
 }
 
+// DecryptInfo describes the decrypted message.
+type DecryptInfo struct {
+	Header header.Header
+	// Epoch is the number of the chain, which the message belongs to, starting from 1. It is zero if the message is
+	// decrypted with a skipped key of a chain, which is too old to remember its number.
+	Epoch uint64
+	// SkippedKey reports whether the message is decrypted with a skipped key, i.e. it arrived out of order.
+	SkippedKey bool
+	// Ratchet reports whether the message triggered the Diffie-Hellman ratchet step.
+	Ratchet bool
+}
+
 func New(
 	masterKey *keys.MessageMaster,
 	headerKey *keys.Header,
@@ -39,9 +57,15 @@ func New(
 		headerKey:         headerKey,
 		nextHeaderKey:     nextHeaderKey,
 		nextMessageNumber: nextMessageNumber,
+		consumedMessages:  newConsumedMessages(),
+		headerKeyEpochs:   newHeaderKeyEpochs(),
 		cfg:               cfg,
 	}
 
+	if headerKey != nil {
+		chain.epoch = 1
+	}
+
 	return chain, nil
 }
 
@@ -49,7 +73,18 @@ func (ch Chain) Clone() Chain {
 	ch.masterKey = ch.masterKey.ClonePtr()
 	ch.headerKey = ch.headerKey.ClonePtr()
 	ch.nextHeaderKey = ch.nextHeaderKey.Clone()
+	ch.consumedMessages = ch.consumedMessages.clone()
+	ch.headerKeyEpochs = ch.headerKeyEpochs.clone()
 	ch.cfg = ch.cfg.clone()
+	ch.authBuffer = nil
+
+	return ch
+}
+
+// CloneWithJournal clones the chain, so the clone records its side effects in the passed journal, not the shared one.
+func (ch Chain) CloneWithJournal(journal *journal.Journal) Chain {
+	ch = ch.Clone()
+	ch.cfg.journal = journal
 
 	return ch
 }
@@ -60,39 +95,173 @@ func (ch *Chain) Decrypt(
 	auth []byte,
 	ratchet RatchetCallback,
 ) ([]byte, error) {
-	decryptedData, err := ch.decryptWithSkippedKeys(encryptedHeader, encryptedData, auth)
-	if err == nil {
-		return decryptedData, nil
+	return ch.DecryptTo(nil, encryptedHeader, encryptedData, auth, ratchet)
+}
+
+// DecryptTo appends decrypted data to dst and returns the extended buffer.
+func (ch *Chain) DecryptTo(
+	dst []byte,
+	encryptedHeader []byte,
+	encryptedData []byte,
+	auth []byte,
+	ratchet RatchetCallback,
+) ([]byte, error) {
+	decryptedData, _, err := ch.DecryptToWithInfo(dst, encryptedHeader, encryptedData, auth, ratchet)
+	return decryptedData, err
+}
+
+// DecryptToWithInfo is like DecryptTo, but also describes the decrypted message.
+func (ch *Chain) DecryptToWithInfo(
+	dst []byte,
+	encryptedHeader []byte,
+	encryptedData []byte,
+	auth []byte,
+	ratchet RatchetCallback,
+) ([]byte, DecryptInfo, error) {
+	if err := ch.beginSkippedKeysStorageTx(); err != nil {
+		return nil, DecryptInfo{}, newDecryptError(
+			DecryptReasonSkippedKeysStorage, nil, fmt.Errorf("%w: begin: %w", errlist.ErrSkippedKeysStorage, err))
 	}
 
-	err = fmt.Errorf("decrypt with skipped keys: %w", err)
+	ch.authBuffer = messagechainscommon.AppendMessageAuth(ch.authBuffer[:0], encryptedHeader, ch.cfg.associatedData, auth)
+	auth = ch.authBuffer
 
-	if handleErr := ch.handleEncryptedHeader(encryptedHeader, ratchet); handleErr != nil {
-		return nil, errors.Join(err, fmt.Errorf("handle encrypted header: %w", handleErr))
+	decryptedData, info, found, err := ch.decryptWithSkippedKeys(dst, encryptedHeader, encryptedData, auth)
+	if err != nil {
+		return nil, DecryptInfo{}, err
 	}
 
-	messageKey, advanceErr := ch.advance()
-	if advanceErr != nil {
-		return nil, errors.Join(err, fmt.Errorf("advance chain: %w", err))
+	if found {
+		return decryptedData, info, nil
 	}
 
-	auth = utils.ConcatByteSlices(encryptedHeader, auth)
+	decryptedHeader, ratcheted, err := ch.handleEncryptedHeader(encryptedHeader, ratchet)
+	if err != nil {
+		return nil, DecryptInfo{}, err
+	}
 
-	decryptedData, decryptErr := ch.cfg.crypto.DecryptMessage(messageKey, encryptedData, auth)
-	if decryptErr != nil {
-		return nil, errors.Join(err, fmt.Errorf("%w: decrypt message: %w", errlist.ErrCrypto, decryptErr))
+	messageKey, err := ch.advance()
+	if err != nil {
+		return nil, DecryptInfo{}, newDecryptError(
+			DecryptReasonCrypto, &decryptedHeader, fmt.Errorf("advance chain: %w", err))
 	}
 
-	// Note that here it is ok to ignore an error when decrypting with skipped keys if decryption with the next message key
-	// succeeds.
-	return decryptedData, nil
+	defer messageKey.Wipe()
+
+	decryptedData, err = ch.decryptMessage(dst, messageKey, encryptedData, auth)
+	if err != nil {
+		return nil, DecryptInfo{}, newDecryptError(
+			DecryptReasonForgedMessage,
+			&decryptedHeader,
+			fmt.Errorf("%w: decrypt message: %w", errlist.ErrCrypto, err),
+		)
+	}
+
+	ch.addConsumedMessage(*ch.headerKey, decryptedHeader.MessageNumber, encryptedHeader)
+
+	return decryptedData, DecryptInfo{Header: decryptedHeader, Epoch: ch.epoch, Ratchet: ratcheted}, nil
+}
+
+// Epoch returns the number of the current chain, i.e. the number of upgrades, starting from 1. It is zero if there is
+// no current chain yet.
+func (ch Chain) Epoch() uint64 {
+	return ch.epoch
+}
+
+// NextMessageNumber returns number of the next expected message in the current chain.
+func (ch Chain) NextMessageNumber() uint64 {
+	return ch.nextMessageNumber
 }
 
+// SkippedKeysCounts returns numbers of skipped message keys by fingerprints of their header keys.
+func (ch Chain) SkippedKeysCounts() (map[string]int, error) {
+	iter, err := ch.cfg.skippedKeysStorage.GetIter()
+	if err != nil {
+		return nil, fmt.Errorf("%w: get iter: %w", errlist.ErrSkippedKeysStorage, err)
+	}
+
+	counts := make(map[string]int)
+
+	for headerKey, messageNumberKeys := range iter {
+		count := 0
+		for range messageNumberKeys {
+			count++
+		}
+
+		if count > 0 {
+			counts[headerKey.Fingerprint()] += count
+		}
+	}
+
+	return counts, nil
+}
+
+// Upgrade replaces the chain keys with the new ones. Superseded master and header keys are wiped.
 func (ch *Chain) Upgrade(masterKey keys.MessageMaster, nextHeaderKey keys.Header) {
+	oldMasterKey, oldHeaderKey := ch.masterKey, ch.headerKey
+	headerKey := ch.nextHeaderKey
+
+	if oldHeaderKey != nil {
+		ch.addHeaderKeyEpoch(*oldHeaderKey, ch.epoch)
+	}
+
+	ch.cfg.journal.OnCommit(func() {
+		oldMasterKey.Wipe()
+		oldHeaderKey.Wipe()
+	})
+
+	ch.cfg.journal.OnRollback(func() {
+		masterKey.Wipe()
+		nextHeaderKey.Wipe()
+	})
+
 	ch.masterKey = &masterKey
-	ch.headerKey = &ch.nextHeaderKey
+	ch.headerKey = &headerKey
 	ch.nextHeaderKey = nextHeaderKey
 	ch.nextMessageNumber = 0
+	ch.epoch++
+}
+
+// Wipe overwrites all chain keys with zeros, including skipped keys if storage implements SkippedKeysStorageWiper.
+// The chain must not be used after wiping.
+func (ch *Chain) Wipe() {
+	ch.masterKey.Wipe()
+	ch.headerKey.Wipe()
+	ch.nextHeaderKey.Wipe()
+	ch.consumedMessages.wipe()
+	ch.headerKeyEpochs.wipe()
+
+	wipeSkippedKeysStorage(ch.cfg.skippedKeysStorage)
+}
+
+// addConsumedMessage records the decrypted message on commit, so rolled back decryption is not treated as consumed.
+// Note that the fingerprint and the digest are computed here, because the header key may be wiped on commit and the
+// encrypted header buffer belongs to the caller.
+func (ch *Chain) addConsumedMessage(headerKey keys.Header, messageNumber uint64, encryptedHeader []byte) {
+	consumedMessages := ch.consumedMessages
+	headerKeyFingerprint := headerKey.Fingerprint()
+	digest := digestEncryptedHeader(encryptedHeader)
+
+	ch.cfg.journal.OnCommit(func() { consumedMessages.add(headerKeyFingerprint, messageNumber, digest) })
+}
+
+// addHeaderKeyEpoch remembers the epoch of the header key, which is superseded by upgrade. Note that only the
+// fingerprint is kept, because the chain wipes the key on commit.
+func (ch *Chain) addHeaderKeyEpoch(headerKey keys.Header, epoch uint64) {
+	ch.headerKeyEpochs = ch.headerKeyEpochs.with(headerKey.Fingerprint(), epoch)
+}
+
+func (ch *Chain) addSkippedKey(headerKey keys.Header, messageNumber uint64, messageKey keys.Message) error {
+	if storage, ok := ch.cfg.skippedKeysStorage.(defaultSkippedKeysStorage); ok {
+		var evicted evictedSkippedKeys
+
+		err := storage.add(ch.cfg.journal, headerKey, messageNumber, messageKey, ch.collectEvictedSkippedKeys(&evicted))
+		ch.notifySkippedKeysEvicted(evicted)
+
+		return err
+	}
+
+	return ch.cfg.skippedKeysStorage.Add(headerKey, messageNumber, messageKey)
 }
 
 func (ch *Chain) advance() (keys.Message, error) {
@@ -105,12 +274,78 @@ func (ch *Chain) advance() (keys.Message, error) {
 		return keys.Message{}, fmt.Errorf("%w: advance via crypto: %w", errlist.ErrCrypto, err)
 	}
 
+	oldMasterKey := ch.masterKey
+	ch.cfg.journal.OnCommit(oldMasterKey.Wipe)
+	ch.cfg.journal.OnRollback(newMasterKey.Wipe)
+
 	ch.masterKey = &newMasterKey
 	ch.nextMessageNumber++
 
 	return messageKey, nil
 }
 
+// beginSkippedKeysStorageTx prepares skipped keys storage for changes, which may be rolled back with the journal.
+//
+// Note that the default storage records its changes in the journal itself and storages with transactions are committed
+// and rolled back with the journal. Other storages are cloned, so the original storage is kept untouched until commit.
+func (ch *Chain) beginSkippedKeysStorageTx() error {
+	if ch.cfg.journal == nil {
+		return nil
+	}
+
+	switch storage := ch.cfg.skippedKeysStorage.(type) {
+	case defaultSkippedKeysStorage:
+		return nil
+	case TxSkippedKeysStorage:
+		if err := storage.Begin(); err != nil {
+			return err
+		}
+
+		ch.cfg.journal.OnPrepare(func() error {
+			if err := storage.Commit(); err != nil {
+				return fmt.Errorf("%w: commit: %w", errlist.ErrSkippedKeysStorage, err)
+			}
+
+			return nil
+		})
+
+		// Note that rollback error is ignored, because the error which caused rollback is more important.
+		ch.cfg.journal.OnRollback(func() { _ = storage.Rollback() }) //nolint:errcheck // See the note above.
+
+		return nil
+	}
+
+	storage := ch.cfg.skippedKeysStorage
+	clone := storage.Clone()
+	ch.cfg.skippedKeysStorage = clone
+
+	ch.cfg.journal.OnCommit(func() { wipeSkippedKeysStorage(storage) })
+	ch.cfg.journal.OnRollback(func() {
+		ch.cfg.skippedKeysStorage = storage
+		wipeSkippedKeysStorage(clone)
+	})
+
+	return nil
+}
+
+// currentEpochMessageError returns the error for the message of the current epoch, whose number is less than the next
+// message number and which has no skipped key, i.e. the message is a duplicate or an old one.
+func (ch *Chain) currentEpochMessageError(decryptedHeader header.Header) error {
+	if ch.consumedMessages.contains(ch.headerKey.Fingerprint(), decryptedHeader.MessageNumber) {
+		return newDecryptError(
+			DecryptReasonDuplicateMessage,
+			&decryptedHeader,
+			fmt.Errorf("%w: message number %d", errlist.ErrDuplicateMessage, decryptedHeader.MessageNumber),
+		)
+	}
+
+	return newDecryptError(
+		DecryptReasonOldMessage,
+		&decryptedHeader,
+		fmt.Errorf("%w: next message number is %d", errOldMessage, ch.nextMessageNumber),
+	)
+}
+
 // decryptHeaderWithCurrentOrNextKeys must decrypt passed encrypted header with current or next header key.
 //
 // Note that ratchet is needed if header decrypted with next header key.
@@ -137,10 +372,40 @@ func (ch *Chain) decryptHeaderWithCurrentOrNextKey(
 	return decryptedHeader, true, nil
 }
 
-func (ch *Chain) decryptWithSkippedKeys(encryptedHeader, encryptedData, auth []byte) ([]byte, error) {
+func (ch *Chain) decryptMessage(dst []byte, key keys.Message, encryptedData, auth []byte) ([]byte, error) {
+	if crypto, ok := ch.cfg.crypto.(AppendCrypto); ok {
+		return crypto.AppendDecryptedMessage(dst, key, encryptedData, auth)
+	}
+
+	decryptedData, err := ch.cfg.crypto.DecryptMessage(key, encryptedData, auth)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(dst, decryptedData...), nil
+}
+
+func (ch *Chain) deleteSkippedKey(headerKey keys.Header, messageNumber uint64) error {
+	if storage, ok := ch.cfg.skippedKeysStorage.(defaultSkippedKeysStorage); ok {
+		storage.delete(ch.cfg.journal, headerKey, messageNumber)
+		return nil
+	}
+
+	return ch.cfg.skippedKeysStorage.Delete(headerKey, messageNumber)
+}
+
+// decryptWithSkippedKeys decrypts the message with skipped keys. Note that found is false without error if there is no
+// skipped key for the message.
+func (ch *Chain) decryptWithSkippedKeys(
+	dst []byte,
+	encryptedHeader []byte,
+	encryptedData []byte,
+	auth []byte,
+) (decryptedData []byte, info DecryptInfo, found bool, err error) {
 	iter, err := ch.cfg.skippedKeysStorage.GetIter()
 	if err != nil {
-		return nil, fmt.Errorf("%w: get iter: %w", errlist.ErrSkippedKeysStorage, err)
+		return nil, DecryptInfo{}, false, newDecryptError(
+			DecryptReasonSkippedKeysStorage, nil, fmt.Errorf("%w: get iter: %w", errlist.ErrSkippedKeysStorage, err))
 	}
 
 	for headerKey, messageNumberKeys := range iter {
@@ -149,53 +414,162 @@ func (ch *Chain) decryptWithSkippedKeys(encryptedHeader, encryptedData, auth []b
 			continue
 		}
 
-		for messageNumber, messageKey := range messageNumberKeys {
-			if messageNumber != decryptedHeader.MessageNumber {
+		messageKey, ok := ch.findSkippedKey(headerKey, messageNumberKeys, decryptedHeader.MessageNumber)
+		if !ok {
+			// Note that messages of the current epoch without skipped keys are handled with the current header key.
+			if ch.headerKey != nil && subtle.ConstantTimeCompare(ch.headerKey.Bytes, headerKey.Bytes) == 1 {
 				continue
 			}
 
-			decryptedData, err := ch.cfg.crypto.DecryptMessage(messageKey, encryptedData, auth)
-			if err != nil {
-				return nil, fmt.Errorf("%w: decrypt message: %w", errlist.ErrCrypto, err)
-			}
+			return nil, DecryptInfo{}, true, ch.previousEpochMessageError(headerKey, decryptedHeader)
+		}
 
-			if err := ch.cfg.skippedKeysStorage.Delete(headerKey, messageNumber); err != nil {
-				return nil, fmt.Errorf("%w: delete: %w", errlist.ErrSkippedKeysStorage, err)
-			}
+		decryptedData, err := ch.decryptMessage(dst, messageKey, encryptedData, auth)
+		if err != nil {
+			return nil, DecryptInfo{}, true, newDecryptError(
+				DecryptReasonForgedMessage,
+				&decryptedHeader,
+				fmt.Errorf("%w: decrypt message with skipped key: %w", errlist.ErrCrypto, err),
+			)
+		}
+
+		if err := ch.deleteSkippedKey(headerKey, decryptedHeader.MessageNumber); err != nil {
+			return nil, DecryptInfo{}, true, newDecryptError(
+				DecryptReasonSkippedKeysStorage,
+				&decryptedHeader,
+				fmt.Errorf("%w: delete: %w", errlist.ErrSkippedKeysStorage, err),
+			)
+		}
+
+		ch.addConsumedMessage(headerKey, decryptedHeader.MessageNumber, encryptedHeader)
+		ch.notifySkippedKeyUsed(headerKey, decryptedHeader.MessageNumber)
+
+		epoch, _ := ch.epochOf(headerKey)
+
+		return decryptedData, DecryptInfo{Header: decryptedHeader, Epoch: epoch, SkippedKey: true}, true, nil
+	}
+
+	return nil, DecryptInfo{}, false, nil
+}
+
+// epochOf returns the epoch of the header key or false if it is unknown.
+func (ch *Chain) epochOf(headerKey keys.Header) (uint64, bool) {
+	if ch.headerKey != nil && subtle.ConstantTimeCompare(ch.headerKey.Bytes, headerKey.Bytes) == 1 {
+		return ch.epoch, true
+	}
+
+	return ch.headerKeyEpochs.get(headerKey.Fingerprint())
+}
 
-			return decryptedData, nil
+// findSkippedKey finds message key by message number. Note that the default storage is searched without iteration.
+func (ch *Chain) findSkippedKey(
+	headerKey keys.Header,
+	messageNumberKeys SkippedMessageNumberKeysIter,
+	messageNumber uint64,
+) (keys.Message, bool) {
+	if storage, ok := ch.cfg.skippedKeysStorage.(defaultSkippedKeysStorage); ok {
+		return storage.get(headerKey, messageNumber)
+	}
+
+	for number, messageKey := range messageNumberKeys {
+		if number == messageNumber {
+			return messageKey, true
 		}
 	}
 
-	return nil, errors.New("no keys to decrypt header and data")
+	return keys.Message{}, false
 }
 
-func (ch *Chain) handleEncryptedHeader(encryptedHeader []byte, ratchet RatchetCallback) error {
+// handleEncryptedHeader decrypts the header, skips message keys and performs ratchet if needed. It returns whether
+// ratchet is performed. Note that all returned errors are of type *DecryptError.
+func (ch *Chain) handleEncryptedHeader(encryptedHeader []byte, ratchet RatchetCallback) (header.Header, bool, error) {
 	decryptedHeader, needRatchet, err := ch.decryptHeaderWithCurrentOrNextKey(encryptedHeader)
 	if err != nil {
-		return fmt.Errorf("decrypt header: %w", err)
+		return header.Header{}, false, ch.handleUndecryptableHeader(encryptedHeader, fmt.Errorf("decrypt header: %w", err))
+	}
+
+	if !needRatchet && decryptedHeader.MessageNumber < ch.nextMessageNumber {
+		return header.Header{}, false, ch.currentEpochMessageError(decryptedHeader)
+	}
+
+	if ch.cfg.publicKeyValidator != nil {
+		if err := ch.cfg.publicKeyValidator(decryptedHeader.PublicKey); err != nil {
+			return header.Header{}, false, newDecryptError(
+				DecryptReasonInvalidPublicKey,
+				&decryptedHeader,
+				fmt.Errorf("%w: validate public key: %w", errlist.ErrInvalidValue, err),
+			)
+		}
 	}
 
 	if needRatchet {
 		if err := ch.skipKeys(decryptedHeader.PreviousSendingChainMessagesCount); err != nil {
-			return fmt.Errorf("skip %d keys: %w", decryptedHeader.PreviousSendingChainMessagesCount, err)
+			return header.Header{}, false, newDecryptError(
+				skipKeysErrorReason(err),
+				&decryptedHeader,
+				fmt.Errorf("skip %d keys: %w", decryptedHeader.PreviousSendingChainMessagesCount, err),
+			)
 		}
 
 		if err := ratchet(decryptedHeader.PublicKey); err != nil {
-			return fmt.Errorf("ratchet: %w", err)
+			return header.Header{}, false, newDecryptError(
+				DecryptReasonRatchet, &decryptedHeader, fmt.Errorf("ratchet: %w", err))
 		}
 	}
 
 	if err := ch.skipKeys(decryptedHeader.MessageNumber); err != nil {
-		return fmt.Errorf("skip %d message keys in upgraded chain: %w", decryptedHeader.MessageNumber, err)
+		return header.Header{}, false, newDecryptError(
+			skipKeysErrorReason(err),
+			&decryptedHeader,
+			fmt.Errorf("skip %d message keys in upgraded chain: %w", decryptedHeader.MessageNumber, err),
+		)
 	}
 
-	return nil
+	return decryptedHeader, needRatchet, nil
+}
+
+// handleUndecryptableHeader checks whether the header, which can not be decrypted with current and next header keys,
+// belongs to an already decrypted message of one of the previous epochs. Note that header keys of previous epochs are
+// not kept, so such duplicates are recognized only by their encrypted headers and reported without decrypted header.
+func (ch *Chain) handleUndecryptableHeader(encryptedHeader []byte, err error) error {
+	if !ch.consumedMessages.containsEncryptedHeader(digestEncryptedHeader(encryptedHeader)) {
+		return newDecryptError(DecryptReasonUnknownHeaderKey, nil, err)
+	}
+
+	return newDecryptError(
+		DecryptReasonDuplicateMessage, nil, fmt.Errorf("%w: message of previous epoch", errlist.ErrDuplicateMessage))
+}
+
+// previousEpochMessageError returns error for the message of previous epoch, whose header is decrypted with the header
+// key of the skipped keys storage, but which has no skipped key.
+func (ch *Chain) previousEpochMessageError(headerKey keys.Header, decryptedHeader header.Header) error {
+	if ch.consumedMessages.contains(headerKey.Fingerprint(), decryptedHeader.MessageNumber) {
+		return newDecryptError(
+			DecryptReasonDuplicateMessage,
+			&decryptedHeader,
+			fmt.Errorf("%w: message number %d of previous epoch", errlist.ErrDuplicateMessage, decryptedHeader.MessageNumber),
+		)
+	}
+
+	return newDecryptError(
+		DecryptReasonOldMessage,
+		&decryptedHeader,
+		fmt.Errorf("%w: message of previous epoch without skipped key", errOldMessage),
+	)
 }
 
 func (ch *Chain) skipKeys(untilMessageNumber uint64) error {
 	if untilMessageNumber < ch.nextMessageNumber {
-		return fmt.Errorf("message number is small for the current chain, next message number is %d", ch.nextMessageNumber)
+		return fmt.Errorf("%w: next message number is %d", errOldMessage, ch.nextMessageNumber)
+	}
+
+	if untilMessageNumber-ch.nextMessageNumber > ch.cfg.maxSkippedKeysCount {
+		return fmt.Errorf(
+			"%w: %d > %d", errTooManySkippedKeys, untilMessageNumber-ch.nextMessageNumber, ch.cfg.maxSkippedKeysCount)
+	}
+
+	if ch.headerKey != nil {
+		ch.notifyKeysSkipped(*ch.headerKey, ch.nextMessageNumber, untilMessageNumber)
 	}
 
 	for messageNumber := ch.nextMessageNumber; messageNumber < untilMessageNumber; messageNumber++ {
@@ -208,7 +582,8 @@ func (ch *Chain) skipKeys(untilMessageNumber uint64) error {
 			return fmt.Errorf("%w: header key is nil", errlist.ErrInvalidValue)
 		}
 
-		if err := ch.cfg.skippedKeysStorage.Add(*ch.headerKey, messageNumber, messageKey); err != nil {
+		// Note that header key is cloned, because the chain wipes it on upgrade while storage may still keep it.
+		if err := ch.addSkippedKey(ch.headerKey.Clone(), messageNumber, messageKey); err != nil {
 			return fmt.Errorf("%w: add: %w", errlist.ErrSkippedKeysStorage, err)
 		}
 	}
@@ -2,26 +2,45 @@ package receivingchain
 
 import (
 	"fmt"
+	"slices"
 
 	"github.com/platform-inf/go-ratchet/errlist"
+	"github.com/platform-inf/go-ratchet/journal"
+	"github.com/platform-inf/go-ratchet/keys"
+	"github.com/platform-inf/go-ratchet/padding"
 	"github.com/platform-inf/go-utils"
 )
 
+// defaultMaxSkippedKeysCount matches the message keys limit of the default skipped keys storage.
+const defaultMaxSkippedKeysCount = defaultSkippedKeysStorageMessageKeysLenLimit
+
 type config struct {
-	crypto             Crypto
-	skippedKeysStorage SkippedKeysStorage
+	associatedData         []byte
+	crypto                 Crypto
+	headerPaddingBlockSize int
+	journal                *journal.Journal
+	maxSkippedKeysCount    uint64
+	observer               Observer
+	paddingScheme          padding.Scheme
+	publicKeyValidator     func(publicKey keys.Public) error
+	skippedKeysStorage     SkippedKeysStorage
 }
 
 func newConfig(options ...Option) (config, error) {
 	cfg := config{
-		crypto:             newDefaultCrypto(),
-		skippedKeysStorage: newDefaultSkippedKeysStorage(),
+		crypto:              newDefaultCrypto(),
+		maxSkippedKeysCount: defaultMaxSkippedKeysCount,
+		skippedKeysStorage:  newDefaultSkippedKeysStorage(),
 	}
 
 	if err := cfg.applyOptions(options...); err != nil {
 		return config{}, fmt.Errorf("%w: %w", errlist.ErrOption, err)
 	}
 
+	if err := cfg.configureDefaultCrypto(); err != nil {
+		return config{}, fmt.Errorf("%w: %w", errlist.ErrOption, err)
+	}
+
 	return cfg, nil
 }
 
@@ -40,8 +59,41 @@ func (cfg config) clone() config {
 	return cfg
 }
 
+// configureDefaultCrypto passes crypto related options to the default crypto. Note that these options are not
+// supported by custom crypto, which must implement them on its own.
+func (cfg *config) configureDefaultCrypto() error {
+	if cfg.headerPaddingBlockSize == 0 && cfg.paddingScheme == nil {
+		return nil
+	}
+
+	crypto, ok := cfg.crypto.(defaultCrypto)
+	if !ok {
+		return fmt.Errorf("%w: padding is not supported by custom crypto", errlist.ErrInvalidValue)
+	}
+
+	crypto.headerPaddingBlockSize = cfg.headerPaddingBlockSize
+	crypto.paddingScheme = cfg.paddingScheme
+	cfg.crypto = crypto
+
+	return nil
+}
+
 type Option func(cfg *config) error
 
+// WithAssociatedData sets associated data of the conversation, e.g. identity public keys of both participants, which is
+// authenticated with every message before the auth passed to Decrypt. Both participants must use the same data.
+func WithAssociatedData(data []byte) Option {
+	return func(cfg *config) error {
+		if len(data) == 0 {
+			return fmt.Errorf("%w: associated data is empty", errlist.ErrInvalidValue)
+		}
+
+		cfg.associatedData = slices.Clone(data)
+
+		return nil
+	}
+}
+
 func WithCrypto(crypto Crypto) Option {
 	return func(cfg *config) error {
 		if utils.IsNil(crypto) {
@@ -54,6 +106,90 @@ func WithCrypto(crypto Crypto) Option {
 	}
 }
 
+// WithHeaderPadding strictly strips padding added by the sending chain with the same block size from decrypted
+// headers.
+func WithHeaderPadding(blockSize int) Option {
+	return func(cfg *config) error {
+		if blockSize <= 0 {
+			return fmt.Errorf("%w: non-positive header padding block size %d", errlist.ErrInvalidValue, blockSize)
+		}
+
+		cfg.headerPaddingBlockSize = blockSize
+
+		return nil
+	}
+}
+
+// WithJournal makes the chain record its side effects, e.g. wiping of superseded keys, in the passed journal instead of
+// applying them immediately. It allows to roll back a shallow copy of the chain.
+func WithJournal(journal *journal.Journal) Option {
+	return func(cfg *config) error {
+		if journal == nil {
+			return fmt.Errorf("%w: journal is nil", errlist.ErrInvalidValue)
+		}
+
+		cfg.journal = journal
+
+		return nil
+	}
+}
+
+// WithMaxSkippedKeysCount limits the number of message keys, which may be skipped to decrypt one message. It protects
+// from messages with huge message numbers, which would make the chain advance for too long. Default limit is 1024.
+// Note that the limit is checked by the chain, so it applies to any skipped keys storage.
+func WithMaxSkippedKeysCount(count uint64) Option {
+	return func(cfg *config) error {
+		if count == 0 {
+			return fmt.Errorf("%w: max skipped keys count is zero", errlist.ErrInvalidValue)
+		}
+
+		cfg.maxSkippedKeysCount = count
+
+		return nil
+	}
+}
+
+// WithObserver sets observer of the chain events.
+func WithObserver(observer Observer) Option {
+	return func(cfg *config) error {
+		if utils.IsNil(observer) {
+			return fmt.Errorf("%w: observer is nil", errlist.ErrInvalidValue)
+		}
+
+		cfg.observer = observer
+
+		return nil
+	}
+}
+
+// WithPadding strips padding added by the sending chain with the same scheme from decrypted data. Data with invalid
+// padding is rejected.
+func WithPadding(scheme padding.Scheme) Option {
+	return func(cfg *config) error {
+		if utils.IsNil(scheme) {
+			return fmt.Errorf("%w: padding scheme is nil", errlist.ErrInvalidValue)
+		}
+
+		cfg.paddingScheme = scheme
+
+		return nil
+	}
+}
+
+// WithPublicKeyValidator sets validator of public keys from decrypted headers. Headers with invalid public keys are
+// rejected before the Diffie-Hellman ratchet step.
+func WithPublicKeyValidator(validate func(publicKey keys.Public) error) Option {
+	return func(cfg *config) error {
+		if validate == nil {
+			return fmt.Errorf("%w: public key validator is nil", errlist.ErrInvalidValue)
+		}
+
+		cfg.publicKeyValidator = validate
+
+		return nil
+	}
+}
+
 func WithSkippedKeysStorage(storage SkippedKeysStorage) Option {
 	return func(cfg *config) error {
 		if utils.IsNil(storage) {
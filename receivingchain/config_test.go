@@ -84,6 +84,14 @@ func TestNewConfig(t *testing.T) {
 		if utils.IsNil(cfg.skippedKeysStorage) {
 			t.Fatal("newConfig() sets no default value for skipped keys storage")
 		}
+
+		if cfg.maxSkippedKeysCount != defaultMaxSkippedKeysCount {
+			t.Fatalf(
+				"newConfig() expected max skipped keys count %d but got %d",
+				defaultMaxSkippedKeysCount,
+				cfg.maxSkippedKeysCount,
+			)
+		}
 	})
 
 	t.Run("crypto option success", func(t *testing.T) {
@@ -147,4 +155,13 @@ func TestNewConfig(t *testing.T) {
 			t.Fatalf("WithSkippedKeysStorage(nil) error is not invalid value error but %v", err)
 		}
 	})
+
+	t.Run("max skipped keys count error", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := newConfig(WithMaxSkippedKeysCount(0))
+		if err == nil || err.Error() != "option: invalid value: max skipped keys count is zero" {
+			t.Fatalf("WithMaxSkippedKeysCount(0) expected error but got %v", err)
+		}
+	})
 }
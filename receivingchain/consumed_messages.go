@@ -0,0 +1,125 @@
+package receivingchain
+
+import (
+	"maps"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+const (
+	consumedMessagesEpochsLenLimit  = 4
+	consumedMessagesNumbersLenLimit = 1024
+)
+
+// consumedMessages is a bounded window of decrypted messages by receiving epochs, which allows to tell duplicated
+// messages from old ones.
+//
+// Note that epochs are identified by fingerprints of their header keys and messages also by digests of their encrypted
+// headers, so no keys are kept and duplicates of previous epochs are detected even after their header keys are wiped.
+type consumedMessages struct {
+	epochs []*consumedEpoch
+}
+
+type consumedEpoch struct {
+	headerKeyFingerprint string
+	numbers              map[uint64]struct{}
+	encryptedHeaders     map[encryptedHeaderDigest]struct{}
+	order                []consumedMessage
+}
+
+type consumedMessage struct {
+	number                uint64
+	encryptedHeaderDigest encryptedHeaderDigest
+}
+
+type encryptedHeaderDigest [blake2b.Size256]byte
+
+func newConsumedMessages() *consumedMessages {
+	return new(consumedMessages)
+}
+
+// add records the decrypted message. The oldest epochs and messages are dropped when limits are exceeded.
+func (cm *consumedMessages) add(headerKeyFingerprint string, messageNumber uint64, digest encryptedHeaderDigest) {
+	epoch := cm.find(headerKeyFingerprint)
+	if epoch == nil {
+		epoch = &consumedEpoch{
+			headerKeyFingerprint: headerKeyFingerprint,
+			numbers:              make(map[uint64]struct{}),
+			encryptedHeaders:     make(map[encryptedHeaderDigest]struct{}),
+		}
+		cm.epochs = append(cm.epochs, epoch)
+
+		if len(cm.epochs) > consumedMessagesEpochsLenLimit {
+			cm.epochs = cm.epochs[1:]
+		}
+	}
+
+	if _, exists := epoch.numbers[messageNumber]; exists {
+		return
+	}
+
+	if len(epoch.order) >= consumedMessagesNumbersLenLimit {
+		delete(epoch.numbers, epoch.order[0].number)
+		delete(epoch.encryptedHeaders, epoch.order[0].encryptedHeaderDigest)
+		epoch.order = epoch.order[1:]
+	}
+
+	epoch.numbers[messageNumber] = struct{}{}
+	epoch.encryptedHeaders[digest] = struct{}{}
+	epoch.order = append(epoch.order, consumedMessage{number: messageNumber, encryptedHeaderDigest: digest})
+}
+
+func (cm *consumedMessages) clone() *consumedMessages {
+	clone := &consumedMessages{epochs: make([]*consumedEpoch, 0, len(cm.epochs))}
+
+	for _, epoch := range cm.epochs {
+		clone.epochs = append(clone.epochs, &consumedEpoch{
+			headerKeyFingerprint: epoch.headerKeyFingerprint,
+			numbers:              maps.Clone(epoch.numbers),
+			encryptedHeaders:     maps.Clone(epoch.encryptedHeaders),
+			order:                append([]consumedMessage(nil), epoch.order...),
+		})
+	}
+
+	return clone
+}
+
+func (cm *consumedMessages) contains(headerKeyFingerprint string, messageNumber uint64) bool {
+	epoch := cm.find(headerKeyFingerprint)
+	if epoch == nil {
+		return false
+	}
+
+	_, exists := epoch.numbers[messageNumber]
+
+	return exists
+}
+
+// containsEncryptedHeader reports whether the message with the same encrypted header is consumed in any kept epoch.
+func (cm *consumedMessages) containsEncryptedHeader(digest encryptedHeaderDigest) bool {
+	for _, epoch := range cm.epochs {
+		if _, exists := epoch.encryptedHeaders[digest]; exists {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (cm *consumedMessages) find(headerKeyFingerprint string) *consumedEpoch {
+	for _, epoch := range cm.epochs {
+		if epoch.headerKeyFingerprint == headerKeyFingerprint {
+			return epoch
+		}
+	}
+
+	return nil
+}
+
+func (cm *consumedMessages) wipe() {
+	cm.epochs = nil
+}
+
+func digestEncryptedHeader(encryptedHeader []byte) encryptedHeaderDigest {
+	return blake2b.Sum256(encryptedHeader)
+}
@@ -0,0 +1,73 @@
+package receivingchain
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestConsumedMessagesAdd(t *testing.T) {
+	t.Parallel()
+
+	t.Run("test numbers limit", func(t *testing.T) {
+		t.Parallel()
+
+		consumedMessages := newConsumedMessages()
+
+		for i := range consumedMessagesNumbersLenLimit + 1 {
+			consumedMessages.add("1", uint64(i), encryptedHeaderDigest{byte(i), byte(i >> 8)})
+		}
+
+		if consumedMessages.contains("1", 0) || consumedMessages.containsEncryptedHeader(encryptedHeaderDigest{}) {
+			t.Fatal("add(): expected the oldest message to be dropped")
+		}
+
+		if !consumedMessages.contains("1", consumedMessagesNumbersLenLimit) ||
+			!consumedMessages.containsEncryptedHeader(encryptedHeaderDigest{0, consumedMessagesNumbersLenLimit >> 8}) {
+			t.Fatal("add(): expected the newest message to be kept")
+		}
+
+		if len(consumedMessages.epochs[0].order) != consumedMessagesNumbersLenLimit {
+			t.Fatalf(
+				"add(): expected %d numbers but got %d", consumedMessagesNumbersLenLimit, len(consumedMessages.epochs[0].order))
+		}
+	})
+
+	t.Run("test epochs limit", func(t *testing.T) {
+		t.Parallel()
+
+		consumedMessages := newConsumedMessages()
+
+		consumedMessages.add("0", 0, encryptedHeaderDigest{0})
+
+		for i := range consumedMessagesEpochsLenLimit {
+			consumedMessages.add(strconv.Itoa(i+1), 0, encryptedHeaderDigest{byte(i + 1)})
+		}
+
+		if len(consumedMessages.epochs) != consumedMessagesEpochsLenLimit {
+			t.Fatalf("add(): expected %d epochs but got %d", consumedMessagesEpochsLenLimit, len(consumedMessages.epochs))
+		}
+
+		if consumedMessages.contains("0", 0) || consumedMessages.containsEncryptedHeader(encryptedHeaderDigest{0}) {
+			t.Fatal("add(): expected the oldest epoch to be dropped")
+		}
+	})
+
+	t.Run("test clone", func(t *testing.T) {
+		t.Parallel()
+
+		consumedMessages := newConsumedMessages()
+
+		consumedMessages.add("1", 0, encryptedHeaderDigest{0})
+
+		clone := consumedMessages.clone()
+		clone.add("1", 1, encryptedHeaderDigest{1})
+
+		if consumedMessages.contains("1", 1) || consumedMessages.containsEncryptedHeader(encryptedHeaderDigest{1}) {
+			t.Fatal("clone(): changes of the clone affect the original")
+		}
+
+		if !clone.contains("1", 0) || !clone.containsEncryptedHeader(encryptedHeaderDigest{0}) {
+			t.Fatal("clone(): expected cloned messages")
+		}
+	})
+}
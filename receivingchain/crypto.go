@@ -1,16 +1,14 @@
 package receivingchain
 
 import (
-	"crypto/hmac"
 	"fmt"
-	"hash"
 
-	"golang.org/x/crypto/blake2b"
 	cipher "golang.org/x/crypto/chacha20poly1305"
 
 	"github.com/platform-inf/go-ratchet/header"
 	"github.com/platform-inf/go-ratchet/keys"
 	"github.com/platform-inf/go-ratchet/messagechainscommon"
+	"github.com/platform-inf/go-ratchet/padding"
 )
 
 type Crypto interface {
@@ -19,44 +17,23 @@ type Crypto interface {
 	DecryptMessage(key keys.Message, encryptedData, auth []byte) ([]byte, error)
 }
 
-type defaultCrypto struct{}
+// AppendCrypto is an optional interface of Crypto, which decrypts into caller buffers to reduce allocations.
+type AppendCrypto interface {
+	// AppendDecryptedMessage must append decrypted data to dst and return the extended buffer.
+	AppendDecryptedMessage(dst []byte, key keys.Message, encryptedData, auth []byte) ([]byte, error)
+}
+
+type defaultCrypto struct {
+	headerPaddingBlockSize int
+	paddingScheme          padding.Scheme
+}
 
 func newDefaultCrypto() defaultCrypto {
 	return defaultCrypto{}
 }
 
 func (c defaultCrypto) AdvanceChain(masterKey keys.MessageMaster) (keys.MessageMaster, keys.Message, error) {
-	var newHashErr error
-
-	getHasher := func() hash.Hash {
-		var hasher hash.Hash
-		hasher, newHashErr = blake2b.New512(nil)
-
-		return hasher
-	}
-
-	mac := hmac.New(getHasher, masterKey.Bytes)
-
-	const masterKeyByte = 0x02
-	if _, err := mac.Write([]byte{masterKeyByte}); err != nil {
-		return keys.MessageMaster{}, keys.Message{}, fmt.Errorf("write %d byte to MAC: %w", masterKeyByte, err)
-	}
-
-	newMasterKey := keys.MessageMaster{Bytes: mac.Sum(nil)}
-	mac.Reset()
-
-	const messageKeyByte = 0x01
-	if _, err := mac.Write([]byte{messageKeyByte}); err != nil {
-		return keys.MessageMaster{}, keys.Message{}, fmt.Errorf("write %d byte to MAC: %w", messageKeyByte, err)
-	}
-
-	messageKey := keys.Message{Bytes: mac.Sum(nil)}
-
-	if newHashErr != nil {
-		return keys.MessageMaster{}, keys.Message{}, fmt.Errorf("new hash: %w", newHashErr)
-	}
-
-	return newMasterKey, messageKey, nil
+	return messagechainscommon.AdvanceChain(masterKey)
 }
 
 func (c defaultCrypto) DecryptHeader(key keys.Header, encryptedHeader []byte) (header.Header, error) {
@@ -65,12 +42,19 @@ func (c defaultCrypto) DecryptHeader(key keys.Header, encryptedHeader []byte) (h
 	}
 
 	decryptedHeaderBytes, err := c.decrypt(
+		nil,
 		key.Bytes, encryptedHeader[:cipher.NonceSizeX], encryptedHeader[cipher.NonceSizeX:], nil)
 	if err != nil {
 		return header.Header{}, err
 	}
 
-	decryptedHeader, err := header.Decode(decryptedHeaderBytes)
+	var decryptedHeader header.Header
+	if c.headerPaddingBlockSize > 0 {
+		decryptedHeader, err = header.DecodePadded(decryptedHeaderBytes, c.headerPaddingBlockSize)
+	} else {
+		decryptedHeader, err = header.Decode(decryptedHeaderBytes)
+	}
+
 	if err != nil {
 		return header.Header{}, fmt.Errorf("decode decrypted header: %w", err)
 	}
@@ -78,22 +62,46 @@ func (c defaultCrypto) DecryptHeader(key keys.Header, encryptedHeader []byte) (h
 	return decryptedHeader, nil
 }
 
-func (c defaultCrypto) DecryptMessage(key keys.Message, encryptedData, auth []byte) ([]byte, error) {
+func (c defaultCrypto) AppendDecryptedMessage(
+	dst []byte,
+	key keys.Message,
+	encryptedData []byte,
+	auth []byte,
+) ([]byte, error) {
 	cipherKey, nonce, err := messagechainscommon.DeriveMessageCipherKeyAndNonce(key)
 	if err != nil {
 		return nil, fmt.Errorf("derive key and nonce: %w", err)
 	}
 
-	return c.decrypt(cipherKey, nonce, encryptedData, auth)
+	defer clear(cipherKey)
+
+	dataStart := len(dst)
+
+	dst, err = c.decrypt(dst, cipherKey, nonce, encryptedData, auth)
+	if err != nil || c.paddingScheme == nil {
+		return dst, err
+	}
+
+	data, err := padding.Strip(dst[dataStart:], c.paddingScheme)
+	if err != nil {
+		clear(dst[dataStart:])
+		return nil, fmt.Errorf("strip padding: %w", err)
+	}
+
+	return dst[:dataStart+len(data)], nil
+}
+
+func (c defaultCrypto) DecryptMessage(key keys.Message, encryptedData, auth []byte) ([]byte, error) {
+	return c.AppendDecryptedMessage(nil, key, encryptedData, auth)
 }
 
-func (c defaultCrypto) decrypt(key, nonce, encryptedData, auth []byte) ([]byte, error) {
+func (c defaultCrypto) decrypt(dst, key, nonce, encryptedData, auth []byte) ([]byte, error) {
 	cipher, err := cipher.NewX(key)
 	if err != nil {
 		return nil, fmt.Errorf("new cipher: %w", err)
 	}
 
-	data, err := cipher.Open(nil, nonce, encryptedData, auth)
+	data, err := cipher.Open(dst, nonce, encryptedData, auth)
 	if err != nil {
 		return nil, fmt.Errorf("decrypt: %w", err)
 	}
@@ -0,0 +1,108 @@
+package receivingchain
+
+import (
+	"errors"
+
+	"github.com/platform-inf/go-ratchet/errlist"
+	"github.com/platform-inf/go-ratchet/header"
+)
+
+var (
+	errOldMessage         = errors.New("message number is less than the next message number of the chain")
+	errTooManySkippedKeys = errors.New("too many message keys to skip")
+)
+
+// DecryptReason is the reason of decryption failure, which helps to decide, whether to drop the message, ask for resend
+// or reset the conversation.
+type DecryptReason int
+
+const (
+	DecryptReasonUnknown DecryptReason = iota
+	// DecryptReasonUnknownHeaderKey means that the header can not be decrypted with any known header key, e.g. the
+	// message is forged, corrupted or from another conversation.
+	DecryptReasonUnknownHeaderKey
+	// DecryptReasonForgedMessage means that the header is decrypted, but the data is not authenticated, e.g. the data or
+	// the auth is forged or corrupted.
+	DecryptReasonForgedMessage
+	// DecryptReasonOldMessage means that the message is older than the chain and there is no skipped key for it, e.g.
+	// its skipped key is evicted or the message is duplicated, but it is out of the window of consumed messages.
+	DecryptReasonOldMessage
+	// DecryptReasonTooManySkippedKeys means that decryption requires to skip more message keys than allowed.
+	DecryptReasonTooManySkippedKeys
+	// DecryptReasonSkippedKeysStorage means that the skipped keys storage failed.
+	DecryptReasonSkippedKeysStorage
+	// DecryptReasonRatchet means that Diffie-Hellman ratchet step failed, e.g. because of invalid remote public key.
+	DecryptReasonRatchet
+	// DecryptReasonCrypto means that the chain crypto failed to advance the chain.
+	DecryptReasonCrypto
+	// DecryptReasonDuplicateMessage means that the message is already decrypted, e.g. it is delivered twice. Such
+	// messages are safe to drop. Note that errors with this reason also match errlist.ErrDuplicateMessage.
+	DecryptReasonDuplicateMessage
+	// DecryptReasonInvalidPublicKey means that the decrypted header contains invalid public key, e.g. of wrong length.
+	// Note that errors with this reason also match errlist.ErrInvalidValue.
+	DecryptReasonInvalidPublicKey
+)
+
+func (r DecryptReason) String() string {
+	switch r {
+	case DecryptReasonUnknownHeaderKey:
+		return "unknown_header_key"
+	case DecryptReasonForgedMessage:
+		return "forged_message"
+	case DecryptReasonOldMessage:
+		return "old_message"
+	case DecryptReasonTooManySkippedKeys:
+		return "too_many_skipped_keys"
+	case DecryptReasonSkippedKeysStorage:
+		return "skipped_keys_storage"
+	case DecryptReasonRatchet:
+		return "ratchet"
+	case DecryptReasonCrypto:
+		return "crypto"
+	case DecryptReasonDuplicateMessage:
+		return "duplicate_message"
+	case DecryptReasonInvalidPublicKey:
+		return "invalid_public_key"
+	default:
+		return "unknown"
+	}
+}
+
+// DecryptError is returned by Decrypt. Use errors.As to get it. Note that Err still wraps errlist categories.
+type DecryptError struct {
+	Reason DecryptReason
+	// Header is the decrypted header or nil if the header is not decrypted.
+	Header *header.Header
+	Err    error
+}
+
+func newDecryptError(reason DecryptReason, decryptedHeader *header.Header, err error) *DecryptError {
+	if decryptedHeader != nil {
+		headerClone := decryptedHeader.Clone()
+		decryptedHeader = &headerClone
+	}
+
+	return &DecryptError{Reason: reason, Header: decryptedHeader, Err: err}
+}
+
+func (e *DecryptError) Error() string {
+	return e.Reason.String() + ": " + e.Err.Error()
+}
+
+func (e *DecryptError) Unwrap() error {
+	return e.Err
+}
+
+// skipKeysErrorReason returns reason of the error returned by skipKeys.
+func skipKeysErrorReason(err error) DecryptReason {
+	switch {
+	case errors.Is(err, errOldMessage):
+		return DecryptReasonOldMessage
+	case errors.Is(err, errTooManySkippedKeys):
+		return DecryptReasonTooManySkippedKeys
+	case errors.Is(err, errlist.ErrSkippedKeysStorage):
+		return DecryptReasonSkippedKeysStorage
+	default:
+		return DecryptReasonCrypto
+	}
+}
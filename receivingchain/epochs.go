@@ -0,0 +1,55 @@
+package receivingchain
+
+import "slices"
+
+const headerKeyEpochsLenLimit = 64
+
+// headerKeyEpochs maps fingerprints of header keys of previous chains to their epochs, so messages decrypted with
+// skipped keys are reported with the epoch of their chain.
+//
+// Note that only the last epochs are kept, so skipped keys of older epochs are reported with the zero epoch.
+type headerKeyEpochs struct {
+	entries []headerKeyEpoch
+}
+
+type headerKeyEpoch struct {
+	headerKeyFingerprint string
+	epoch                uint64
+}
+
+func newHeaderKeyEpochs() *headerKeyEpochs {
+	return new(headerKeyEpochs)
+}
+
+// with returns a copy with the epoch of the header key fingerprint, where the oldest epoch is dropped if the limit is
+// exceeded. Note that the receiver is not changed, so a shallow copy of the chain can be restored on rollback.
+func (e *headerKeyEpochs) with(headerKeyFingerprint string, epoch uint64) *headerKeyEpochs {
+	entries := make([]headerKeyEpoch, 0, len(e.entries)+1)
+	entries = append(entries, e.entries...)
+	entries = append(entries, headerKeyEpoch{headerKeyFingerprint: headerKeyFingerprint, epoch: epoch})
+
+	if len(entries) > headerKeyEpochsLenLimit {
+		entries = entries[1:]
+	}
+
+	return &headerKeyEpochs{entries: entries}
+}
+
+func (e *headerKeyEpochs) clone() *headerKeyEpochs {
+	return &headerKeyEpochs{entries: slices.Clone(e.entries)}
+}
+
+// get returns the epoch of the header key fingerprint or false if it is unknown.
+func (e *headerKeyEpochs) get(headerKeyFingerprint string) (uint64, bool) {
+	for _, entry := range e.entries {
+		if entry.headerKeyFingerprint == headerKeyFingerprint {
+			return entry.epoch, true
+		}
+	}
+
+	return 0, false
+}
+
+func (e *headerKeyEpochs) wipe() {
+	e.entries = nil
+}
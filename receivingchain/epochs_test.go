@@ -0,0 +1,54 @@
+package receivingchain
+
+import "testing"
+
+func TestHeaderKeyEpochs(t *testing.T) {
+	t.Parallel()
+
+	t.Run("test limit", func(t *testing.T) {
+		t.Parallel()
+
+		headerKeyEpochs := newHeaderKeyEpochs()
+
+		for i := range headerKeyEpochsLenLimit + 1 {
+			headerKeyEpochs = headerKeyEpochs.with(string(rune(i)), uint64(i+1))
+		}
+
+		if epoch, ok := headerKeyEpochs.get(string(rune(0))); ok {
+			t.Fatalf("get(): expected the oldest epoch to be dropped but got %d", epoch)
+		}
+
+		lastFingerprint := string(rune(headerKeyEpochsLenLimit))
+		if epoch, ok := headerKeyEpochs.get(lastFingerprint); !ok || epoch != headerKeyEpochsLenLimit+1 {
+			t.Fatalf("get(): expected epoch %d but got %d, %t", headerKeyEpochsLenLimit+1, epoch, ok)
+		}
+	})
+
+	t.Run("test with keeps receiver", func(t *testing.T) {
+		t.Parallel()
+
+		headerKeyEpochs := newHeaderKeyEpochs()
+		headerKeyEpochs.with("fingerprint", 1)
+
+		if _, ok := headerKeyEpochs.get("fingerprint"); ok {
+			t.Fatal("with(): expected the receiver not to be changed")
+		}
+	})
+
+	t.Run("test clone and wipe", func(t *testing.T) {
+		t.Parallel()
+
+		headerKeyEpochs := newHeaderKeyEpochs().with("fingerprint", 3)
+
+		clone := headerKeyEpochs.clone()
+		headerKeyEpochs.wipe()
+
+		if epoch, ok := clone.get("fingerprint"); !ok || epoch != 3 {
+			t.Fatalf("clone(): expected epoch 3 but got %d, %t", epoch, ok)
+		}
+
+		if _, ok := headerKeyEpochs.get("fingerprint"); ok {
+			t.Fatal("wipe(): expected no epochs")
+		}
+	})
+}
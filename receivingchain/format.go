@@ -0,0 +1,30 @@
+package receivingchain
+
+import (
+	"fmt"
+	"log/slog"
+)
+
+// Format prints only the next message number of the chain.
+func (ch Chain) Format(state fmt.State, verb rune) {
+	if verb == 'v' && state.Flag('#') {
+		_, _ = state.Write([]byte(ch.GoString()))
+		return
+	}
+
+	_, _ = state.Write([]byte(ch.String()))
+}
+
+func (ch Chain) GoString() string {
+	return "receivingchain." + ch.String()
+}
+
+func (ch Chain) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.Uint64("next_message_number", ch.nextMessageNumber),
+	)
+}
+
+func (ch Chain) String() string {
+	return fmt.Sprintf("Chain{next message number: %d}", ch.nextMessageNumber)
+}
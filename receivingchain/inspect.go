@@ -0,0 +1,86 @@
+package receivingchain
+
+import (
+	"crypto/subtle"
+	"fmt"
+
+	"github.com/platform-inf/go-ratchet/errlist"
+	"github.com/platform-inf/go-ratchet/header"
+)
+
+// HeaderClass tells how the message of the inspected header would be decrypted.
+type HeaderClass int
+
+const (
+	HeaderClassUnknown HeaderClass = iota
+	// HeaderClassSkipped means that the message has a skipped key, i.e. it arrived out of order.
+	HeaderClassSkipped
+	// HeaderClassCurrent means that the message belongs to the current chain and is not decrypted yet.
+	HeaderClassCurrent
+	// HeaderClassNewEpoch means that the message starts the next chain, so it triggers the Diffie-Hellman ratchet step.
+	HeaderClassNewEpoch
+)
+
+func (c HeaderClass) String() string {
+	switch c {
+	case HeaderClassSkipped:
+		return "skipped"
+	case HeaderClassCurrent:
+		return "current"
+	case HeaderClassNewEpoch:
+		return "new_epoch"
+	default:
+		return "unknown"
+	}
+}
+
+// HeaderInfo describes the inspected header. Epoch is the same as in DecryptInfo.
+type HeaderInfo struct {
+	Header header.Header
+	Class  HeaderClass
+	Epoch  uint64
+}
+
+// InspectHeader decrypts the header with skipped, current and next header keys in the same order as Decrypt, but it
+// never changes the chain, e.g. to route the message before decryption. Like Decrypt, it returns *DecryptError for
+// unknown header keys, duplicates and old messages.
+func (ch Chain) InspectHeader(encryptedHeader []byte) (HeaderInfo, error) {
+	iter, err := ch.cfg.skippedKeysStorage.GetIter()
+	if err != nil {
+		return HeaderInfo{}, fmt.Errorf("%w: get iter: %w", errlist.ErrSkippedKeysStorage, err)
+	}
+
+	for headerKey, messageNumberKeys := range iter {
+		decryptedHeader, err := ch.cfg.crypto.DecryptHeader(headerKey, encryptedHeader)
+		if err != nil {
+			continue
+		}
+
+		if _, ok := ch.findSkippedKey(headerKey, messageNumberKeys, decryptedHeader.MessageNumber); !ok {
+			if ch.headerKey != nil && subtle.ConstantTimeCompare(ch.headerKey.Bytes, headerKey.Bytes) == 1 {
+				continue
+			}
+
+			return HeaderInfo{}, ch.previousEpochMessageError(headerKey, decryptedHeader)
+		}
+
+		epoch, _ := ch.epochOf(headerKey)
+
+		return HeaderInfo{Header: decryptedHeader, Class: HeaderClassSkipped, Epoch: epoch}, nil
+	}
+
+	decryptedHeader, needRatchet, err := ch.decryptHeaderWithCurrentOrNextKey(encryptedHeader)
+	if err != nil {
+		return HeaderInfo{}, ch.handleUndecryptableHeader(encryptedHeader, fmt.Errorf("decrypt header: %w", err))
+	}
+
+	if needRatchet {
+		return HeaderInfo{Header: decryptedHeader, Class: HeaderClassNewEpoch, Epoch: ch.epoch + 1}, nil
+	}
+
+	if decryptedHeader.MessageNumber < ch.nextMessageNumber {
+		return HeaderInfo{}, ch.currentEpochMessageError(decryptedHeader)
+	}
+
+	return HeaderInfo{Header: decryptedHeader, Class: HeaderClassCurrent, Epoch: ch.epoch}, nil
+}
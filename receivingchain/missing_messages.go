@@ -0,0 +1,49 @@
+package receivingchain
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+
+	"github.com/platform-inf/go-ratchet/errlist"
+	"github.com/platform-inf/go-ratchet/keys"
+)
+
+// MissingMessage identifies the message, which is skipped, i.e. later messages of its chain or newer chains are
+// decrypted, but the message itself is not. Epoch is the same as in DecryptInfo.
+type MissingMessage struct {
+	Epoch         uint64
+	MessageNumber uint64
+}
+
+// MissingMessages returns messages, which have skipped keys, sorted by epoch and message number, e.g. to request their
+// re-delivery.
+func (ch Chain) MissingMessages() ([]MissingMessage, error) {
+	iter, err := ch.cfg.skippedKeysStorage.GetIter()
+	if err != nil {
+		return nil, fmt.Errorf("%w: get iter: %w", errlist.ErrSkippedKeysStorage, err)
+	}
+
+	var messages []MissingMessage
+
+	for headerKey, messageNumberKeys := range iter {
+		for messageNumber := range messageNumberKeys {
+			messages = append(messages, ch.missingMessage(headerKey, messageNumber))
+		}
+	}
+
+	sortMissingMessages(messages)
+
+	return messages, nil
+}
+
+func (ch *Chain) missingMessage(headerKey keys.Header, messageNumber uint64) MissingMessage {
+	epoch, _ := ch.epochOf(headerKey)
+	return MissingMessage{Epoch: epoch, MessageNumber: messageNumber}
+}
+
+func sortMissingMessages(messages []MissingMessage) {
+	slices.SortFunc(messages, func(a, b MissingMessage) int {
+		return cmp.Or(cmp.Compare(a.Epoch, b.Epoch), cmp.Compare(a.MessageNumber, b.MessageNumber))
+	})
+}
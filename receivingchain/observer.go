@@ -0,0 +1,100 @@
+package receivingchain
+
+import "github.com/platform-inf/go-ratchet/keys"
+
+// Observer receives events of the receiving chain. Header keys are identified by their fingerprints.
+//
+// Note that with a journal events are reported only after the journal is committed, so rolled back changes are never
+// reported.
+type Observer interface {
+	// OnKeysSkipped is called when message keys with numbers in [from, to) are skipped and stored.
+	OnKeysSkipped(headerKeyFingerprint string, from, to uint64)
+
+	// OnSkippedKeyUsed is called when a message is decrypted with a skipped message key.
+	OnSkippedKeyUsed(headerKeyFingerprint string, messageNumber uint64)
+
+	// OnSkippedKeysEvicted is called when the storage drops skipped message keys to limit its size.
+	OnSkippedKeysEvicted(count int)
+}
+
+// MissingMessagesObserver is an optional interface of Observer, which receives changes of missing messages, e.g. to
+// request their re-delivery. Note that missing messages are resolved only for observers, which implement it.
+type MissingMessagesObserver interface {
+	// OnMissingMessageFilled is called after OnSkippedKeyUsed with the decrypted missing message.
+	OnMissingMessageFilled(message MissingMessage)
+
+	// OnMissingMessagesExpired is called after OnSkippedKeysEvicted with the messages of evicted keys, so these messages
+	// can not be decrypted anymore. Note that it is called only for the default skipped keys storage.
+	OnMissingMessagesExpired(messages []MissingMessage)
+}
+
+// evictedSkippedKeys are skipped keys evicted by the default storage.
+type evictedSkippedKeys struct {
+	count    int
+	messages []MissingMessage
+}
+
+func (ch *Chain) notifyKeysSkipped(headerKey keys.Header, from, to uint64) {
+	if ch.cfg.observer == nil || from >= to {
+		return
+	}
+
+	observer, headerKeyFingerprint := ch.cfg.observer, headerKey.Fingerprint()
+	ch.cfg.journal.OnCommit(func() { observer.OnKeysSkipped(headerKeyFingerprint, from, to) })
+}
+
+func (ch *Chain) notifySkippedKeyUsed(headerKey keys.Header, messageNumber uint64) {
+	if ch.cfg.observer == nil {
+		return
+	}
+
+	observer, headerKeyFingerprint := ch.cfg.observer, headerKey.Fingerprint()
+
+	missingMessagesObserver, ok := observer.(MissingMessagesObserver)
+	if !ok {
+		ch.cfg.journal.OnCommit(func() { observer.OnSkippedKeyUsed(headerKeyFingerprint, messageNumber) })
+		return
+	}
+
+	message := ch.missingMessage(headerKey, messageNumber)
+
+	ch.cfg.journal.OnCommit(func() {
+		observer.OnSkippedKeyUsed(headerKeyFingerprint, messageNumber)
+		missingMessagesObserver.OnMissingMessageFilled(message)
+	})
+}
+
+// collectEvictedSkippedKeys returns the callback for the default storage, which collects evicted skipped keys, or nil
+// if there is no observer.
+func (ch *Chain) collectEvictedSkippedKeys(evicted *evictedSkippedKeys) func(keys.Header, uint64) {
+	if ch.cfg.observer == nil {
+		return nil
+	}
+
+	_, resolve := ch.cfg.observer.(MissingMessagesObserver)
+
+	return func(headerKey keys.Header, messageNumber uint64) {
+		evicted.count++
+
+		if resolve {
+			evicted.messages = append(evicted.messages, ch.missingMessage(headerKey, messageNumber))
+		}
+	}
+}
+
+func (ch *Chain) notifySkippedKeysEvicted(evicted evictedSkippedKeys) {
+	if ch.cfg.observer == nil || evicted.count == 0 {
+		return
+	}
+
+	observer, messages := ch.cfg.observer, evicted.messages
+	sortMissingMessages(messages)
+
+	ch.cfg.journal.OnCommit(func() {
+		observer.OnSkippedKeysEvicted(evicted.count)
+
+		if missingMessagesObserver, ok := observer.(MissingMessagesObserver); ok {
+			missingMessagesObserver.OnMissingMessagesExpired(messages)
+		}
+	})
+}
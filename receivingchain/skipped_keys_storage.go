@@ -2,7 +2,9 @@ package receivingchain
 
 import (
 	"fmt"
+	"maps"
 
+	"github.com/platform-inf/go-ratchet/journal"
 	"github.com/platform-inf/go-ratchet/keys"
 )
 
@@ -33,29 +35,45 @@ type SkippedKeysStorage interface {
 	GetIter() (SkippedKeysIter, error)
 }
 
-type defaultSkippedKeysStorage map[string]map[uint64]keys.Message
+// TxSkippedKeysStorage is an optional interface of SkippedKeysStorage, which supports transactions, e.g. a database.
+//
+// Chain begins a transaction before decryption and commits or rolls it back together with the ratchet state, so such
+// storage is never cloned. If Commit fails, the ratchet state is rolled back too.
+type TxSkippedKeysStorage interface {
+	SkippedKeysStorage
 
-func newDefaultSkippedKeysStorage() defaultSkippedKeysStorage {
-	return make(defaultSkippedKeysStorage)
+	// Begin must start a transaction, which includes all changes until Commit or Rollback.
+	Begin() error
+
+	// Commit must apply all changes of the transaction.
+	Commit() error
+
+	// Rollback must discard all changes of the transaction.
+	Rollback() error
 }
 
-func (st defaultSkippedKeysStorage) Add(headerKey keys.Header, messageNumber uint64, messageKey keys.Message) error {
-	if len(st) >= defaultSkippedKeysStorageHeaderKeysLenToClear {
-		clear(st)
-	}
+// SkippedKeysStorageWiper is an optional interface of SkippedKeysStorage, which allows to overwrite all stored keys.
+//
+// Please note that Wipe is also called for storages superseded by their clones, so clones must not share key memory.
+type SkippedKeysStorageWiper interface {
+	// Wipe must overwrite all stored keys with zeros.
+	Wipe()
+}
 
-	stKey := st.convertToKey(headerKey)
-	if len(st[stKey]) >= defaultSkippedKeysStorageMessageKeysLenLimit {
-		return fmt.Errorf("too many message keys: %d >= %d", len(st[stKey]), defaultSkippedKeysStorageMessageKeysLenLimit)
+func wipeSkippedKeysStorage(storage SkippedKeysStorage) {
+	if wiper, ok := storage.(SkippedKeysStorageWiper); ok {
+		wiper.Wipe()
 	}
+}
 
-	if _, ok := st[stKey]; !ok {
-		st[stKey] = make(map[uint64]keys.Message)
-	}
+type defaultSkippedKeysStorage map[string]map[uint64]keys.Message
 
-	st[stKey][messageNumber] = messageKey
+func newDefaultSkippedKeysStorage() defaultSkippedKeysStorage {
+	return make(defaultSkippedKeysStorage)
+}
 
-	return nil
+func (st defaultSkippedKeysStorage) Add(headerKey keys.Header, messageNumber uint64, messageKey keys.Message) error {
+	return st.add(nil, headerKey, messageNumber, messageKey, nil)
 }
 
 func (st defaultSkippedKeysStorage) Clone() SkippedKeysStorage {
@@ -75,9 +93,7 @@ func (st defaultSkippedKeysStorage) Clone() SkippedKeysStorage {
 }
 
 func (st defaultSkippedKeysStorage) Delete(headerKey keys.Header, messageNumber uint64) error {
-	stKey := st.convertToKey(headerKey)
-	delete(st[stKey], messageNumber)
-
+	st.delete(nil, headerKey, messageNumber)
 	return nil
 }
 
@@ -103,6 +119,108 @@ func (st defaultSkippedKeysStorage) GetIter() (SkippedKeysIter, error) {
 	return iter, nil
 }
 
+func (st defaultSkippedKeysStorage) Wipe() {
+	for _, messageNumberKeys := range st {
+		for _, messageKey := range messageNumberKeys {
+			messageKey.Wipe()
+		}
+	}
+
+	clear(st)
+}
+
+// add adds skipped key and records the change in journal, so it costs the same regardless of the storage size. If
+// evicted is not nil, it is called for each evicted message key.
+func (st defaultSkippedKeysStorage) add(
+	journal *journal.Journal,
+	headerKey keys.Header,
+	messageNumber uint64,
+	messageKey keys.Message,
+	evicted func(headerKey keys.Header, messageNumber uint64),
+) error {
+	if len(st) >= defaultSkippedKeysStorageHeaderKeysLenToClear {
+		st.clear(journal, evicted)
+	}
+
+	stKey := st.convertToKey(headerKey)
+	if len(st[stKey]) >= defaultSkippedKeysStorageMessageKeysLenLimit {
+		return fmt.Errorf(
+			"too many message keys: %d >= %d", len(st[stKey]), defaultSkippedKeysStorageMessageKeysLenLimit)
+	}
+
+	messageNumberKeys, ok := st[stKey]
+	if !ok {
+		messageNumberKeys = make(map[uint64]keys.Message)
+		st[stKey] = messageNumberKeys
+
+		journal.OnRollback(func() { delete(st, stKey) })
+	}
+
+	oldMessageKey, exists := messageNumberKeys[messageNumber]
+	messageNumberKeys[messageNumber] = messageKey
+
+	if exists {
+		journal.OnCommit(oldMessageKey.Wipe)
+		journal.OnRollback(func() { messageNumberKeys[messageNumber] = oldMessageKey })
+	} else {
+		journal.OnRollback(func() { delete(messageNumberKeys, messageNumber) })
+	}
+
+	journal.OnRollback(messageKey.Wipe)
+
+	return nil
+}
+
+// clear deletes all skipped keys. If evicted is not nil, it is called for each deleted message key with a copy of the
+// header key, which is wiped right after. Note that the storage is copied only when there is a journal to roll back to
+// it.
+func (st defaultSkippedKeysStorage) clear(
+	journal *journal.Journal,
+	evicted func(headerKey keys.Header, messageNumber uint64),
+) {
+	if evicted != nil {
+		for stKey, messageNumberKeys := range st {
+			headerKey := st.convertFromKey(stKey)
+
+			for messageNumber := range messageNumberKeys {
+				evicted(headerKey, messageNumber)
+			}
+
+			headerKey.Wipe()
+		}
+	}
+
+	if journal == nil {
+		st.Wipe()
+		return
+	}
+
+	clearedStorage := maps.Clone(st)
+	clear(st)
+
+	journal.OnCommit(clearedStorage.Wipe)
+	journal.OnRollback(func() { maps.Copy(st, clearedStorage) })
+}
+
+func (st defaultSkippedKeysStorage) delete(journal *journal.Journal, headerKey keys.Header, messageNumber uint64) {
+	messageNumberKeys := st[st.convertToKey(headerKey)]
+
+	messageKey, exists := messageNumberKeys[messageNumber]
+	if !exists {
+		return
+	}
+
+	delete(messageNumberKeys, messageNumber)
+
+	journal.OnCommit(messageKey.Wipe)
+	journal.OnRollback(func() { messageNumberKeys[messageNumber] = messageKey })
+}
+
+func (st defaultSkippedKeysStorage) get(headerKey keys.Header, messageNumber uint64) (keys.Message, bool) {
+	messageKey, exists := st[st.convertToKey(headerKey)][messageNumber]
+	return messageKey, exists
+}
+
 func (st defaultSkippedKeysStorage) convertToKey(headerKey keys.Header) string {
 	return string(headerKey.Bytes)
 }
@@ -1,8 +1,10 @@
 package receivingchain
 
 import (
+	"bytes"
 	"encoding/binary"
 	"fmt"
+	"slices"
 	"testing"
 
 	"github.com/platform-inf/go-ratchet/keys"
@@ -63,6 +65,46 @@ func TestDefaultSkippedKeysStorageAdd(t *testing.T) {
 	})
 }
 
+func TestDefaultSkippedKeysStorageAddEviction(t *testing.T) {
+	t.Parallel()
+
+	storage := newDefaultSkippedKeysStorage()
+
+	var evicted []uint64
+
+	collectEvicted := func(_ keys.Header, messageNumber uint64) { evicted = append(evicted, messageNumber) }
+
+	for i := range defaultSkippedKeysStorageHeaderKeysLenToClear {
+		var bytes [utils.Uint64Size]byte
+		binary.LittleEndian.PutUint64(bytes[:], uint64(i))
+
+		if err := storage.add(nil, keys.Header{Bytes: bytes[:]}, uint64(i), keys.Message{}, collectEvicted); err != nil {
+			t.Fatalf("add(%d): expected no error but got %+v", i, err)
+		}
+	}
+
+	if len(evicted) != 0 {
+		t.Fatalf("add(): expected no evicted keys before clear but got %v", evicted)
+	}
+
+	if err := storage.add(nil, keys.Header{Bytes: []byte{1, 2, 3}}, 0, keys.Message{}, collectEvicted); err != nil {
+		t.Fatalf("add(1, 2, 3): expected no error but got %+v", err)
+	}
+
+	if len(evicted) != defaultSkippedKeysStorageHeaderKeysLenToClear {
+		t.Fatalf(
+			"add(1, 2, 3): expected %d evicted keys but got %d", defaultSkippedKeysStorageHeaderKeysLenToClear, len(evicted))
+	}
+
+	slices.Sort(evicted)
+
+	for i, messageNumber := range evicted {
+		if messageNumber != uint64(i) {
+			t.Fatalf("add(1, 2, 3): expected evicted message number %d but got %d", i, messageNumber)
+		}
+	}
+}
+
 func TestDefaultSkippedKeysStorageDelete(t *testing.T) {
 	t.Parallel()
 
@@ -183,3 +225,36 @@ func TestDefaultSkippedKeysStorageGetIter(t *testing.T) {
 		t.Fatalf("GetIter(): not enough iterations over header key bytes, %d remain: %+v", len(iters), iters)
 	}
 }
+
+func TestDefaultSkippedKeysStorageWipe(t *testing.T) {
+	t.Parallel()
+
+	headerKey := keys.Header{Bytes: []byte{1, 2, 3}}
+	messageKeys := []keys.Message{{Bytes: []byte{4, 5, 6}}, {Bytes: []byte{7, 8, 9}}}
+
+	storage := newDefaultSkippedKeysStorage()
+
+	for messageNumber, messageKey := range messageKeys {
+		if err := storage.Add(headerKey, uint64(messageNumber), messageKey); err != nil {
+			t.Fatalf("Add(): expected no error but got %+v", err)
+		}
+	}
+
+	if err := storage.Delete(headerKey, 0); err != nil {
+		t.Fatalf("Delete(): expected no error but got %+v", err)
+	}
+
+	if !bytes.Equal(messageKeys[0].Bytes, make([]byte, 3)) {
+		t.Fatalf("Delete(): deleted message key is not wiped: %v", messageKeys[0].Bytes)
+	}
+
+	storage.Wipe()
+
+	if len(storage) != 0 {
+		t.Fatalf("Wipe(): expected empty storage but len is %d", len(storage))
+	}
+
+	if !bytes.Equal(messageKeys[1].Bytes, make([]byte, 3)) {
+		t.Fatalf("Wipe(): message key is not wiped: %v", messageKeys[1].Bytes)
+	}
+}
@@ -0,0 +1,346 @@
+// Package storagetest checks that implementations of receivingchain.SkippedKeysStorage follow its contract.
+package storagetest
+
+import (
+	"bytes"
+	"cmp"
+	"slices"
+	"testing"
+	"time"
+
+	ratchet "github.com/platform-inf/go-ratchet"
+	"github.com/platform-inf/go-ratchet/keys"
+	"github.com/platform-inf/go-ratchet/ratchettest"
+	"github.com/platform-inf/go-ratchet/receivingchain"
+)
+
+const deleteDuringIterationTimeout = 5 * time.Second
+
+// Factory must return a new empty storage on each call.
+type Factory func() receivingchain.SkippedKeysStorage
+
+// Run runs the conformance suite against storages created by the factory.
+func Run(t *testing.T, factory Factory) {
+	t.Helper()
+
+	t.Run("add and iterate", func(t *testing.T) { testAddAndIterate(t, factory) })
+	t.Run("delete", func(t *testing.T) { testDelete(t, factory) })
+	t.Run("delete during iteration", func(t *testing.T) { testDeleteDuringIteration(t, factory) })
+	t.Run("stop iteration", func(t *testing.T) { testStopIteration(t, factory) })
+	t.Run("clone", func(t *testing.T) { testClone(t, factory) })
+	t.Run("wipe", func(t *testing.T) { testWipe(t, factory) })
+	t.Run("tx rollback add", func(t *testing.T) { testTxRollbackAdd(t, factory) })
+	t.Run("tx rollback delete", func(t *testing.T) { testTxRollbackDelete(t, factory) })
+	t.Run("tx commit", func(t *testing.T) { testTxCommit(t, factory) })
+	t.Run("ratchet", func(t *testing.T) { testRatchet(t, factory) })
+}
+
+type entry struct {
+	headerKey     string
+	messageNumber uint64
+	messageKey    string
+}
+
+func newHeaderKey(i byte) keys.Header {
+	return keys.Header{Bytes: bytes.Repeat([]byte{i}, 32)}
+}
+
+func newMessageKey(i byte, messageNumber uint64) keys.Message {
+	return keys.Message{Bytes: bytes.Repeat([]byte{i ^ byte(messageNumber) ^ 0x80}, 32)}
+}
+
+func add(t *testing.T, storage receivingchain.SkippedKeysStorage, headerKey byte, messageNumbers ...uint64) {
+	t.Helper()
+
+	for _, messageNumber := range messageNumbers {
+		if err := storage.Add(newHeaderKey(headerKey), messageNumber, newMessageKey(headerKey, messageNumber)); err != nil {
+			t.Fatalf("Add(%d, %d): expected no error but got %v", headerKey, messageNumber, err)
+		}
+	}
+}
+
+// collect returns all entries of the storage sorted by header key and message number.
+func collect(t *testing.T, storage receivingchain.SkippedKeysStorage) []entry {
+	t.Helper()
+
+	iter, err := storage.GetIter()
+	if err != nil {
+		t.Fatalf("GetIter(): expected no error but got %v", err)
+	}
+
+	var entries []entry
+
+	for headerKey, messageNumberKeys := range iter {
+		for messageNumber, messageKey := range messageNumberKeys {
+			entries = append(entries, entry{string(headerKey.Bytes), messageNumber, string(messageKey.Bytes)})
+		}
+	}
+
+	slices.SortFunc(entries, func(a, b entry) int {
+		if a.headerKey != b.headerKey {
+			return bytes.Compare([]byte(a.headerKey), []byte(b.headerKey))
+		}
+
+		return cmp.Compare(a.messageNumber, b.messageNumber)
+	})
+
+	return entries
+}
+
+func expectedEntries(headerKey byte, messageNumbers ...uint64) []entry {
+	entries := make([]entry, 0, len(messageNumbers))
+	for _, messageNumber := range messageNumbers {
+		entries = append(entries, entry{
+			string(newHeaderKey(headerKey).Bytes),
+			messageNumber,
+			string(newMessageKey(headerKey, messageNumber).Bytes),
+		})
+	}
+
+	return entries
+}
+
+func testAddAndIterate(t *testing.T, factory Factory) {
+	storage := factory()
+
+	if entries := collect(t, storage); len(entries) != 0 {
+		t.Fatalf("GetIter(): expected empty new storage but got %d keys", len(entries))
+	}
+
+	add(t, storage, 1, 0, 2)
+	add(t, storage, 2, 5)
+
+	expected := append(expectedEntries(1, 0, 2), expectedEntries(2, 5)...)
+	if entries := collect(t, storage); !slices.Equal(entries, expected) {
+		t.Fatalf("GetIter(): expected %d added keys but got %d different keys", len(expected), len(entries))
+	}
+}
+
+func testDelete(t *testing.T, factory Factory) {
+	storage := factory()
+
+	add(t, storage, 1, 0, 1, 2)
+	add(t, storage, 2, 1)
+
+	if err := storage.Delete(newHeaderKey(1), 1); err != nil {
+		t.Fatalf("Delete(1, 1): expected no error but got %v", err)
+	}
+
+	expected := append(expectedEntries(1, 0, 2), expectedEntries(2, 1)...)
+	if entries := collect(t, storage); !slices.Equal(entries, expected) {
+		t.Fatal("Delete(1, 1): expected to delete only the key with passed header key and message number")
+	}
+}
+
+// testDeleteDuringIteration checks that Delete may be called by yield, like the chain does when it finds the key.
+func testDeleteDuringIteration(t *testing.T, factory Factory) {
+	storage := factory()
+
+	add(t, storage, 1, 0, 1)
+
+	done := make(chan error, 1)
+
+	go func() {
+		iter, err := storage.GetIter()
+		if err != nil {
+			done <- err
+			return
+		}
+
+		for headerKey, messageNumberKeys := range iter {
+			for messageNumber := range messageNumberKeys {
+				done <- storage.Delete(headerKey, messageNumber)
+				return
+			}
+		}
+
+		done <- nil
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Delete(): expected no error during iteration but got %v", err)
+		}
+	case <-time.After(deleteDuringIterationTimeout):
+		t.Fatal("Delete(): deadlock during iteration")
+	}
+
+	if entries := collect(t, storage); len(entries) != 1 {
+		t.Fatalf("Delete(): expected 1 key after delete during iteration but got %d", len(entries))
+	}
+}
+
+func testStopIteration(t *testing.T, factory Factory) {
+	storage := factory()
+
+	add(t, storage, 1, 0, 1, 2)
+	add(t, storage, 2, 0, 1, 2)
+
+	iter, err := storage.GetIter()
+	if err != nil {
+		t.Fatalf("GetIter(): expected no error but got %v", err)
+	}
+
+	headerKeysCount := 0
+
+	iter(func(_ keys.Header, messageNumberKeys receivingchain.SkippedMessageNumberKeysIter) bool {
+		headerKeysCount++
+
+		messageKeysCount := 0
+
+		messageNumberKeys(func(_ uint64, _ keys.Message) bool {
+			messageKeysCount++
+			return false
+		})
+
+		if messageKeysCount != 1 {
+			t.Fatalf("GetIter(): expected message keys iteration to stop but got %d keys", messageKeysCount)
+		}
+
+		return false
+	})
+
+	if headerKeysCount != 1 {
+		t.Fatalf("GetIter(): expected header keys iteration to stop but got %d header keys", headerKeysCount)
+	}
+}
+
+func testClone(t *testing.T, factory Factory) {
+	storage := factory()
+
+	add(t, storage, 1, 0, 1)
+
+	clone := storage.Clone()
+
+	add(t, clone, 2, 0)
+
+	if err := storage.Delete(newHeaderKey(1), 0); err != nil {
+		t.Fatalf("Delete(1, 0): expected no error but got %v", err)
+	}
+
+	if entries := collect(t, storage); !slices.Equal(entries, expectedEntries(1, 1)) {
+		t.Fatal("Clone(): changes of the clone affect the original storage")
+	}
+
+	expected := append(expectedEntries(1, 0, 1), expectedEntries(2, 0)...)
+	if entries := collect(t, clone); !slices.Equal(entries, expected) {
+		t.Fatal("Clone(): changes of the original storage affect the clone")
+	}
+}
+
+// testWipe checks that wiping the original storage does not wipe keys of its clone.
+func testWipe(t *testing.T, factory Factory) {
+	storage := factory()
+
+	wiper, ok := storage.(receivingchain.SkippedKeysStorageWiper)
+	if !ok {
+		t.Skip("storage does not implement SkippedKeysStorageWiper")
+	}
+
+	add(t, storage, 1, 0, 1)
+
+	clone := storage.Clone()
+	wiper.Wipe()
+
+	if entries := collect(t, clone); !slices.Equal(entries, expectedEntries(1, 0, 1)) {
+		t.Fatal("Wipe(): clone shares key memory with the original storage")
+	}
+}
+
+// newTxStorage returns the new storage or skips the test if the storage does not implement TxSkippedKeysStorage.
+func newTxStorage(t *testing.T, factory Factory) receivingchain.TxSkippedKeysStorage {
+	t.Helper()
+
+	storage, ok := factory().(receivingchain.TxSkippedKeysStorage)
+	if !ok {
+		t.Skip("storage does not implement TxSkippedKeysStorage")
+	}
+
+	return storage
+}
+
+func begin(t *testing.T, storage receivingchain.TxSkippedKeysStorage) {
+	t.Helper()
+
+	if err := storage.Begin(); err != nil {
+		t.Fatalf("Begin(): expected no error but got %v", err)
+	}
+}
+
+func rollback(t *testing.T, storage receivingchain.TxSkippedKeysStorage) {
+	t.Helper()
+
+	if err := storage.Rollback(); err != nil {
+		t.Fatalf("Rollback(): expected no error but got %v", err)
+	}
+}
+
+func testTxRollbackAdd(t *testing.T, factory Factory) {
+	storage := newTxStorage(t, factory)
+
+	add(t, storage, 1, 0)
+
+	begin(t, storage)
+	add(t, storage, 1, 1)
+	add(t, storage, 2, 0)
+	rollback(t, storage)
+
+	if entries := collect(t, storage); !slices.Equal(entries, expectedEntries(1, 0)) {
+		t.Fatal("Rollback(): expected to discard keys added in the transaction")
+	}
+}
+
+func testTxRollbackDelete(t *testing.T, factory Factory) {
+	storage := newTxStorage(t, factory)
+
+	add(t, storage, 1, 0, 1)
+
+	begin(t, storage)
+
+	if err := storage.Delete(newHeaderKey(1), 0); err != nil {
+		t.Fatalf("Delete(1, 0): expected no error but got %v", err)
+	}
+
+	rollback(t, storage)
+
+	if entries := collect(t, storage); !slices.Equal(entries, expectedEntries(1, 0, 1)) {
+		t.Fatal("Rollback(): expected to restore keys deleted in the transaction")
+	}
+}
+
+func testTxCommit(t *testing.T, factory Factory) {
+	storage := newTxStorage(t, factory)
+
+	add(t, storage, 1, 0)
+
+	begin(t, storage)
+	add(t, storage, 1, 1)
+
+	if err := storage.Delete(newHeaderKey(1), 0); err != nil {
+		t.Fatalf("Delete(1, 0): expected no error but got %v", err)
+	}
+
+	if err := storage.Commit(); err != nil {
+		t.Fatalf("Commit(): expected no error but got %v", err)
+	}
+
+	if entries := collect(t, storage); !slices.Equal(entries, expectedEntries(1, 1)) {
+		t.Fatal("Commit(): expected to apply changes of the transaction")
+	}
+}
+
+func testRatchet(t *testing.T, factory Factory) {
+	sender, recipient := ratchettest.NewConversationWithOptions(
+		t,
+		[]ratchet.Option{ratchet.WithReceivingChainOptions(receivingchain.WithSkippedKeysStorage(factory()))},
+		[]ratchet.Option{ratchet.WithReceivingChainOptions(receivingchain.WithSkippedKeysStorage(factory()))},
+	)
+
+	cfg := ratchettest.Config{Seed: 1, MessagesCount: 300, MaxDelay: 8, DropRate: 0.05, DuplicateRate: 0.05}
+
+	result := ratchettest.Run(t, cfg, ratchettest.Conversation{sender, recipient})
+	if result.Decrypted == 0 {
+		t.Fatalf("Decrypt(): expected decrypted messages but got %+v", result)
+	}
+}
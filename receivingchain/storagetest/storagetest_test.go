@@ -0,0 +1,108 @@
+package storagetest
+
+import (
+	"testing"
+
+	"github.com/platform-inf/go-ratchet/keys"
+	"github.com/platform-inf/go-ratchet/receivingchain"
+)
+
+type testStorage map[string]map[uint64]keys.Message
+
+func (st testStorage) Add(headerKey keys.Header, messageNumber uint64, messageKey keys.Message) error {
+	if _, ok := st[string(headerKey.Bytes)]; !ok {
+		st[string(headerKey.Bytes)] = make(map[uint64]keys.Message)
+	}
+
+	st[string(headerKey.Bytes)][messageNumber] = messageKey.Clone()
+
+	return nil
+}
+
+func (st testStorage) Clone() receivingchain.SkippedKeysStorage {
+	clone := make(testStorage, len(st))
+
+	for headerKey, messageNumberKeys := range st {
+		clone[headerKey] = make(map[uint64]keys.Message, len(messageNumberKeys))
+
+		for messageNumber, messageKey := range messageNumberKeys {
+			clone[headerKey][messageNumber] = messageKey.Clone()
+		}
+	}
+
+	return clone
+}
+
+func (st testStorage) Delete(headerKey keys.Header, messageNumber uint64) error {
+	delete(st[string(headerKey.Bytes)], messageNumber)
+	return nil
+}
+
+func (st testStorage) GetIter() (receivingchain.SkippedKeysIter, error) {
+	iter := func(yield receivingchain.SkippedKeysYield) {
+		for headerKey, messageNumberKeys := range st {
+			messageNumberKeysIter := func(yield receivingchain.SkippedMessageNumberKeysYield) {
+				for messageNumber, messageKey := range messageNumberKeys {
+					if !yield(messageNumber, messageKey) {
+						return
+					}
+				}
+			}
+
+			if !yield(keys.Header{Bytes: []byte(headerKey)}, messageNumberKeysIter) {
+				return
+			}
+		}
+	}
+
+	return iter, nil
+}
+
+func (st testStorage) Wipe() {
+	for _, messageNumberKeys := range st {
+		for _, messageKey := range messageNumberKeys {
+			messageKey.Wipe()
+		}
+	}
+
+	clear(st)
+}
+
+// testTxStorage keeps the snapshot of the storage taken by Begin.
+type testTxStorage struct {
+	testStorage
+
+	snapshot testStorage
+}
+
+func (st *testTxStorage) Begin() error {
+	st.snapshot, _ = st.testStorage.Clone().(testStorage)
+	return nil
+}
+
+func (st *testTxStorage) Clone() receivingchain.SkippedKeysStorage {
+	clone, _ := st.testStorage.Clone().(testStorage)
+	return &testTxStorage{testStorage: clone}
+}
+
+func (st *testTxStorage) Commit() error {
+	st.snapshot = nil
+	return nil
+}
+
+func (st *testTxStorage) Rollback() error {
+	st.testStorage, st.snapshot = st.snapshot, nil
+	return nil
+}
+
+func TestRun(t *testing.T) {
+	t.Parallel()
+
+	Run(t, func() receivingchain.SkippedKeysStorage { return make(testStorage) })
+}
+
+func TestRunTx(t *testing.T) {
+	t.Parallel()
+
+	Run(t, func() receivingchain.SkippedKeysStorage { return &testTxStorage{testStorage: make(testStorage)} })
+}
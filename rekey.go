@@ -0,0 +1,93 @@
+package ratchet
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/platform-inf/go-ratchet/errlist"
+	"github.com/platform-inf/go-ratchet/header"
+	"github.com/platform-inf/go-ratchet/keys"
+	"github.com/platform-inf/go-ratchet/receivingchain"
+)
+
+// Rekey generates the next local key pair, whose public key is attached to the next messages of the current sending
+// chain, so the next Diffie-Hellman ratchet step of the remote participant is based on it instead of the current key.
+//
+// Note that Rekey is not a Diffie-Hellman ratchet step: the root chain is not advanced, because the remote participant
+// may be performing its own step with the current public key at the same time. So the conversation recovers from a
+// compromise of the local private key only once the remote participant replies, and a participant, who only sends,
+// stays in the same epoch. Both private keys are kept until the next receiving step, which uses the one chosen by the
+// remote participant. Rekey does nothing if the next key pair is already generated or the next Encrypt performs a
+// sending step anyway.
+func (r *Ratchet) Rekey() error {
+	if r.remotePublicKey == nil {
+		return fmt.Errorf("%w: remote public key is nil, receive a message before rekey", errlist.ErrInvalidValue)
+	}
+
+	return r.updateWithTx(func(r *Ratchet) error {
+		return r.rekey()
+	})
+}
+
+// applyRekeyPolicies generates the next local key pair if the sending chain is exhausted by the policies set by
+// WithRekeyEveryMessages and WithRekeyInterval.
+func (r *Ratchet) applyRekeyPolicies() error {
+	if r.remotePublicKey == nil {
+		return nil
+	}
+
+	exhaustedByMessages := r.cfg.rekeyMessagesCount > 0 && r.sendingChain.NextMessageNumber() >= r.cfg.rekeyMessagesCount
+	exhaustedByInterval := r.cfg.rekeyInterval > 0 && r.cfg.now().Sub(r.sendingChainRatchetedAt) >= r.cfg.rekeyInterval
+
+	if !exhaustedByMessages && !exhaustedByInterval {
+		return nil
+	}
+
+	return r.rekey()
+}
+
+// followRemoteRekey makes the next sending step use the next public key of the remote participant, which is attached
+// to the message by Rekey. Note that the key is taken only from messages of the current receiving chain and only before
+// the step, because the remote participant expects the step with one of its keys only until it receives the step.
+func (r *Ratchet) followRemoteRekey(info receivingchain.DecryptInfo) error {
+	nextRemotePublicKeyBytes, ok := info.Header.Extension(header.ExtensionTypeNextPublicKey)
+	if !ok || !r.needSendingChainRatchet || info.Epoch != r.receivingChain.Epoch() {
+		return nil
+	}
+
+	nextRemotePublicKey := keys.Public{Bytes: slices.Clone(nextRemotePublicKeyBytes)}
+
+	if err := validatePublicKey(r.cfg.crypto, nextRemotePublicKey); err != nil {
+		decryptedHeader := info.Header.Clone()
+
+		return &receivingchain.DecryptError{
+			Reason: receivingchain.DecryptReasonInvalidPublicKey,
+			Header: &decryptedHeader,
+			Err:    fmt.Errorf("next remote public key: %w", err),
+		}
+	}
+
+	r.remotePublicKey = &nextRemotePublicKey
+
+	return nil
+}
+
+func (r *Ratchet) rekey() error {
+	if r.needSendingChainRatchet || r.nextLocalPrivateKey != nil {
+		return nil
+	}
+
+	nextLocalPrivateKey, nextLocalPublicKey, err := r.cfg.crypto.GenerateKeyPair()
+	if err != nil {
+		return fmt.Errorf("%w: generate next key pair: %w", errlist.ErrCrypto, err)
+	}
+
+	allocator := r.cfg.keysAllocator
+	nextLocalPrivateKey = nextLocalPrivateKey.MoveTo(allocator)
+
+	r.cfg.journal.OnRollback(func() { nextLocalPrivateKey.Free(allocator) })
+
+	r.nextLocalPrivateKey, r.nextLocalPublicKey = &nextLocalPrivateKey, &nextLocalPublicKey
+
+	return nil
+}
@@ -0,0 +1,64 @@
+package reset
+
+import (
+	"bytes"
+	"fmt"
+
+	ratchet "github.com/platform-inf/go-ratchet"
+)
+
+// SendFunc sends the message encrypted with the new ratchet to the remote participant.
+type SendFunc func(encryptedHeader, encryptedData []byte) error
+
+// Queue keeps plaintexts of messages, which must be encrypted again with the new ratchet, e.g. messages sent through
+// the old ratchet without acknowledgement. Note that plaintexts are kept in memory until they are sent.
+//
+// Please note that the structure is not safe for concurrent programs.
+type Queue struct {
+	messages []queuedMessage
+}
+
+type queuedMessage struct {
+	data []byte
+	auth []byte
+}
+
+// Flush encrypts queued messages with the ratchet and sends them in order. Sent messages are removed from the queue.
+// Nil queue has nothing to send.
+func (q *Queue) Flush(r *ratchet.Ratchet, send SendFunc) error {
+	if q == nil {
+		return nil
+	}
+
+	for len(q.messages) > 0 {
+		message := q.messages[0]
+
+		encryptedHeader, encryptedData, err := r.Encrypt(message.data, message.auth)
+		if err != nil {
+			return fmt.Errorf("encrypt: %w", err)
+		}
+
+		if err := send(encryptedHeader, encryptedData); err != nil {
+			return fmt.Errorf("send: %w", err)
+		}
+
+		clear(message.data)
+		q.messages = q.messages[1:]
+	}
+
+	return nil
+}
+
+// Len returns the number of queued messages.
+func (q *Queue) Len() int {
+	if q == nil {
+		return 0
+	}
+
+	return len(q.messages)
+}
+
+// Push adds a copy of the message to the queue.
+func (q *Queue) Push(data, auth []byte) {
+	q.messages = append(q.messages, queuedMessage{data: bytes.Clone(data), auth: bytes.Clone(auth)})
+}
@@ -0,0 +1,64 @@
+package reset
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/platform-inf/go-ratchet/errlist"
+)
+
+func TestQueueFlushSendError(t *testing.T) {
+	t.Parallel()
+
+	alice, bob := newTestIdentity(t), newTestIdentity(t)
+
+	_, message, err := Initiate(alice, bob.PublicKey, nil, nil)
+	if err != nil {
+		t.Fatalf("Initiate(): expected no error but got %v", err)
+	}
+
+	var sent []testMessage
+
+	r, err := NewResponder(bob, alice.PublicKey).Accept(message, nil, newTestSend(&sent))
+	if err != nil {
+		t.Fatalf("Accept(): expected no error but got %v", err)
+	}
+
+	var queue Queue
+	queue.Push([]byte{1}, nil)
+	queue.Push([]byte{2}, nil)
+
+	errSend := errors.New("send")
+	sendOnce := func(encryptedHeader, encryptedData []byte) error {
+		if len(sent) == 2 {
+			return errSend
+		}
+
+		return newTestSend(&sent)(encryptedHeader, encryptedData)
+	}
+
+	if err := queue.Flush(&r, sendOnce); !errors.Is(err, errSend) {
+		t.Fatalf("Flush(): expected error %v but got %v", errSend, err)
+	}
+
+	if queue.Len() != 1 {
+		t.Fatalf("Flush(): expected 1 kept message but got %d", queue.Len())
+	}
+
+	if err := queue.Flush(&r, newTestSend(&sent)); err != nil {
+		t.Fatalf("Flush(): expected no error but got %v", err)
+	}
+
+	if queue.Len() != 0 || len(sent) != 3 {
+		t.Fatalf("Flush(): expected empty queue and 3 sent messages but got %d and %d", queue.Len(), len(sent))
+	}
+
+	var nilQueue *Queue
+	if err := nilQueue.Flush(&r, nil); err != nil {
+		t.Fatalf("Flush(): expected no error for nil queue but got %v", err)
+	}
+
+	if _, _, err := Initiate(alice, bob.PublicKey, &queue, nil); !errors.Is(err, errlist.ErrInvalidValue) {
+		t.Fatalf("Initiate(): expected error %v but got %v", errlist.ErrInvalidValue, err)
+	}
+}
@@ -0,0 +1,461 @@
+// Package reset recovers a conversation, whose ratchet states diverged, e.g. after one participant restored a backup
+// and every decryption fails.
+//
+// The initiator sends a reset message with a fresh ephemeral public key and the current time. Both participants derive
+// a new root key and header keys from Diffie-Hellman of their identity keys and of the ephemeral key, so only the
+// owners of the identity keys can create and accept the message. Then both participants archive their old ratchets and
+// continue with the new ones. The responder rejects replayed and expired reset messages, see Responder.
+//
+// The ephemeral key is also the initial ratchet key of the initiator, so the responder encrypts right after Accept,
+// while the initiator waits for the first message of the responder. Therefore, Accept sends an empty message, which
+// completes the handshake. Messages, which were not delivered through the old ratchets, are kept in a Queue and sent
+// with the new ratchets automatically: by the responder right after the empty message and by the initiator right after
+// the first message of the responder is decrypted.
+//
+// If both participants initiate the reset at the same time, the reset of the participant with the smaller identity
+// public key wins: its responder rejects the remote reset message with ErrSimultaneousReset, while the other
+// participant accepts it and abandons its own reset. Use Responder.Initiate, so the responder knows about the local
+// reset.
+package reset
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"time"
+
+	"golang.org/x/crypto/blake2b"
+	"golang.org/x/crypto/hkdf"
+
+	ratchet "github.com/platform-inf/go-ratchet"
+	"github.com/platform-inf/go-ratchet/errlist"
+	"github.com/platform-inf/go-ratchet/keys"
+)
+
+// Version is the version of the reset message format.
+const Version = 1
+
+// MessageLen is the length of the reset message.
+const MessageLen = len(messagePrefix) + 1 + timestampLen + keyLen + tagLen
+
+// MaxMessageAge is the maximum difference between the time of the reset message and the time of its acceptance.
+const MaxMessageAge = 10 * time.Minute
+
+const (
+	messagePrefix = "RESET"
+	timestampLen  = 8
+	keyLen        = 32
+	tagLen        = 32
+	kdfOutputLen  = 4 * keyLen
+)
+
+var kdfInfo = []byte("reset conversation")
+
+// ErrSimultaneousReset means that both participants initiated the reset at the same time and the local reset wins, so
+// the reset message of the remote participant must be dropped.
+var ErrSimultaneousReset = errors.New("simultaneous reset is won by the local participant")
+
+// Identity is the identity key pair of the participant. Note that the identity private key is not passed to ratchets,
+// so it is never wiped.
+type Identity struct {
+	PrivateKey keys.Private
+	PublicKey  keys.Public
+}
+
+// Initiator is the new ratchet of the initiator, which waits for the first message of the responder to complete the
+// handshake.
+type Initiator struct {
+	ratchet   ratchet.Ratchet
+	queue     *Queue
+	send      SendFunc
+	completed bool
+	abandoned bool
+}
+
+// Initiate creates the new ratchet of the initiator and the reset message, which must be sent to the remote
+// participant. Queued messages are sent with send right after the first message of the remote participant is
+// decrypted. Nil queue means that there are no messages to send again.
+//
+// Note that the reset uses X25519, so ratchets must use the default crypto.
+func Initiate(
+	localIdentity Identity,
+	remoteIdentityKey keys.Public,
+	queue *Queue,
+	send SendFunc,
+	options ...ratchet.Option,
+) (*Initiator, []byte, error) {
+	if queue != nil && send == nil {
+		return nil, nil, fmt.Errorf("%w: send is nil", errlist.ErrInvalidValue)
+	}
+
+	foreignEphemeralPrivateKey, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: generate ephemeral key: %w", errlist.ErrCrypto, err)
+	}
+
+	ephemeralPrivateKey := keys.Private{Bytes: foreignEphemeralPrivateKey.Bytes()}
+	ephemeralKey := keys.Public{Bytes: foreignEphemeralPrivateKey.PublicKey().Bytes()}
+
+	derived, err := deriveKeys(
+		localIdentity.PrivateKey,
+		remoteIdentityKey,
+		ephemeralPrivateKey,
+		remoteIdentityKey,
+		transcript{localIdentity.PublicKey, remoteIdentityKey, ephemeralKey},
+	)
+	if err != nil {
+		ephemeralPrivateKey.Wipe()
+		return nil, nil, err
+	}
+
+	message := append(append([]byte(messagePrefix), Version), make([]byte, timestampLen)...)
+	binary.LittleEndian.PutUint64(message[len(messagePrefix)+1:], uint64(time.Now().Unix()))
+	message = append(message, ephemeralKey.Bytes...)
+	message = append(message, derived.tag(message)...)
+
+	r, err := ratchet.NewRecipient(
+		ephemeralPrivateKey,
+		ephemeralKey.Clone(),
+		derived.rootKey,
+		derived.initiatorHeaderKey,
+		derived.responderHeaderKey,
+		options...,
+	)
+	if err != nil {
+		ephemeralPrivateKey.Wipe()
+		derived.wipe()
+
+		return nil, nil, fmt.Errorf("new recipient: %w", err)
+	}
+
+	clear(derived.tagKey)
+
+	return &Initiator{ratchet: r, queue: queue, send: send}, message, nil
+}
+
+// Completed reports whether the handshake is completed, i.e. the first message of the responder is decrypted.
+func (in *Initiator) Completed() bool {
+	return in.completed
+}
+
+// Decrypt decrypts the message of the responder with the new ratchet. The first decrypted message completes the
+// handshake, so queued messages are sent. Note that if sending fails, the decrypted data is returned with the error
+// and the rest of the queue is kept, so send it later with Queue.Flush.
+func (in *Initiator) Decrypt(encryptedHeader, encryptedData, auth []byte) ([]byte, error) {
+	if in.abandoned {
+		return nil, fmt.Errorf("%w: reset is abandoned for the reset of the remote participant", errlist.ErrInvalidValue)
+	}
+
+	data, err := in.ratchet.Decrypt(encryptedHeader, encryptedData, auth)
+	if err != nil {
+		return nil, err
+	}
+
+	if in.completed {
+		return data, nil
+	}
+
+	in.completed = true
+
+	if err := in.queue.Flush(&in.ratchet, in.send); err != nil {
+		return data, fmt.Errorf("flush queue: %w", err)
+	}
+
+	return data, nil
+}
+
+// Ratchet returns the new ratchet, which may be used directly after the handshake is completed.
+func (in *Initiator) Ratchet() *ratchet.Ratchet {
+	return &in.ratchet
+}
+
+// abandon destroys the new ratchet, because the reset of the remote participant wins.
+func (in *Initiator) abandon() {
+	in.ratchet.Destroy()
+	in.abandoned = true
+}
+
+// Responder accepts reset messages of the remote participant. It rejects messages, whose time differs from the current
+// time by more than MaxMessageAge, and messages, which are already accepted, so a replayed message can not reset the
+// conversation again.
+//
+// Note that accepted messages are remembered in memory only for MaxMessageAge, so use one responder per remote
+// participant for the lifetime of the process. After a restart a message, which is younger than MaxMessageAge, is
+// accepted again and resets the conversation once more, so do not accept reset messages for MaxMessageAge after a
+// restart if a replay matters. Please note that the structure is not safe for concurrent programs.
+type Responder struct {
+	localIdentity     Identity
+	remoteIdentityKey keys.Public
+	accepted          map[string]time.Time
+	initiator         *Initiator
+	now               func() time.Time
+}
+
+// NewResponder creates the responder, which accepts reset messages of the remote participant.
+func NewResponder(localIdentity Identity, remoteIdentityKey keys.Public) *Responder {
+	return &Responder{
+		localIdentity:     localIdentity,
+		remoteIdentityKey: remoteIdentityKey,
+		accepted:          make(map[string]time.Time),
+		now:               time.Now,
+	}
+}
+
+// Accept checks the reset message of the remote participant, creates the new ratchet of the responder and completes
+// the handshake: an empty message and then queued messages are encrypted with the new ratchet and passed to send. Nil
+// queue means that there are no messages to send again.
+//
+// If the local reset started with Responder.Initiate is not completed yet, the reset with the smaller identity public
+// key wins. So either ErrSimultaneousReset is returned, or the local reset is abandoned and its queue must be passed
+// here.
+//
+// Note that if sending of queued messages fails, the ratchet is returned with the error and the rest of the queue is
+// kept, so send it later with Queue.Flush.
+func (rs *Responder) Accept(
+	message []byte,
+	queue *Queue,
+	send SendFunc,
+	options ...ratchet.Option,
+) (ratchet.Ratchet, error) {
+	if send == nil {
+		return ratchet.Ratchet{}, fmt.Errorf("%w: send is nil", errlist.ErrInvalidValue)
+	}
+
+	ephemeralKey, err := EphemeralKey(message)
+	if err != nil {
+		return ratchet.Ratchet{}, err
+	}
+
+	now := rs.now()
+	rs.forgetExpired(now)
+
+	messageTime := time.Unix(int64(binary.LittleEndian.Uint64(message[len(messagePrefix)+1:])), 0)
+	if messageTime.Before(now.Add(-MaxMessageAge)) || messageTime.After(now.Add(MaxMessageAge)) {
+		return ratchet.Ratchet{}, fmt.Errorf("%w: reset message time %s is expired", errlist.ErrInvalidValue, messageTime)
+	}
+
+	if _, ok := rs.accepted[ephemeralKey.Fingerprint()]; ok {
+		return ratchet.Ratchet{}, fmt.Errorf("%w: reset message is already accepted", errlist.ErrDuplicateMessage)
+	}
+
+	derived, err := deriveKeys(
+		rs.localIdentity.PrivateKey,
+		rs.remoteIdentityKey,
+		rs.localIdentity.PrivateKey,
+		ephemeralKey,
+		transcript{rs.remoteIdentityKey, rs.localIdentity.PublicKey, ephemeralKey},
+	)
+	if err != nil {
+		return ratchet.Ratchet{}, err
+	}
+
+	tagStart := len(message) - tagLen
+	if subtle.ConstantTimeCompare(derived.tag(message[:tagStart]), message[tagStart:]) != 1 {
+		derived.wipe()
+		return ratchet.Ratchet{}, fmt.Errorf("%w: reset message is not authenticated", errlist.ErrCrypto)
+	}
+
+	clear(derived.tagKey)
+
+	if rs.initiator != nil && !rs.initiator.Completed() &&
+		bytes.Compare(rs.localIdentity.PublicKey.Bytes, rs.remoteIdentityKey.Bytes) < 0 {
+		derived.wipe()
+
+		// Note that the message is remembered, so it can not reset the conversation after the local reset completes.
+		rs.accepted[ephemeralKey.Fingerprint()] = messageTime
+
+		return ratchet.Ratchet{}, ErrSimultaneousReset
+	}
+
+	r, err := ratchet.NewSender(
+		ephemeralKey, derived.rootKey, derived.responderHeaderKey, derived.initiatorHeaderKey, options...)
+	if err != nil {
+		derived.wipe()
+		return ratchet.Ratchet{}, fmt.Errorf("new sender: %w", err)
+	}
+
+	encryptedHeader, encryptedData, err := r.Encrypt(nil, nil)
+	if err != nil {
+		r.Destroy()
+		return ratchet.Ratchet{}, fmt.Errorf("encrypt handshake message: %w", err)
+	}
+
+	// Note that the message is remembered only after the handshake message is sent, so a failed acceptance may be
+	// retried with the same message.
+	if err := send(encryptedHeader, encryptedData); err != nil {
+		r.Destroy()
+		return ratchet.Ratchet{}, fmt.Errorf("send handshake message: %w", err)
+	}
+
+	rs.accepted[ephemeralKey.Fingerprint()] = messageTime
+
+	if rs.initiator != nil && !rs.initiator.Completed() {
+		rs.initiator.abandon()
+	}
+
+	rs.initiator = nil
+
+	if err := queue.Flush(&r, send); err != nil {
+		return r, fmt.Errorf("flush queue: %w", err)
+	}
+
+	return r, nil
+}
+
+// Initiate starts the local reset like the Initiate function and remembers it, so Accept resolves simultaneous resets.
+func (rs *Responder) Initiate(queue *Queue, send SendFunc, options ...ratchet.Option) (*Initiator, []byte, error) {
+	initiator, message, err := Initiate(rs.localIdentity, rs.remoteIdentityKey, queue, send, options...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rs.initiator = initiator
+
+	return initiator, message, nil
+}
+
+// forgetExpired forgets accepted messages, which would be rejected as expired anyway.
+func (rs *Responder) forgetExpired(now time.Time) {
+	for fingerprint, messageTime := range rs.accepted {
+		if messageTime.Before(now.Add(-MaxMessageAge)) {
+			delete(rs.accepted, fingerprint)
+		}
+	}
+}
+
+// EphemeralKey returns the ephemeral public key of the reset message. Note that the message is not authenticated.
+func EphemeralKey(message []byte) (keys.Public, error) {
+	if !IsMessage(message) {
+		return keys.Public{}, fmt.Errorf("%w: not a reset message", errlist.ErrInvalidValue)
+	}
+
+	if version := message[len(messagePrefix)]; version != Version {
+		return keys.Public{}, fmt.Errorf("%w: unsupported reset message version %d", errlist.ErrInvalidValue, version)
+	}
+
+	start := len(messagePrefix) + 1 + timestampLen
+
+	return keys.Public{Bytes: bytes.Clone(message[start : start+keyLen])}, nil
+}
+
+// IsMessage reports whether data looks like a reset message, which allows to tell it from ratchet messages.
+func IsMessage(data []byte) bool {
+	return len(data) == MessageLen && bytes.HasPrefix(data, []byte(messagePrefix))
+}
+
+// transcript contains public keys of the reset in the same order for both participants.
+type transcript struct {
+	initiatorIdentityKey keys.Public
+	responderIdentityKey keys.Public
+	ephemeralKey         keys.Public
+}
+
+type derivedKeys struct {
+	rootKey            keys.Root
+	initiatorHeaderKey keys.Header
+	responderHeaderKey keys.Header
+	tagKey             []byte
+}
+
+// deriveKeys derives keys from Diffie-Hellman of identity keys and Diffie-Hellman of the ephemeral key with the
+// responder identity key. The initiator passes its ephemeral private key, the responder passes its identity private
+// key and the ephemeral public key.
+func deriveKeys(
+	identityPrivateKey keys.Private,
+	remoteIdentityKey keys.Public,
+	ephemeralPrivateKey keys.Private,
+	ephemeralPublicKey keys.Public,
+	transcript transcript,
+) (derivedKeys, error) {
+	identitySharedKey, err := computeSharedKey(identityPrivateKey, remoteIdentityKey)
+	if err != nil {
+		return derivedKeys{}, fmt.Errorf("%w: compute identity shared key: %w", errlist.ErrCrypto, err)
+	}
+
+	defer identitySharedKey.Wipe()
+
+	ephemeralSharedKey, err := computeSharedKey(ephemeralPrivateKey, ephemeralPublicKey)
+	if err != nil {
+		return derivedKeys{}, fmt.Errorf("%w: compute ephemeral shared key: %w", errlist.ErrCrypto, err)
+	}
+
+	defer ephemeralSharedKey.Wipe()
+
+	secret := append(bytes.Clone(identitySharedKey.Bytes), ephemeralSharedKey.Bytes...)
+	defer clear(secret)
+
+	info := append(bytes.Clone(kdfInfo), Version)
+	info = append(info, transcript.initiatorIdentityKey.Bytes...)
+	info = append(info, transcript.responderIdentityKey.Bytes...)
+	info = append(info, transcript.ephemeralKey.Bytes...)
+
+	var newHashErr error
+
+	getHasher := func() hash.Hash {
+		var hasher hash.Hash
+		hasher, newHashErr = blake2b.New512(nil)
+
+		return hasher
+	}
+
+	output := make([]byte, kdfOutputLen)
+	if _, err := io.ReadFull(hkdf.New(getHasher, secret, nil, info), output); err != nil {
+		return derivedKeys{}, fmt.Errorf("%w: KDF: %w", errlist.ErrCrypto, err)
+	}
+
+	if newHashErr != nil {
+		return derivedKeys{}, fmt.Errorf("%w: new hash: %w", errlist.ErrCrypto, newHashErr)
+	}
+
+	derived := derivedKeys{
+		rootKey:            keys.Root{Bytes: output[:keyLen]},
+		initiatorHeaderKey: keys.Header{Bytes: output[keyLen : 2*keyLen]},
+		responderHeaderKey: keys.Header{Bytes: output[2*keyLen : 3*keyLen]},
+		tagKey:             output[3*keyLen:],
+	}
+
+	return derived, nil
+}
+
+func (dk derivedKeys) tag(data []byte) []byte {
+	hasher, err := blake2b.New256(dk.tagKey)
+	if err != nil {
+		panic(err) // Note that the key length is constant and valid.
+	}
+
+	_, _ = hasher.Write(data)
+
+	return hasher.Sum(nil)
+}
+
+func (dk derivedKeys) wipe() {
+	dk.rootKey.Wipe()
+	dk.initiatorHeaderKey.Wipe()
+	dk.responderHeaderKey.Wipe()
+	clear(dk.tagKey)
+}
+
+func computeSharedKey(privateKey keys.Private, publicKey keys.Public) (keys.Shared, error) {
+	foreignPrivateKey, err := ecdh.X25519().NewPrivateKey(privateKey.Bytes)
+	if err != nil {
+		return keys.Shared{}, fmt.Errorf("map to foreign private key: %w", err)
+	}
+
+	foreignPublicKey, err := ecdh.X25519().NewPublicKey(publicKey.Bytes)
+	if err != nil {
+		return keys.Shared{}, fmt.Errorf("map to foreign public key: %w", err)
+	}
+
+	sharedKeyBytes, err := foreignPrivateKey.ECDH(foreignPublicKey)
+	if err != nil {
+		return keys.Shared{}, fmt.Errorf("Diffie-Hellman: %w", err)
+	}
+
+	return keys.Shared{Bytes: sharedKeyBytes}, nil
+}
@@ -0,0 +1,311 @@
+package reset
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/rand"
+	"errors"
+	"testing"
+	"time"
+
+	ratchet "github.com/platform-inf/go-ratchet"
+	"github.com/platform-inf/go-ratchet/errlist"
+	"github.com/platform-inf/go-ratchet/keys"
+)
+
+func newTestIdentity(t *testing.T) Identity {
+	t.Helper()
+
+	privateKey, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey(): expected no error but got %v", err)
+	}
+
+	return Identity{
+		PrivateKey: keys.Private{Bytes: privateKey.Bytes()},
+		PublicKey:  keys.Public{Bytes: privateKey.PublicKey().Bytes()},
+	}
+}
+
+type testMessage struct {
+	encryptedHeader []byte
+	encryptedData   []byte
+}
+
+func newTestSend(messages *[]testMessage) SendFunc {
+	return func(encryptedHeader, encryptedData []byte) error {
+		*messages = append(*messages, testMessage{encryptedHeader, encryptedData})
+		return nil
+	}
+}
+
+func TestReset(t *testing.T) {
+	t.Parallel()
+
+	alice, bob := newTestIdentity(t), newTestIdentity(t)
+
+	var aliceSent, bobSent []testMessage
+
+	var aliceQueue, bobQueue Queue
+	aliceQueue.Push([]byte{1}, []byte{10})
+	aliceQueue.Push([]byte{2}, nil)
+	bobQueue.Push([]byte{3}, nil)
+
+	initiator, message, err := Initiate(alice, bob.PublicKey, &aliceQueue, newTestSend(&aliceSent))
+	if err != nil {
+		t.Fatalf("Initiate(): expected no error but got %v", err)
+	}
+
+	if !IsMessage(message) {
+		t.Fatalf("IsMessage(%v): expected true but got false", message)
+	}
+
+	bobRatchet, err := NewResponder(bob, alice.PublicKey).Accept(message, &bobQueue, newTestSend(&bobSent))
+	if err != nil {
+		t.Fatalf("Accept(): expected no error but got %v", err)
+	}
+
+	if len(bobSent) != 2 || bobQueue.Len() != 0 {
+		t.Fatalf("Accept(): expected 2 sent messages and empty queue but got %d and %d", len(bobSent), bobQueue.Len())
+	}
+
+	if len(aliceSent) != 0 || initiator.Completed() {
+		t.Fatalf("Initiate(): expected no sent messages before the handshake but got %d", len(aliceSent))
+	}
+
+	for i, expectedData := range [][]byte{nil, {3}} {
+		data, err := initiator.Decrypt(bobSent[i].encryptedHeader, bobSent[i].encryptedData, nil)
+		if err != nil {
+			t.Fatalf("Decrypt(): expected no error but got %v", err)
+		}
+
+		if !bytes.Equal(data, expectedData) {
+			t.Fatalf("Decrypt(): expected %v but got %v", expectedData, data)
+		}
+	}
+
+	if len(aliceSent) != 2 || aliceQueue.Len() != 0 || !initiator.Completed() {
+		t.Fatalf(
+			"Decrypt(): expected completed handshake, 2 sent messages and empty queue but got %t, %d and %d",
+			initiator.Completed(),
+			len(aliceSent),
+			aliceQueue.Len(),
+		)
+	}
+
+	for i, expected := range []struct{ data, auth []byte }{{[]byte{1}, []byte{10}}, {[]byte{2}, nil}} {
+		data, err := bobRatchet.Decrypt(aliceSent[i].encryptedHeader, aliceSent[i].encryptedData, expected.auth)
+		if err != nil {
+			t.Fatalf("Decrypt(): expected no error but got %v", err)
+		}
+
+		if !bytes.Equal(data, expected.data) {
+			t.Fatalf("Decrypt(): expected %v but got %v", expected.data, data)
+		}
+	}
+
+	exchange := func(sender, recipient *ratchet.Ratchet, data []byte) {
+		t.Helper()
+
+		encryptedHeader, encryptedData, err := sender.Encrypt(data, nil)
+		if err != nil {
+			t.Fatalf("Encrypt(): expected no error but got %v", err)
+		}
+
+		decryptedData, err := recipient.Decrypt(encryptedHeader, encryptedData, nil)
+		if err != nil {
+			t.Fatalf("Decrypt(): expected no error but got %v", err)
+		}
+
+		if !bytes.Equal(decryptedData, data) {
+			t.Fatalf("Decrypt(): expected %v but got %v", data, decryptedData)
+		}
+	}
+
+	exchange(initiator.Ratchet(), &bobRatchet, []byte{4, 5, 6})
+	exchange(&bobRatchet, initiator.Ratchet(), []byte{7, 8, 9})
+}
+
+func TestResponderAcceptReplay(t *testing.T) {
+	t.Parallel()
+
+	alice, bob := newTestIdentity(t), newTestIdentity(t)
+
+	_, message, err := Initiate(alice, bob.PublicKey, nil, nil)
+	if err != nil {
+		t.Fatalf("Initiate(): expected no error but got %v", err)
+	}
+
+	var sent []testMessage
+
+	responder := NewResponder(bob, alice.PublicKey)
+
+	if _, err := responder.Accept(message, nil, newTestSend(&sent)); err != nil {
+		t.Fatalf("Accept(): expected no error but got %v", err)
+	}
+
+	if _, err := responder.Accept(message, nil, newTestSend(&sent)); !errors.Is(err, errlist.ErrDuplicateMessage) {
+		t.Fatalf("Accept(): expected error %v but got %v", errlist.ErrDuplicateMessage, err)
+	}
+
+	responder.now = func() time.Time { return time.Now().Add(MaxMessageAge + time.Minute) }
+
+	if _, err := responder.Accept(message, nil, newTestSend(&sent)); !errors.Is(err, errlist.ErrInvalidValue) {
+		t.Fatalf("Accept(): expected error %v but got %v", errlist.ErrInvalidValue, err)
+	}
+
+	if len(responder.accepted) != 0 {
+		t.Fatalf("Accept(): expected expired messages to be forgotten but got %d", len(responder.accepted))
+	}
+
+	if len(sent) != 1 {
+		t.Fatalf("Accept(): expected 1 sent message but got %d", len(sent))
+	}
+}
+
+func TestResponderSimultaneousReset(t *testing.T) {
+	t.Parallel()
+
+	alice, bob := newTestIdentity(t), newTestIdentity(t)
+
+	// Note that the participant with the smaller identity public key wins.
+	winner, loser := alice, bob
+	if bytes.Compare(alice.PublicKey.Bytes, bob.PublicKey.Bytes) > 0 {
+		winner, loser = bob, alice
+	}
+
+	winnerResponder, loserResponder := NewResponder(winner, loser.PublicKey), NewResponder(loser, winner.PublicKey)
+
+	var winnerSent, loserSent []testMessage
+
+	var loserQueue Queue
+	loserQueue.Push([]byte{1}, nil)
+
+	winnerInitiator, winnerMessage, err := winnerResponder.Initiate(nil, nil)
+	if err != nil {
+		t.Fatalf("Initiate(): expected no error but got %v", err)
+	}
+
+	loserInitiator, loserMessage, err := loserResponder.Initiate(&loserQueue, newTestSend(&loserSent))
+	if err != nil {
+		t.Fatalf("Initiate(): expected no error but got %v", err)
+	}
+
+	_, err = winnerResponder.Accept(loserMessage, nil, newTestSend(&winnerSent))
+	if !errors.Is(err, ErrSimultaneousReset) {
+		t.Fatalf("Accept(): expected error %v but got %v", ErrSimultaneousReset, err)
+	}
+
+	loserRatchet, err := loserResponder.Accept(winnerMessage, &loserQueue, newTestSend(&loserSent))
+	if err != nil {
+		t.Fatalf("Accept(): expected no error but got %v", err)
+	}
+
+	if len(winnerSent) != 0 || len(loserSent) != 2 {
+		t.Fatalf("Accept(): expected 0 and 2 sent messages but got %d and %d", len(winnerSent), len(loserSent))
+	}
+
+	if _, err := loserInitiator.Decrypt(loserSent[0].encryptedHeader, loserSent[0].encryptedData, nil); err == nil {
+		t.Fatal("Decrypt(): expected error for abandoned reset but got nil")
+	}
+
+	for i, expectedData := range [][]byte{nil, {1}} {
+		data, err := winnerInitiator.Decrypt(loserSent[i].encryptedHeader, loserSent[i].encryptedData, nil)
+		if err != nil {
+			t.Fatalf("Decrypt(): expected no error but got %v", err)
+		}
+
+		if !bytes.Equal(data, expectedData) {
+			t.Fatalf("Decrypt(): expected %v but got %v", expectedData, data)
+		}
+	}
+
+	encryptedHeader, encryptedData, err := winnerInitiator.Ratchet().Encrypt([]byte{2}, nil)
+	if err != nil {
+		t.Fatalf("Encrypt(): expected no error but got %v", err)
+	}
+
+	if _, err := loserRatchet.Decrypt(encryptedHeader, encryptedData, nil); err != nil {
+		t.Fatalf("Decrypt(): expected no error but got %v", err)
+	}
+
+	_, err = winnerResponder.Accept(loserMessage, nil, newTestSend(&winnerSent))
+	if !errors.Is(err, errlist.ErrDuplicateMessage) {
+		t.Fatalf("Accept(): expected error %v for replayed message but got %v", errlist.ErrDuplicateMessage, err)
+	}
+}
+
+func TestResponderAcceptSendError(t *testing.T) {
+	t.Parallel()
+
+	alice, bob := newTestIdentity(t), newTestIdentity(t)
+
+	_, message, err := Initiate(alice, bob.PublicKey, nil, nil)
+	if err != nil {
+		t.Fatalf("Initiate(): expected no error but got %v", err)
+	}
+
+	responder := NewResponder(bob, alice.PublicKey)
+	errSend := errors.New("send")
+
+	_, err = responder.Accept(message, nil, func(_, _ []byte) error { return errSend })
+	if !errors.Is(err, errSend) {
+		t.Fatalf("Accept(): expected error %v but got %v", errSend, err)
+	}
+
+	var sent []testMessage
+
+	if _, err := responder.Accept(message, nil, newTestSend(&sent)); err != nil {
+		t.Fatalf("Accept(): expected no error after failed send but got %v", err)
+	}
+}
+
+func TestAcceptErrors(t *testing.T) {
+	t.Parallel()
+
+	alice, bob, eve := newTestIdentity(t), newTestIdentity(t), newTestIdentity(t)
+
+	_, message, err := Initiate(alice, bob.PublicKey, nil, nil)
+	if err != nil {
+		t.Fatalf("Initiate(): expected no error but got %v", err)
+	}
+
+	forgedTag := bytes.Clone(message)
+	forgedTag[len(forgedTag)-1] ^= 1
+
+	forgedVersion := bytes.Clone(message)
+	forgedVersion[len(messagePrefix)] = Version + 1
+
+	forgedTime := bytes.Clone(message)
+	forgedTime[len(messagePrefix)+1] ^= 1
+
+	var sent []testMessage
+
+	tests := []struct {
+		name              string
+		local             Identity
+		remoteIdentityKey keys.Public
+		message           []byte
+		send              SendFunc
+		expectedErr       error
+	}{
+		{"forged tag", bob, alice.PublicKey, forgedTag, newTestSend(&sent), errlist.ErrCrypto},
+		{"forged time", bob, alice.PublicKey, forgedTime, newTestSend(&sent), errlist.ErrCrypto},
+		{"wrong remote identity", bob, eve.PublicKey, message, newTestSend(&sent), errlist.ErrCrypto},
+		{"wrong local identity", eve, alice.PublicKey, message, newTestSend(&sent), errlist.ErrCrypto},
+		{"unsupported version", bob, alice.PublicKey, forgedVersion, newTestSend(&sent), errlist.ErrInvalidValue},
+		{"not a reset message", bob, alice.PublicKey, message[1:], newTestSend(&sent), errlist.ErrInvalidValue},
+		{"nil send", bob, alice.PublicKey, message, nil, errlist.ErrInvalidValue},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := NewResponder(test.local, test.remoteIdentityKey).Accept(test.message, nil, test.send)
+			if !errors.Is(err, test.expectedErr) {
+				t.Fatalf("Accept(): expected error %v but got %v", test.expectedErr, err)
+			}
+		})
+	}
+}
@@ -1,14 +1,23 @@
 package rootchain
 
 import (
+	"encoding/binary"
 	"fmt"
+	"slices"
+
+	"golang.org/x/crypto/blake2b"
 
 	"github.com/platform-inf/go-ratchet/errlist"
+	"github.com/platform-inf/go-ratchet/journal"
 	"github.com/platform-inf/go-ratchet/keys"
 )
 
+// shortAuthenticationStringKeyPrefix separates short authentication string derivation from other uses of the root key.
+var shortAuthenticationStringKeyPrefix = []byte("short authentication string")
+
 type Chain struct {
 	rootKey keys.Root
+	epoch   uint64
 	cfg     config
 }
 
@@ -18,7 +27,7 @@ func New(rootKey keys.Root, options ...Option) (Chain, error) {
 		return Chain{}, fmt.Errorf("new config: %w", err)
 	}
 
-	return Chain{rootKey: rootKey, cfg: cfg}, nil
+	return Chain{rootKey: rootKey.MoveTo(cfg.rootKeyAllocator), cfg: cfg}, nil
 }
 
 func (ch *Chain) Advance(sharedKey keys.Shared) (keys.MessageMaster, keys.Header, error) {
@@ -27,12 +36,54 @@ func (ch *Chain) Advance(sharedKey keys.Shared) (keys.MessageMaster, keys.Header
 		return keys.MessageMaster{}, keys.Header{}, fmt.Errorf("%w: advance: %w", errlist.ErrCrypto, err)
 	}
 
+	allocator := ch.cfg.rootKeyAllocator
+	oldRootKey := ch.rootKey
+	newRootKey = newRootKey.MoveTo(allocator)
 	ch.rootKey = newRootKey
+	ch.epoch++
+
+	ch.cfg.journal.OnCommit(func() { oldRootKey.Free(allocator) })
+	ch.cfg.journal.OnRollback(func() { newRootKey.Free(allocator) })
 
 	return messageMasterKey, nextHeaderKey, nil
 }
 
 func (ch Chain) Clone() Chain {
-	ch.rootKey = ch.rootKey.Clone()
+	ch.rootKey = ch.rootKey.CloneWith(ch.cfg.rootKeyAllocator)
 	return ch
 }
+
+// CloneWithJournal clones the chain, which records root key changes in the passed journal.
+func (ch Chain) CloneWithJournal(journal *journal.Journal) Chain {
+	ch = ch.Clone()
+	ch.cfg.journal = journal
+
+	return ch
+}
+
+// DeriveShortAuthenticationString derives bytes of the short authentication string from the current root key. Both
+// participants derive the same bytes at the same epoch. The root key can not be restored from the result.
+func (ch Chain) DeriveShortAuthenticationString(size int) ([]byte, error) {
+	hash, err := blake2b.New(size, ch.rootKey.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%w: new hash: %w", errlist.ErrCrypto, err)
+	}
+
+	input := binary.LittleEndian.AppendUint64(slices.Clone(shortAuthenticationStringKeyPrefix), ch.epoch)
+	if _, err := hash.Write(input); err != nil {
+		return nil, fmt.Errorf("%w: write to hash: %w", errlist.ErrCrypto, err)
+	}
+
+	return hash.Sum(nil), nil
+}
+
+// Epoch returns the number of root chain advances, i.e. Diffie-Hellman ratchet steps. Both participants have the same
+// root key at the same epoch.
+func (ch Chain) Epoch() uint64 {
+	return ch.epoch
+}
+
+// Wipe overwrites the root key with zeros and releases its memory. The chain must not be used after wiping.
+func (ch *Chain) Wipe() {
+	ch.rootKey.Free(ch.cfg.rootKeyAllocator)
+}
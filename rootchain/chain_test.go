@@ -125,3 +125,51 @@ func TestChainClone(t *testing.T) {
 		})
 	}
 }
+
+func TestChainWipe(t *testing.T) {
+	t.Parallel()
+
+	rootKey := keys.Root{Bytes: []byte{1, 2, 3, 4, 5}}
+
+	chain, err := New(rootKey)
+	if err != nil {
+		t.Fatalf("New(): expected no error but got %v", err)
+	}
+
+	chain.Wipe()
+
+	if !reflect.DeepEqual(rootKey.Bytes, make([]byte, 5)) {
+		t.Fatalf("%+v.Wipe(): root key is not wiped: %v", chain, rootKey.Bytes)
+	}
+}
+
+func TestChainDeriveShortAuthenticationString(t *testing.T) {
+	t.Parallel()
+
+	chain, err := New(keys.Root{Bytes: []byte{1, 2, 3}})
+	if err != nil {
+		t.Fatalf("New(): expected no error but got %v", err)
+	}
+
+	sas, err := chain.DeriveShortAuthenticationString(6)
+	if err != nil || len(sas) != 6 {
+		t.Fatalf("DeriveShortAuthenticationString(6): expected 6 bytes but got %v and error %v", sas, err)
+	}
+
+	if _, _, err = chain.Advance(keys.Shared{Bytes: []byte{4, 5, 6}}); err != nil {
+		t.Fatalf("Advance(): expected no error but got %v", err)
+	}
+
+	if chain.Epoch() != 1 {
+		t.Fatalf("Advance(): expected epoch 1 but got %d", chain.Epoch())
+	}
+
+	newSAS, err := chain.DeriveShortAuthenticationString(6)
+	if err != nil || reflect.DeepEqual(newSAS, sas) {
+		t.Fatalf("DeriveShortAuthenticationString(6): expected new bytes but got %v and error %v", newSAS, err)
+	}
+
+	if _, err = chain.DeriveShortAuthenticationString(0); !errors.Is(err, errlist.ErrCrypto) {
+		t.Fatalf("DeriveShortAuthenticationString(0): expected crypto error but got %v", err)
+	}
+}
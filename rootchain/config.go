@@ -4,11 +4,15 @@ import (
 	"fmt"
 
 	"github.com/platform-inf/go-ratchet/errlist"
+	"github.com/platform-inf/go-ratchet/journal"
+	"github.com/platform-inf/go-ratchet/keys"
 	"github.com/platform-inf/go-utils"
 )
 
 type config struct {
-	crypto Crypto
+	crypto           Crypto
+	journal          *journal.Journal
+	rootKeyAllocator keys.Allocator
 }
 
 func newConfig(options ...Option) (config, error) {
@@ -44,3 +48,30 @@ func WithCrypto(crypto Crypto) Option {
 		return nil
 	}
 }
+
+// WithJournal makes the chain record its side effects, e.g. wiping of superseded keys, in the passed journal instead of
+// applying them immediately. It allows to roll back a shallow copy of the chain.
+func WithJournal(journal *journal.Journal) Option {
+	return func(cfg *config) error {
+		if journal == nil {
+			return fmt.Errorf("%w: journal is nil", errlist.ErrInvalidValue)
+		}
+
+		cfg.journal = journal
+
+		return nil
+	}
+}
+
+// WithRootKeyAllocator sets allocator for root key bytes, e.g. keys.LockedAllocator. By default root key is on Go heap.
+func WithRootKeyAllocator(allocator keys.Allocator) Option {
+	return func(cfg *config) error {
+		if utils.IsNil(allocator) {
+			return fmt.Errorf("%w: allocator is nil", errlist.ErrInvalidValue)
+		}
+
+		cfg.rootKeyAllocator = allocator
+
+		return nil
+	}
+}
@@ -61,4 +61,31 @@ func TestNewConfig(t *testing.T) {
 			t.Fatalf("WithCrypto(nil) error is not invalid value error but %v", err)
 		}
 	})
+	t.Run("root key allocator option success", func(t *testing.T) {
+		t.Parallel()
+
+		allocator := keys.NewLockedAllocator()
+
+		cfg, err := newConfig(WithRootKeyAllocator(allocator))
+		if err != nil {
+			t.Fatalf("newConfig() with options expected no error but got %v", err)
+		}
+
+		if cfg.rootKeyAllocator != allocator {
+			t.Fatal("WithRootKeyAllocator() option did not set passed allocator")
+		}
+	})
+
+	t.Run("root key allocator option error", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := newConfig(WithRootKeyAllocator(nil))
+		if err == nil || err.Error() != "option: invalid value: allocator is nil" {
+			t.Fatalf("WithRootKeyAllocator(nil) expected error but got %v", err)
+		}
+
+		if !errors.Is(err, errlist.ErrOption) || !errors.Is(err, errlist.ErrInvalidValue) {
+			t.Fatalf("WithRootKeyAllocator(nil) error is not option and invalid value error but %v", err)
+		}
+	})
 }
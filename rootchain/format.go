@@ -0,0 +1,30 @@
+package rootchain
+
+import (
+	"fmt"
+	"log/slog"
+)
+
+// Format prints only the epoch of the chain.
+func (ch Chain) Format(state fmt.State, verb rune) {
+	if verb == 'v' && state.Flag('#') {
+		_, _ = state.Write([]byte(ch.GoString()))
+		return
+	}
+
+	_, _ = state.Write([]byte(ch.String()))
+}
+
+func (ch Chain) GoString() string {
+	return "rootchain." + ch.String()
+}
+
+func (ch Chain) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.Uint64("epoch", ch.epoch),
+	)
+}
+
+func (ch Chain) String() string {
+	return fmt.Sprintf("Chain{epoch: %d}", ch.epoch)
+}
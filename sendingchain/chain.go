@@ -5,20 +5,22 @@ import (
 
 	"github.com/platform-inf/go-ratchet/errlist"
 	"github.com/platform-inf/go-ratchet/header"
+	"github.com/platform-inf/go-ratchet/journal"
 	"github.com/platform-inf/go-ratchet/keys"
-	"github.com/platform-inf/go-utils"
+	"github.com/platform-inf/go-ratchet/messagechainscommon"
 )
 
 // Ratchet sending chain.
 //
-// Please note that this structure may corrupt its state in case of errors. Therefore, clone the data at the top level
-// and replace the current data with it if there are no errors.
+// Please note that this structure may corrupt its state in case of errors. Therefore, copy the data at the top level,
+// pass a journal with WithJournal and restore the copy with journal rollback if there are errors.
 type Chain struct {
 	masterKey                  *keys.MessageMaster
 	headerKey                  *keys.Header
 	nextHeaderKey              keys.Header
 	nextMessageNumber          uint64
 	previousChainMessagesCount uint64
+	authBuffer                 []byte
 	cfg                        config
 }
 
@@ -51,16 +53,30 @@ func (ch Chain) Clone() Chain {
 	ch.masterKey = ch.masterKey.ClonePtr()
 	ch.headerKey = ch.headerKey.ClonePtr()
 	ch.nextHeaderKey = ch.nextHeaderKey.Clone()
+	ch.authBuffer = nil
+
+	return ch
+}
+
+// CloneWithJournal clones the chain and attaches the passed journal to the clone.
+func (ch Chain) CloneWithJournal(journal *journal.Journal) Chain {
+	ch = ch.Clone()
+	ch.cfg.journal = journal
 
 	return ch
 }
 
 func (ch *Chain) Encrypt(header header.Header, data, auth []byte) ([]byte, []byte, error) {
+	return ch.EncryptTo(nil, nil, header, data, auth)
+}
+
+// EncryptTo appends encrypted header and data to dstHeader and dstData and returns the extended buffers.
+func (ch *Chain) EncryptTo(dstHeader, dstData []byte, header header.Header, data, auth []byte) ([]byte, []byte, error) {
 	if ch.headerKey == nil {
 		return nil, nil, fmt.Errorf("%w: header key is nil", errlist.ErrInvalidValue)
 	}
 
-	encryptedHeader, err := ch.cfg.crypto.EncryptHeader(*ch.headerKey, header)
+	encryptedHeader, err := ch.encryptHeader(dstHeader, header)
 	if err != nil {
 		return nil, nil, fmt.Errorf("%w: encrypt header: %w", errlist.ErrCrypto, err)
 	}
@@ -70,9 +86,13 @@ func (ch *Chain) Encrypt(header header.Header, data, auth []byte) ([]byte, []byt
 		return nil, nil, fmt.Errorf("advance chain: %w", err)
 	}
 
-	auth = utils.ConcatByteSlices(encryptedHeader, auth)
+	defer messageKey.Wipe()
+
+	// Note that only the appended part of the header buffer is authenticated.
+	ch.authBuffer = messagechainscommon.AppendMessageAuth(
+		ch.authBuffer[:0], encryptedHeader[len(dstHeader):], ch.cfg.associatedData, auth)
 
-	encryptedData, err := ch.cfg.crypto.EncryptMessage(messageKey, data, auth)
+	encryptedData, err := ch.encryptMessage(dstData, messageKey, data, ch.authBuffer)
 	if err != nil {
 		return nil, nil, fmt.Errorf("%w: encrypt message: %w", errlist.ErrCrypto, err)
 	}
@@ -80,6 +100,11 @@ func (ch *Chain) Encrypt(header header.Header, data, auth []byte) ([]byte, []byt
 	return encryptedHeader, encryptedData, nil
 }
 
+// NextMessageNumber returns number of the next message in the current chain.
+func (ch Chain) NextMessageNumber() uint64 {
+	return ch.nextMessageNumber
+}
+
 func (ch *Chain) PrepareHeader(publicKey keys.Public) header.Header {
 	return header.Header{
 		PublicKey:                         publicKey,
@@ -88,8 +113,25 @@ func (ch *Chain) PrepareHeader(publicKey keys.Public) header.Header {
 	}
 }
 
+// PreviousChainMessagesCount returns number of messages sent in the previous chain.
+func (ch Chain) PreviousChainMessagesCount() uint64 {
+	return ch.previousChainMessagesCount
+}
+
+// Upgrade replaces the chain keys with the new ones. Superseded master and header keys are wiped.
 func (ch *Chain) Upgrade(masterKey keys.MessageMaster, nextHeaderKey keys.Header) {
-	headerKey := ch.nextHeaderKey.Clone()
+	oldMasterKey, oldHeaderKey := ch.masterKey, ch.headerKey
+	headerKey := ch.nextHeaderKey
+
+	ch.cfg.journal.OnCommit(func() {
+		oldMasterKey.Wipe()
+		oldHeaderKey.Wipe()
+	})
+
+	ch.cfg.journal.OnRollback(func() {
+		masterKey.Wipe()
+		nextHeaderKey.Wipe()
+	})
 
 	ch.masterKey = &masterKey
 	ch.headerKey = &headerKey
@@ -98,6 +140,13 @@ func (ch *Chain) Upgrade(masterKey keys.MessageMaster, nextHeaderKey keys.Header
 	ch.nextMessageNumber = 0
 }
 
+// Wipe overwrites all chain keys with zeros. The chain must not be used after wiping.
+func (ch *Chain) Wipe() {
+	ch.masterKey.Wipe()
+	ch.headerKey.Wipe()
+	ch.nextHeaderKey.Wipe()
+}
+
 func (ch *Chain) advance() (keys.Message, error) {
 	if ch.masterKey == nil {
 		return keys.Message{}, fmt.Errorf("%w: master key is nil", errlist.ErrInvalidValue)
@@ -108,8 +157,38 @@ func (ch *Chain) advance() (keys.Message, error) {
 		return keys.Message{}, fmt.Errorf("%w: advance via crypto: %w", errlist.ErrCrypto, err)
 	}
 
+	oldMasterKey := ch.masterKey
+	ch.cfg.journal.OnCommit(oldMasterKey.Wipe)
+	ch.cfg.journal.OnRollback(newMasterKey.Wipe)
+
 	ch.masterKey = &newMasterKey
 	ch.nextMessageNumber++
 
 	return messageKey, nil
 }
+
+func (ch *Chain) encryptHeader(dst []byte, header header.Header) ([]byte, error) {
+	if crypto, ok := ch.cfg.crypto.(AppendCrypto); ok {
+		return crypto.AppendEncryptedHeader(dst, *ch.headerKey, header)
+	}
+
+	encryptedHeader, err := ch.cfg.crypto.EncryptHeader(*ch.headerKey, header)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(dst, encryptedHeader...), nil
+}
+
+func (ch *Chain) encryptMessage(dst []byte, key keys.Message, data, auth []byte) ([]byte, error) {
+	if crypto, ok := ch.cfg.crypto.(AppendCrypto); ok {
+		return crypto.AppendEncryptedMessage(dst, key, data, auth)
+	}
+
+	encryptedData, err := ch.cfg.crypto.EncryptMessage(key, data, auth)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(dst, encryptedData...), nil
+}
@@ -371,3 +371,24 @@ func TestChainUpgrade(t *testing.T) {
 		)
 	}
 }
+
+func TestChainWipe(t *testing.T) {
+	t.Parallel()
+
+	masterKey := keys.MessageMaster{Bytes: []byte{1, 2, 3}}
+	headerKey := keys.Header{Bytes: []byte{4, 5, 6}}
+	nextHeaderKey := keys.Header{Bytes: []byte{7, 8, 9}}
+
+	chain, err := New(&masterKey, &headerKey, nextHeaderKey, 0, 0)
+	if err != nil {
+		t.Fatalf("New(): expected no error but got %v", err)
+	}
+
+	chain.Wipe()
+
+	for _, key := range [][]byte{masterKey.Bytes, headerKey.Bytes, nextHeaderKey.Bytes} {
+		if !reflect.DeepEqual(key, make([]byte, 3)) {
+			t.Fatalf("%+v.Wipe(): key is not wiped: %v", chain, key)
+		}
+	}
+}
@@ -2,13 +2,20 @@ package sendingchain
 
 import (
 	"fmt"
+	"slices"
 
 	"github.com/platform-inf/go-ratchet/errlist"
+	"github.com/platform-inf/go-ratchet/journal"
+	"github.com/platform-inf/go-ratchet/padding"
 	"github.com/platform-inf/go-utils"
 )
 
 type config struct {
-	crypto Crypto
+	associatedData         []byte
+	crypto                 Crypto
+	headerPaddingBlockSize int
+	journal                *journal.Journal
+	paddingScheme          padding.Scheme
 }
 
 func newConfig(options ...Option) (config, error) {
@@ -18,6 +25,10 @@ func newConfig(options ...Option) (config, error) {
 		return config{}, fmt.Errorf("%w: %w", errlist.ErrOption, err)
 	}
 
+	if err := cfg.configureDefaultCrypto(); err != nil {
+		return config{}, fmt.Errorf("%w: %w", errlist.ErrOption, err)
+	}
+
 	return cfg, nil
 }
 
@@ -31,8 +42,41 @@ func (cfg *config) applyOptions(options ...Option) error {
 	return nil
 }
 
+// configureDefaultCrypto passes crypto related options to the default crypto. Note that these options are not
+// supported by custom crypto, which must implement them on its own.
+func (cfg *config) configureDefaultCrypto() error {
+	if cfg.headerPaddingBlockSize == 0 && cfg.paddingScheme == nil {
+		return nil
+	}
+
+	crypto, ok := cfg.crypto.(defaultCrypto)
+	if !ok {
+		return fmt.Errorf("%w: padding is not supported by custom crypto", errlist.ErrInvalidValue)
+	}
+
+	crypto.headerPaddingBlockSize = cfg.headerPaddingBlockSize
+	crypto.paddingScheme = cfg.paddingScheme
+	cfg.crypto = crypto
+
+	return nil
+}
+
 type Option func(cfg *config) error
 
+// WithAssociatedData sets associated data of the conversation, e.g. identity public keys of both participants, which is
+// authenticated with every message before the auth passed to Encrypt. Both participants must use the same data.
+func WithAssociatedData(data []byte) Option {
+	return func(cfg *config) error {
+		if len(data) == 0 {
+			return fmt.Errorf("%w: associated data is empty", errlist.ErrInvalidValue)
+		}
+
+		cfg.associatedData = slices.Clone(data)
+
+		return nil
+	}
+}
+
 func WithCrypto(crypto Crypto) Option {
 	return func(cfg *config) error {
 		if utils.IsNil(crypto) {
@@ -44,3 +88,45 @@ func WithCrypto(crypto Crypto) Option {
 		return nil
 	}
 }
+
+// WithHeaderPadding pads encoded headers to a multiple of blockSize before encryption, so encrypted headers of the same
+// conversation have the same length. The receiving chain must use the same block size.
+func WithHeaderPadding(blockSize int) Option {
+	return func(cfg *config) error {
+		if blockSize <= 0 {
+			return fmt.Errorf("%w: non-positive header padding block size %d", errlist.ErrInvalidValue, blockSize)
+		}
+
+		cfg.headerPaddingBlockSize = blockSize
+
+		return nil
+	}
+}
+
+// WithJournal makes the chain record its side effects, e.g. wiping of superseded keys, in the passed journal instead of
+// applying them immediately. It allows to roll back a shallow copy of the chain.
+func WithJournal(journal *journal.Journal) Option {
+	return func(cfg *config) error {
+		if journal == nil {
+			return fmt.Errorf("%w: journal is nil", errlist.ErrInvalidValue)
+		}
+
+		cfg.journal = journal
+
+		return nil
+	}
+}
+
+// WithPadding pads data with the passed scheme before encryption, so encrypted data length does not reveal exact data
+// length. The receiving chain must use the same scheme.
+func WithPadding(scheme padding.Scheme) Option {
+	return func(cfg *config) error {
+		if utils.IsNil(scheme) {
+			return fmt.Errorf("%w: padding scheme is nil", errlist.ErrInvalidValue)
+		}
+
+		cfg.paddingScheme = scheme
+
+		return nil
+	}
+}
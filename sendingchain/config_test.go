@@ -70,4 +70,31 @@ func TestNewConfig(t *testing.T) {
 			t.Fatalf("WithCrypto(nil) error is not invalid value error but %v", err)
 		}
 	})
+
+	t.Run("header padding option success", func(t *testing.T) {
+		t.Parallel()
+
+		cfg, err := newConfig(WithHeaderPadding(64))
+		if err != nil {
+			t.Fatalf("newConfig() with options expected no error but got %v", err)
+		}
+
+		if crypto, ok := cfg.crypto.(defaultCrypto); !ok || crypto.headerPaddingBlockSize != 64 {
+			t.Fatalf("WithHeaderPadding() option did not configure default crypto: %+v", cfg.crypto)
+		}
+	})
+
+	t.Run("header padding option error", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := newConfig(WithHeaderPadding(0))
+		if err == nil || err.Error() != "option: invalid value: non-positive header padding block size 0" {
+			t.Fatalf("WithHeaderPadding(0) expected error but got %v", err)
+		}
+
+		_, err = newConfig(WithHeaderPadding(64), WithCrypto(testCrypto{}))
+		if err == nil || err.Error() != "option: invalid value: padding is not supported by custom crypto" {
+			t.Fatalf("WithHeaderPadding() with custom crypto expected error but got %v", err)
+		}
+	})
 }
@@ -1,18 +1,16 @@
 package sendingchain
 
 import (
-	"crypto/hmac"
 	"crypto/rand"
 	"fmt"
-	"hash"
+	"slices"
 
-	"golang.org/x/crypto/blake2b"
 	cipher "golang.org/x/crypto/chacha20poly1305"
 
 	"github.com/platform-inf/go-ratchet/header"
 	"github.com/platform-inf/go-ratchet/keys"
 	"github.com/platform-inf/go-ratchet/messagechainscommon"
-	"github.com/platform-inf/go-utils"
+	"github.com/platform-inf/go-ratchet/padding"
 )
 
 type Crypto interface {
@@ -21,74 +19,88 @@ type Crypto interface {
 	EncryptMessage(key keys.Message, data, auth []byte) ([]byte, error)
 }
 
-type defaultCrypto struct{}
+// AppendCrypto is an optional interface of Crypto, which encrypts into caller buffers to reduce allocations.
+type AppendCrypto interface {
+	// AppendEncryptedHeader must append encrypted header to dst and return the extended buffer.
+	AppendEncryptedHeader(dst []byte, key keys.Header, header header.Header) ([]byte, error)
+
+	// AppendEncryptedMessage must append encrypted data to dst and return the extended buffer.
+	AppendEncryptedMessage(dst []byte, key keys.Message, data, auth []byte) ([]byte, error)
+}
+
+type defaultCrypto struct {
+	headerPaddingBlockSize int
+	paddingScheme          padding.Scheme
+}
 
 func newDefaultCrypto() defaultCrypto {
 	return defaultCrypto{}
 }
 
 func (c defaultCrypto) AdvanceChain(masterKey keys.MessageMaster) (keys.MessageMaster, keys.Message, error) {
-	var newHashErr error
-
-	getHasher := func() hash.Hash {
-		var hasher hash.Hash
-		hasher, newHashErr = blake2b.New512(nil)
-
-		return hasher
-	}
-
-	mac := hmac.New(getHasher, masterKey.Bytes)
+	return messagechainscommon.AdvanceChain(masterKey)
+}
 
-	const masterKeyByte = 0x02
-	if _, err := mac.Write([]byte{masterKeyByte}); err != nil {
-		return keys.MessageMaster{}, keys.Message{}, fmt.Errorf("write %d byte to MAC: %w", masterKeyByte, err)
+func (c defaultCrypto) AppendEncryptedHeader(dst []byte, key keys.Header, header header.Header) ([]byte, error) {
+	cipher, err := cipher.NewX(key.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("new cipher: %w", err)
 	}
 
-	newMasterKey := keys.MessageMaster{Bytes: mac.Sum(nil)}
-	mac.Reset()
-
-	const messageKeyByte = 0x01
-	if _, err := mac.Write([]byte{messageKeyByte}); err != nil {
-		return keys.MessageMaster{}, keys.Message{}, fmt.Errorf("write %d byte to MAC: %w", messageKeyByte, err)
+	headerLen := header.EncodedLen()
+	if c.headerPaddingBlockSize > 0 {
+		headerLen = header.PaddedLen(c.headerPaddingBlockSize)
 	}
 
-	messageKey := keys.Message{Bytes: mac.Sum(nil)}
-
-	if newHashErr != nil {
-		return keys.MessageMaster{}, keys.Message{}, fmt.Errorf("new hash: %w", newHashErr)
-	}
+	dst = slices.Grow(dst, cipher.NonceSize()+headerLen+cipher.Overhead())
 
-	return newMasterKey, messageKey, nil
-}
+	nonceStart := len(dst)
+	dst = dst[:nonceStart+cipher.NonceSize()]
 
-func (c defaultCrypto) EncryptHeader(key keys.Header, header header.Header) ([]byte, error) {
-	var nonce [cipher.NonceSizeX]byte
-	if _, err := rand.Read(nonce[:]); err != nil {
+	if _, err := rand.Read(dst[nonceStart:]); err != nil {
 		return nil, fmt.Errorf("generate random nonce: %w", err)
 	}
 
-	encryptedHeader, err := c.encrypt(key.Bytes, nonce[:], header.Encode(), nil)
-	if err != nil {
-		return nil, err
+	// Note that header is encoded right into dst and then encrypted in place.
+	headerStart := len(dst)
+	if c.headerPaddingBlockSize > 0 {
+		dst = header.AppendPadded(dst, c.headerPaddingBlockSize)
+	} else {
+		dst = header.Append(dst)
 	}
 
-	return utils.ConcatByteSlices(nonce[:], encryptedHeader), nil
+	return cipher.Seal(dst[:headerStart], dst[nonceStart:headerStart], dst[headerStart:], nil), nil
 }
 
-func (c defaultCrypto) EncryptMessage(key keys.Message, data, auth []byte) ([]byte, error) {
+func (c defaultCrypto) AppendEncryptedMessage(dst []byte, key keys.Message, data, auth []byte) ([]byte, error) {
 	cipherKey, nonce, err := messagechainscommon.DeriveMessageCipherKeyAndNonce(key)
 	if err != nil {
 		return nil, fmt.Errorf("derive key and nonce: %w", err)
 	}
 
-	return c.encrypt(cipherKey, nonce, data, auth)
-}
+	defer clear(cipherKey)
 
-func (c defaultCrypto) encrypt(key, nonce, data, auth []byte) ([]byte, error) {
-	cipher, err := cipher.NewX(key)
+	cipher, err := cipher.NewX(cipherKey)
 	if err != nil {
 		return nil, fmt.Errorf("new cipher: %w", err)
 	}
 
-	return cipher.Seal(nil, nonce, data, auth), nil
+	if c.paddingScheme == nil {
+		return cipher.Seal(dst, nonce, data, auth), nil
+	}
+
+	// Note that data is padded right into dst and then encrypted in place.
+	dst = slices.Grow(dst, c.paddingScheme.PaddedLen(len(data))+cipher.Overhead())
+	dataStart := len(dst)
+	dst = padding.Append(dst, data, c.paddingScheme)
+
+	return cipher.Seal(dst[:dataStart], nonce, dst[dataStart:], auth), nil
+}
+
+func (c defaultCrypto) EncryptHeader(key keys.Header, header header.Header) ([]byte, error) {
+	return c.AppendEncryptedHeader(nil, key, header)
+}
+
+func (c defaultCrypto) EncryptMessage(key keys.Message, data, auth []byte) ([]byte, error) {
+	return c.AppendEncryptedMessage(nil, key, data, auth)
 }
@@ -0,0 +1,35 @@
+package sendingchain
+
+import (
+	"fmt"
+	"log/slog"
+)
+
+// Format prints only the message counters of the chain.
+func (ch Chain) Format(state fmt.State, verb rune) {
+	if verb == 'v' && state.Flag('#') {
+		_, _ = state.Write([]byte(ch.GoString()))
+		return
+	}
+
+	_, _ = state.Write([]byte(ch.String()))
+}
+
+func (ch Chain) GoString() string {
+	return "sendingchain." + ch.String()
+}
+
+func (ch Chain) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.Uint64("next_message_number", ch.nextMessageNumber),
+		slog.Uint64("previous_chain_messages_count", ch.previousChainMessagesCount),
+	)
+}
+
+func (ch Chain) String() string {
+	return fmt.Sprintf(
+		"Chain{next message number: %d, previous chain messages count: %d}",
+		ch.nextMessageNumber,
+		ch.previousChainMessagesCount,
+	)
+}
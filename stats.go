@@ -0,0 +1,43 @@
+package ratchet
+
+import "fmt"
+
+// Stats describes the ratchet state for debugging. Note that it never contains key bytes: keys are identified by
+// fingerprints.
+type Stats struct {
+	// Epoch is the number of Diffie-Hellman ratchet steps.
+	Epoch                             uint64
+	SendingChainNextMessageNumber     uint64
+	PreviousSendingChainMessagesCount uint64
+	ReceivingChainNextMessageNumber   uint64
+	// SkippedKeysCounts contains numbers of skipped message keys by fingerprints of their header keys.
+	SkippedKeysCounts map[string]int
+	// NeedSendingChainRatchet reports whether the next Encrypt performs Diffie-Hellman ratchet step.
+	NeedSendingChainRatchet    bool
+	LocalPublicKeyFingerprint  string
+	RemotePublicKeyFingerprint string
+}
+
+// Stats returns read-only statistics of the ratchet state.
+func (r Ratchet) Stats() (Stats, error) {
+	skippedKeysCounts, err := r.receivingChain.SkippedKeysCounts()
+	if err != nil {
+		return Stats{}, fmt.Errorf("count skipped keys: %w", err)
+	}
+
+	stats := Stats{
+		Epoch:                             r.rootChain.Epoch(),
+		SendingChainNextMessageNumber:     r.sendingChain.NextMessageNumber(),
+		PreviousSendingChainMessagesCount: r.sendingChain.PreviousChainMessagesCount(),
+		ReceivingChainNextMessageNumber:   r.receivingChain.NextMessageNumber(),
+		SkippedKeysCounts:                 skippedKeysCounts,
+		NeedSendingChainRatchet:           r.needSendingChainRatchet,
+		LocalPublicKeyFingerprint:         r.localPublicKey.Fingerprint(),
+	}
+
+	if r.remotePublicKey != nil {
+		stats.RemotePublicKeyFingerprint = r.remotePublicKey.Fingerprint()
+	}
+
+	return stats, nil
+}
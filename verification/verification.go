@@ -0,0 +1,151 @@
+// Package verification helps participants to confirm out of band, that there is no man in the middle.
+//
+// Safety number is derived from identity public keys of both participants and does not change during the
+// conversation. Short authentication string is derived from the root chain state, so it also confirms, that both
+// participants completed the same Diffie-Hellman ratchet steps.
+package verification
+
+import (
+	"crypto/sha512"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/platform-inf/go-ratchet/errlist"
+	"github.com/platform-inf/go-ratchet/keys"
+)
+
+const (
+	safetyNumberVersion          = 0
+	safetyNumberIterationsCount  = 5200
+	safetyNumberChunksCount      = 6
+	safetyNumberChunkBytesLen    = 5
+	safetyNumberChunkDigitsCount = 5
+)
+
+// ShortAuthenticationStringBytesLen is the length of bytes, which are needed to format the short authentication string.
+const ShortAuthenticationStringBytesLen = 6
+
+// shortAuthenticationStringEmojis contains 64 emojis, so each emoji encodes 6 bits.
+var shortAuthenticationStringEmojis = [64]string{
+	"🐶", "🐱", "🦁", "🐎", "🦄", "🐷", "🐘", "🐰",
+	"🐼", "🐓", "🐧", "🐢", "🐟", "🐙", "🦋", "🌷",
+	"🌳", "🌵", "🍄", "🌏", "🌙", "☁️", "🔥", "🍌",
+	"🍎", "🍓", "🌽", "🍕", "🎂", "❤️", "😀", "🤖",
+	"🎩", "👓", "🔧", "🎅", "👍", "☂️", "⌛", "⏰",
+	"🎁", "💡", "📕", "✏️", "📎", "✂️", "🔒", "🔑",
+	"🔨", "☎️", "🏁", "🚂", "🚲", "✈️", "🚀", "🏆",
+	"⚽", "🎸", "🎺", "🔔", "⚓", "🎧", "📁", "📌",
+}
+
+// SafetyNumber is a stable fingerprint of identity public keys of both participants. Both participants get the same
+// safety number regardless of the keys order.
+type SafetyNumber struct {
+	digits string
+}
+
+// NewSafetyNumber derives the safety number from identity public keys of the local and the remote participants.
+func NewSafetyNumber(localIdentityKey, remoteIdentityKey keys.Public) (SafetyNumber, error) {
+	if len(localIdentityKey.Bytes) == 0 || len(remoteIdentityKey.Bytes) == 0 {
+		return SafetyNumber{}, fmt.Errorf("%w: identity key is empty", errlist.ErrInvalidValue)
+	}
+
+	localFingerprint := deriveFingerprint(localIdentityKey)
+	remoteFingerprint := deriveFingerprint(remoteIdentityKey)
+
+	// Note that fingerprints are sorted, so both participants get the same digits.
+	if localFingerprint > remoteFingerprint {
+		localFingerprint, remoteFingerprint = remoteFingerprint, localFingerprint
+	}
+
+	return SafetyNumber{digits: localFingerprint + remoteFingerprint}, nil
+}
+
+// Digits returns the safety number as a string of digits.
+func (sn SafetyNumber) Digits() string {
+	return sn.digits
+}
+
+// Equal compares safety numbers, e.g. the local one with the one scanned from the remote participant's screen.
+func (sn SafetyNumber) Equal(other SafetyNumber) bool {
+	return sn.digits == other.digits
+}
+
+// String returns the safety number digits split into groups of 5 digits.
+func (sn SafetyNumber) String() string {
+	return formatGroups(sn.digits, safetyNumberChunkDigitsCount, " ")
+}
+
+// ShortAuthenticationString is a short string, which participants compare e.g. in a call. It is bound to the root
+// chain epoch, so participants must compare strings of the same epoch.
+type ShortAuthenticationString struct {
+	Epoch uint64
+	Bytes []byte
+}
+
+// Decimal returns the short authentication string as three 4-digit numbers.
+func (sas ShortAuthenticationString) Decimal() string {
+	bits := sas.bits()
+
+	numbers := make([]string, 0, 3)
+	for i := range 3 {
+		numbers = append(numbers, strconv.FormatUint((bits>>(35-13*i))&0x1FFF+1000, 10))
+	}
+
+	return strings.Join(numbers, " ")
+}
+
+// Emoji returns the short authentication string as 7 emojis.
+func (sas ShortAuthenticationString) Emoji() string {
+	bits := sas.bits()
+
+	emojis := make([]string, 0, 7)
+	for i := range 7 {
+		emojis = append(emojis, shortAuthenticationStringEmojis[(bits>>(42-6*i))&0x3F])
+	}
+
+	return strings.Join(emojis, " ")
+}
+
+// String returns the epoch and the decimal representation of the short authentication string.
+func (sas ShortAuthenticationString) String() string {
+	return fmt.Sprintf("%d: %s", sas.Epoch, sas.Decimal())
+}
+
+// bits returns the first 6 bytes as the lowest 48 bits of a number.
+func (sas ShortAuthenticationString) bits() uint64 {
+	var bytes [8]byte
+	copy(bytes[2:], sas.Bytes)
+
+	return binary.BigEndian.Uint64(bytes[:])
+}
+
+func deriveFingerprint(identityKey keys.Public) string {
+	hash := append([]byte{0, safetyNumberVersion}, identityKey.Bytes...)
+
+	for range safetyNumberIterationsCount {
+		sum := sha512.Sum512(append(hash, identityKey.Bytes...))
+		hash = sum[:]
+	}
+
+	var digits strings.Builder
+
+	for i := range safetyNumberChunksCount {
+		var chunk [8]byte
+		copy(chunk[8-safetyNumberChunkBytesLen:], hash[i*safetyNumberChunkBytesLen:(i+1)*safetyNumberChunkBytesLen])
+
+		fmt.Fprintf(&digits, "%05d", binary.BigEndian.Uint64(chunk[:])%100000)
+	}
+
+	return digits.String()
+}
+
+func formatGroups(s string, groupLen int, separator string) string {
+	groups := make([]string, 0, (len(s)+groupLen-1)/groupLen)
+	for start := 0; start < len(s); start += groupLen {
+		groups = append(groups, s[start:min(start+groupLen, len(s))])
+	}
+
+	return strings.Join(groups, separator)
+}
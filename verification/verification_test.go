@@ -0,0 +1,91 @@
+package verification
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/platform-inf/go-ratchet/errlist"
+	"github.com/platform-inf/go-ratchet/keys"
+)
+
+func TestNewSafetyNumber(t *testing.T) {
+	t.Parallel()
+
+	aliceKey := keys.Public{Bytes: []byte{1, 2, 3}}
+	bobKey := keys.Public{Bytes: []byte{4, 5, 6}}
+
+	aliceSafetyNumber, err := NewSafetyNumber(aliceKey, bobKey)
+	if err != nil {
+		t.Fatalf("NewSafetyNumber(): expected no error but got %v", err)
+	}
+
+	bobSafetyNumber, err := NewSafetyNumber(bobKey, aliceKey)
+	if err != nil {
+		t.Fatalf("NewSafetyNumber(): expected no error but got %v", err)
+	}
+
+	if !aliceSafetyNumber.Equal(bobSafetyNumber) {
+		t.Fatalf("NewSafetyNumber(): expected equal safety numbers but got %s and %s", aliceSafetyNumber, bobSafetyNumber)
+	}
+
+	if !regexp.MustCompile(`^[0-9]{60}$`).MatchString(aliceSafetyNumber.Digits()) {
+		t.Fatalf("Digits(): expected 60 digits but got %q", aliceSafetyNumber.Digits())
+	}
+
+	if !regexp.MustCompile(`^([0-9]{5} ){11}[0-9]{5}$`).MatchString(aliceSafetyNumber.String()) {
+		t.Fatalf("String(): expected 12 groups of 5 digits but got %q", aliceSafetyNumber.String())
+	}
+
+	eveSafetyNumber, err := NewSafetyNumber(aliceKey, keys.Public{Bytes: []byte{4, 5, 7}})
+	if err != nil {
+		t.Fatalf("NewSafetyNumber(): expected no error but got %v", err)
+	}
+
+	if eveSafetyNumber.Equal(aliceSafetyNumber) {
+		t.Fatalf("NewSafetyNumber(): expected different safety numbers but got %s", eveSafetyNumber)
+	}
+
+	if _, err = NewSafetyNumber(aliceKey, keys.Public{}); !errors.Is(err, errlist.ErrInvalidValue) {
+		t.Fatalf("NewSafetyNumber(): expected invalid value error but got %v", err)
+	}
+}
+
+func TestShortAuthenticationString(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		sas     ShortAuthenticationString
+		decimal string
+		emoji   string
+	}{
+		{"zero bytes", ShortAuthenticationString{Epoch: 1, Bytes: make([]byte, 6)}, "1000 1000 1000", "🐶 🐶 🐶 🐶 🐶 🐶 🐶"},
+		{
+			"full bytes",
+			ShortAuthenticationString{Epoch: 2, Bytes: []byte{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}},
+			"9191 9191 9191",
+			"📌 📌 📌 📌 📌 📌 📌",
+		},
+		{
+			"mixed bytes",
+			ShortAuthenticationString{Epoch: 3, Bytes: []byte{0x04, 0x10, 0x41, 0x04, 0x10, 0x40}},
+			"1130 1260 1520",
+			"🐱 🐱 🐱 🐱 🐱 🐱 🐱",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			if decimal := test.sas.Decimal(); decimal != test.decimal {
+				t.Fatalf("%+v.Decimal(): expected %q but got %q", test.sas, test.decimal, decimal)
+			}
+
+			if emoji := test.sas.Emoji(); emoji != test.emoji {
+				t.Fatalf("%+v.Emoji(): expected %q but got %q", test.sas, test.emoji, emoji)
+			}
+		})
+	}
+}